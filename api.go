@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/play-with-docker/play-with-docker/config"
@@ -17,6 +18,7 @@ import (
 	"github.com/play-with-docker/play-with-docker/scheduler"
 	"github.com/play-with-docker/play-with-docker/scheduler/task"
 	"github.com/play-with-docker/play-with-docker/storage"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
@@ -27,8 +29,11 @@ func main() {
 	df := initDockerFactory(s)
 	kf := initK8sFactory(s)
 
-	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(df, s), provisioner.NewDinD(id.XIDGenerator{}, df, s))
-	sp := provisioner.NewOverlaySessionProvisioner(df)
+	dind := provisioner.NewDinD(id.XIDGenerator{}, df, s)
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(df, s), dind)
+	hosts := initHostRegistry(df, s)
+	dind.WarmPoolHosts(hosts)
+	sp := provisioner.NewOverlaySessionProvisionerWithPlacement(df, initPlacement(hosts))
 
 	core := pwd.NewPWD(df, e, s, sp, ipf)
 
@@ -40,7 +45,11 @@ func main() {
 		task.NewCheckK8sClusterStatus(e, kf),
 		task.NewCheckK8sClusterExposedPorts(e, kf),
 	}
-	sch, err := scheduler.NewScheduler(tasks, s, e, core)
+	playgroundTasks := []scheduler.PlaygroundTask{
+		task.NewFillWarmPool(dind),
+		task.NewPullImages(df),
+	}
+	sch, err := scheduler.NewScheduler(tasks, playgroundTasks, s, e, core)
 	if err != nil {
 		log.Fatal("Error initializing the scheduler: ", err)
 	}
@@ -62,7 +71,16 @@ func main() {
 }
 
 func initStorage() storage.StorageApi {
-	s, err := storage.NewFileStorage(config.SessionsFile)
+	var s storage.StorageApi
+	var err error
+	switch config.StorageType {
+	case "file":
+		s, err = storage.NewFileStorage(config.SessionsFile)
+	case "sql":
+		s, err = storage.NewSQLStorage(config.StorageDriver, config.StorageDSN)
+	default:
+		log.Fatalf("Unknown storage type %s", config.StorageType)
+	}
 	if err != nil && !os.IsNotExist(err) {
 		log.Fatal("Error initializing StorageAPI: ", err)
 	}
@@ -70,7 +88,46 @@ func initStorage() storage.StorageApi {
 }
 
 func initEvent() event.EventApi {
-	return event.NewLocalBroker()
+	policy, err := event.ParseOverflowPolicy(config.EventOverflowPolicy)
+	if err != nil {
+		log.Fatal("Error initializing EventAPI: ", err)
+	}
+	opts := event.LocalBrokerOpts{BufferSize: config.EventBufferSize, Policy: policy}
+
+	switch config.EventTransport {
+	case "local":
+		return event.NewLocalBrokerWithOpts(opts)
+	case "redis":
+		redisOpts, err := event.ParseRedisURL(config.EventRedisAddr)
+		if err != nil {
+			log.Fatal("Error initializing EventAPI: ", err)
+		}
+		e, err := event.NewDistributedBroker(event.NewRedisTransport(redisOpts), config.EventSubject, opts)
+		if err != nil {
+			log.Fatal("Error initializing EventAPI: ", err)
+		}
+		return e
+	}
+	log.Fatalf("Unknown event transport %s", config.EventTransport)
+	return nil
+}
+
+func initHostRegistry(df docker.FactoryApi, s storage.StorageApi) *provisioner.HostRegistry {
+	hosts := []string{}
+	for _, h := range strings.Split(config.DockerHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return provisioner.NewHostRegistry(hosts, df, s)
+}
+
+func initPlacement(r *provisioner.HostRegistry) *provisioner.Placement {
+	strategy, err := provisioner.ParsePlacementStrategy(config.PlacementStrategy)
+	if err != nil {
+		log.Fatal("Error initializing placement: ", err)
+	}
+	return provisioner.NewPlacement(r, strategy, config.PlacementMaxSessions, int64(config.PlacementSessionMemory)*1024*1024)
 }
 
 func initDockerFactory(s storage.StorageApi) docker.FactoryApi {
@@ -0,0 +1,118 @@
+// Command pwd-storage exports PWD state from a storage backend into an
+// archive and imports archives into any storage backend.
+//
+//	pwd-storage export -storage file -save ./pwd/sessions -o pwd.json
+//	pwd-storage import -storage sql -storage-dsn ./pwd/sessions.db -i pwd.json -on-conflict skip -dry-run
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/play-with-docker/play-with-docker/storage/archive"
+	_ "modernc.org/sqlite"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s export|import [flags]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	storageType := fs.String("storage", "file", "Storage backend to use. One of: file, sql")
+	sessionsFile := fs.String("save", "./pwd/sessions", "Sessions file used by the file storage backend")
+	storageDriver := fs.String("storage-driver", "sqlite", "database/sql driver to use with the sql storage backend")
+	storageDSN := fs.String("storage-dsn", "./pwd/sessions.db", "Data source name to use with the sql storage backend")
+
+	switch os.Args[1] {
+	case "export":
+		out := fs.String("o", "-", "File to write the archive to. Defaults to stdout")
+		fs.Parse(os.Args[2:])
+
+		s := openStorage(*storageType, *sessionsFile, *storageDriver, *storageDSN, true)
+		a, err := archive.Export(s)
+		if err != nil {
+			log.Fatalf("Error exporting storage. Got: %v", err)
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "-" {
+			f, err := os.Create(*out)
+			if err != nil {
+				log.Fatalf("Error creating %s. Got: %v", *out, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := archive.Write(w, a); err != nil {
+			log.Fatalf("Error writing archive. Got: %v", err)
+		}
+	case "import":
+		in := fs.String("i", "-", "File to read the archive from. Defaults to stdin")
+		dryRun := fs.Bool("dry-run", false, "Report what would be imported without writing anything")
+		onConflict := fs.String("on-conflict", "fail", "What to do with objects that already exist. One of: fail, skip, overwrite")
+		fs.Parse(os.Args[2:])
+
+		policy, err := archive.ParseConflictPolicy(*onConflict)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var r io.Reader = os.Stdin
+		if *in != "-" {
+			f, err := os.Open(*in)
+			if err != nil {
+				log.Fatalf("Error opening %s. Got: %v", *in, err)
+			}
+			defer f.Close()
+			r = f
+		}
+		a, err := archive.Read(r)
+		if err != nil {
+			log.Fatalf("Error reading archive. Got: %v", err)
+		}
+
+		s := openStorage(*storageType, *sessionsFile, *storageDriver, *storageDSN, *dryRun)
+		report, err := archive.Import(s, a, archive.ImportOpts{DryRun: *dryRun, OnConflict: policy})
+		json.NewEncoder(os.Stdout).Encode(report)
+		if err != nil {
+			log.Fatalf("Error importing archive. Got: %v", err)
+		}
+	default:
+		usage()
+	}
+}
+
+// openStorage opens the backend read-only when nothing is going to be
+// written, so exporting from a running PWD or doing a dry run never changes
+// the store.
+func openStorage(storageType, sessionsFile, driver, dsn string, readOnly bool) storage.StorageApi {
+	var s storage.StorageApi
+	var err error
+	switch {
+	case storageType == "file" && readOnly:
+		s, err = storage.NewReadOnlyFileStorage(sessionsFile)
+	case storageType == "file":
+		s, err = storage.NewFileStorage(sessionsFile)
+	case storageType == "sql" && readOnly:
+		s, err = storage.NewReadOnlySQLStorage(driver, dsn)
+	case storageType == "sql":
+		s, err = storage.NewSQLStorage(driver, dsn)
+	default:
+		log.Fatalf("Unknown storage type %s", storageType)
+	}
+	if err != nil {
+		log.Fatalf("Error initializing storage. Got: %v", err)
+	}
+	return s
+}
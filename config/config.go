@@ -2,8 +2,12 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"net"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/gorilla/securecookie"
 
@@ -44,6 +48,138 @@ var PlaygroundDomain string
 
 var SegmentId string
 
+var StorageType, StorageDriver, StorageDSN string
+
+// ClientTTL is how long a client is kept around without hearing from its
+// websocket before it's considered gone. LoginRequestTTL is how long an
+// OAuth login can take before the request is discarded.
+var ClientTTL, LoginRequestTTL time.Duration
+
+var EventTransport, EventRedisAddr, EventSubject string
+
+var EventBufferSize int
+var EventOverflowPolicy string
+
+// EventHistorySize is how many events are kept per session to be replayed to
+// websockets that reconnect.
+var EventHistorySize int
+
+var WebhookMaxAttempts, WebhookLogSize int
+
+// SchedulerLeaseTTL is how long a replica that stopped renewing the scheduler
+// lease keeps it before another replica takes over.
+var SchedulerLeaseTTL time.Duration
+
+var SchedulerWorkers int
+
+// SessionIdleGrace is how long before an idle session is closed its clients
+// are warned about it.
+var SessionIdleGrace time.Duration
+
+// ActivityURL is where the L2 router reports the sessions it proxied
+// requests to.
+var ActivityURL string
+
+// DockerHosts is a comma separated list of the docker daemons sessions are
+// placed on. Empty means only the local one.
+var DockerHosts, PlacementStrategy string
+
+// PlacementMaxSessions is how many sessions a docker host takes at most, and
+// PlacementSessionMemory how many megabytes of memory each one of them is
+// expected to use. 0 means no limit.
+var PlacementMaxSessions, PlacementSessionMemory int
+
+// SessionExpiryWarnings are how long before a session expires its clients
+// are warned about it.
+var SessionExpiryWarnings = Durations{10 * time.Minute, 5 * time.Minute, time.Minute}
+
+// Durations is a flag holding a comma separated list of durations.
+type Durations []time.Duration
+
+func (d *Durations) String() string {
+	s := make([]string, len(*d))
+	for i, v := range *d {
+		s[i] = v.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func (d *Durations) Set(value string) error {
+	durations := Durations{}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		durations = append(durations, duration)
+	}
+	*d = durations
+	return nil
+}
+
+// TrustedProxies are the proxies whose X-Forwarded-For header is believed
+// when telling where a request comes from. Empty means requests are taken to
+// come straight from the client.
+var TrustedProxies Networks
+
+// Networks is a flag holding a comma separated list of IP addresses and CIDR
+// ranges.
+type Networks []*net.IPNet
+
+func (n *Networks) String() string {
+	s := make([]string, len(*n))
+	for i, v := range *n {
+		s[i] = v.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func (n *Networks) Set(value string) error {
+	networks := Networks{}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return fmt.Errorf("Invalid IP address %s", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return err
+		}
+		networks = append(networks, network)
+	}
+	*n = networks
+	return nil
+}
+
+// Contains tells whether ip is in any of the networks.
+func (n Networks) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // TODO move this to a sync map so it can be updated on demand when the configuration for a playground changes
 var Providers = map[string]map[string]*oauth2.Config{}
 
@@ -53,6 +189,29 @@ func ParseFlags() {
 	flag.BoolVar(&ForceTLS, "tls", false, "Use TLS to connect to docker daemons")
 	flag.StringVar(&PortNumber, "port", "3000", "Port number")
 	flag.StringVar(&SessionsFile, "save", "./pwd/sessions", "Tell where to store sessions file")
+	flag.StringVar(&StorageType, "storage", "file", "Storage backend to use. One of: file, sql")
+	flag.StringVar(&StorageDriver, "storage-driver", "sqlite", "database/sql driver to use with the sql storage backend")
+	flag.StringVar(&StorageDSN, "storage-dsn", "./pwd/sessions.db", "Data source name to use with the sql storage backend")
+	flag.DurationVar(&ClientTTL, "client-ttl", 5*time.Minute, "Time after which a client that stopped sending keep alives is removed. 0 disables expiry")
+	flag.DurationVar(&LoginRequestTTL, "login-request-ttl", 10*time.Minute, "Time after which an unfinished login request is removed. 0 disables expiry")
+	flag.StringVar(&EventTransport, "event-transport", "local", "How events reach other PWD replicas. One of: local, redis")
+	flag.StringVar(&EventRedisAddr, "event-redis-addr", "localhost:6379", "Address of the redis server used by the redis event transport. Either host:port or a URL like redis://:password@host:6379, rediss:// connects over TLS")
+	flag.StringVar(&EventSubject, "event-subject", "pwd.events", "Channel events are published on when using a distributed event transport")
+	flag.IntVar(&EventBufferSize, "event-buffer-size", 1024, "Number of events that can be queued for each event handler")
+	flag.StringVar(&EventOverflowPolicy, "event-overflow-policy", "block", "What to do when the queue of an event handler is full. One of: block, drop")
+	flag.IntVar(&EventHistorySize, "event-history-size", 500, "Number of events kept per session to replay to reconnecting clients")
+	flag.IntVar(&WebhookMaxAttempts, "webhook-max-attempts", 5, "Number of times delivering an event to a webhook is attempted")
+	flag.IntVar(&WebhookLogSize, "webhook-log-size", 1000, "Number of webhook deliveries kept in the delivery log")
+	flag.DurationVar(&SchedulerLeaseTTL, "scheduler-lease-ttl", 15*time.Second, "Time after which another replica takes over scheduling from one that stopped renewing its lease")
+	flag.Var(&SessionExpiryWarnings, "session-expiry-warnings", "Comma separated list of how long before a session expires its clients are warned. Empty disables warnings")
+	flag.Var(&TrustedProxies, "trusted-proxies", "Comma separated list of addresses or CIDR ranges of the proxies in front of PWD, whose X-Forwarded-For header is trusted to tell the address of the client. Empty ignores the header")
+	flag.DurationVar(&SessionIdleGrace, "session-idle-grace", 2*time.Minute, "How long before an idle session is closed its clients are warned")
+	flag.StringVar(&ActivityURL, "activity-url", "", "URL of the PWD endpoint the L2 router reports session activity to, like http://pwd:3000/sessions/activity. Empty disables reporting")
+	flag.StringVar(&DockerHosts, "docker-hosts", "", "Comma separated list of docker daemons to place sessions on, like tcp://10.0.0.2:2375. Each of them needs its own l2 router. Empty uses the local daemon only")
+	flag.StringVar(&PlacementStrategy, "placement-strategy", "least-sessions", "How the docker host of a new session is picked. One of: least-sessions, least-memory, bin-packing")
+	flag.IntVar(&PlacementMaxSessions, "placement-max-sessions", 0, "Maximum number of sessions on each docker host. 0 means no limit")
+	flag.IntVar(&PlacementSessionMemory, "placement-session-memory", 0, "Megabytes of memory each session is expected to use when deciding whether a docker host is full. 0 ignores memory")
+	flag.IntVar(&SchedulerWorkers, "scheduler-workers", 32, "Number of scheduler tasks that can run at the same time across all instances")
 	flag.StringVar(&PWDContainerName, "name", "pwd", "Container name used to run PWD (used to be able to connect it to the networks it creates)")
 	flag.StringVar(&L2ContainerName, "l2", "l2", "Container name used to run L2 Router")
 	flag.StringVar(&L2RouterIP, "l2-ip", "", "Host IP address for L2 router ping response")
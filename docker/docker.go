@@ -9,19 +9,19 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/containerd/containerd/reference"
+	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/play-with-docker/play-with-docker/config"
+	pwdtypes "github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
 const (
@@ -51,6 +51,10 @@ type DockerApi interface {
 	ContainerDelete(name string) error
 	ContainerCreate(opts CreateContainerOpts) error
 	ContainerIPs(id string) (map[string]string, error)
+	ContainerList(labels map[string]string) ([]string, error)
+	ContainerCommit(name, image string) error
+	ImagePull(image string) error
+	ImageRemove(image string) error
 	ExecAttach(instanceName string, command []string, out io.Writer) (int, error)
 	Exec(instanceName string, command []string) (int, error)
 
@@ -266,6 +270,7 @@ type CreateContainerOpts struct {
 	Networks       []string
 	DindVolumeSize string
 	Envs           []string
+	Resources      pwdtypes.ResourceLimits
 }
 
 func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
@@ -300,27 +305,28 @@ func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
 		LogConfig:   container.LogConfig{Config: map[string]string{"max-size": "10m", "max-file": "1"}},
 	}
 
-	if os.Getenv("APPARMOR_PROFILE") != "" {
-		h.SecurityOpt = []string{fmt.Sprintf("apparmor=%s", os.Getenv("APPARMOR_PROFILE"))}
+	if opts.Resources.AppArmorProfile != "" {
+		h.SecurityOpt = append(h.SecurityOpt, fmt.Sprintf("apparmor=%s", opts.Resources.AppArmorProfile))
+	}
+	if opts.Resources.SeccompProfile != "" {
+		h.SecurityOpt = append(h.SecurityOpt, fmt.Sprintf("seccomp=%s", opts.Resources.SeccompProfile))
 	}
 
-	if os.Getenv("STORAGE_SIZE") != "" {
-		// assing 10GB size FS for each container
-		h.StorageOpt = map[string]string{"size": os.Getenv("STORAGE_SIZE")}
+	if opts.Resources.StorageSize != "" {
+		h.StorageOpt = map[string]string{"size": opts.Resources.StorageSize}
 	}
 
 	var pidsLimit = int64(1000)
-	if envLimit := os.Getenv("MAX_PROCESSES"); envLimit != "" {
-		if i, err := strconv.Atoi(envLimit); err == nil {
-			pidsLimit = int64(i)
-		}
+	if opts.Resources.PidsLimit > 0 {
+		pidsLimit = opts.Resources.PidsLimit
 	}
 	h.Resources.PidsLimit = &pidsLimit
 
-	if memLimit := os.Getenv("MAX_MEMORY_MB"); memLimit != "" {
-		if i, err := strconv.Atoi(memLimit); err == nil {
-			h.Resources.Memory = int64(i) * Megabyte
-		}
+	if opts.Resources.MemoryMB > 0 {
+		h.Resources.Memory = opts.Resources.MemoryMB * Megabyte
+	}
+	if opts.Resources.CPUs > 0 {
+		h.Resources.NanoCPUs = int64(opts.Resources.CPUs * 1e9)
 	}
 
 	t := true
@@ -365,19 +371,15 @@ func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
 
 	container, err := d.c.ContainerCreate(context.Background(), cf, h, networkConf, opts.ContainerName)
 
+	if client.IsErrNotFound(err) {
+		log.Printf("Unable to find image '%s' locally\n", opts.Image)
+		if err = d.pullImage(context.Background(), opts.Image); err != nil {
+			return
+		}
+		container, err = d.c.ContainerCreate(context.Background(), cf, h, networkConf, opts.ContainerName)
+	}
 	if err != nil {
-		//if client.IsErrImageNotFound(err) {
-		//log.Printf("Unable to find image '%s' locally\n", opts.Image)
-		//if err = d.pullImage(context.Background(), opts.Image); err != nil {
-		//return "", err
-		//}
-		//container, err = d.c.ContainerCreate(context.Background(), cf, h, networkConf, opts.ContainerName)
-		//if err != nil {
-		//return "", err
-		//}
-		//} else {
-		return err
-		//}
+		return
 	}
 
 	//connect remaining networks if there are any
@@ -422,18 +424,62 @@ func (d *docker) ContainerIPs(id string) (map[string]string, error) {
 
 }
 
+// ContainerList returns the names of the containers having all the given
+// labels.
+func (d *docker) ContainerList(labels map[string]string) ([]string, error) {
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", fmt.Sprintf("%s=%s", k, v))
+	}
+	containers, err := d.c.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, c := range containers {
+		if len(c.Names) > 0 {
+			names = append(names, strings.TrimPrefix(c.Names[0], "/"))
+		}
+	}
+	return names, nil
+}
+
+// ContainerCommit saves the filesystem of the container, without its
+// volumes, as image.
+func (d *docker) ContainerCommit(name, image string) error {
+	_, err := d.c.ContainerCommit(context.Background(), name, types.ContainerCommitOptions{Reference: image, Pause: true})
+	return err
+}
+
+func (d *docker) ImagePull(image string) error {
+	return d.pullImage(context.Background(), image)
+}
+
+// ImageRemove deletes an image along with its untagged parents. Images that
+// are already gone aren't an error.
+func (d *docker) ImageRemove(image string) error {
+	_, err := d.c.ImageRemove(context.Background(), image, types.ImageRemoveOptions{PruneChildren: true})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
 func (d *docker) pullImage(ctx context.Context, image string) error {
-	_, err := reference.Parse(image)
+	ref, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return err
 	}
+	// Without a tag every tag of the image would be pulled
+	ref = reference.TagNameOnly(ref)
 
 	options := types.ImageCreateOptions{}
 
-	responseBody, err := d.c.ImageCreate(ctx, image, options)
+	responseBody, err := d.c.ImageCreate(ctx, ref.String(), options)
 	if err != nil {
 		return err
 	}
+	defer responseBody.Close()
 	_, err = io.Copy(ioutil.Discard, responseBody)
 
 	return err
@@ -541,6 +587,19 @@ func (d *docker) SwarmJoin(addr, token string) error {
 	return d.c.SwarmJoin(context.Background(), req)
 }
 
+// SwarmRole tells whether the daemon behind d is a manager or a worker of a
+// swarm. It's neither when it isn't part of one.
+func SwarmRole(d DockerApi) (isManager, isWorker bool, err error) {
+	info, err := d.DaemonInfo()
+	if err != nil {
+		return false, false, err
+	}
+	if info.Swarm.LocalNodeState != swarm.LocalNodeStateInactive && info.Swarm.LocalNodeState != swarm.LocalNodeStateLocked {
+		return info.Swarm.ControlAvailable, !info.Swarm.ControlAvailable, nil
+	}
+	return false, false, nil
+}
+
 func NewDocker(c *client.Client) *docker {
 	return &docker{c: c}
 }
@@ -17,6 +17,7 @@ import (
 
 type FactoryApi interface {
 	GetForSession(session *types.Session) (DockerApi, error)
+	GetForHost(host string) (DockerApi, error)
 	GetForInstance(instance *types.Instance) (DockerApi, error)
 }
 
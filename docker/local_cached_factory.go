@@ -15,7 +15,7 @@ import (
 type localCachedFactory struct {
 	rw              sync.Mutex
 	irw             sync.Mutex
-	sessionClient   DockerApi
+	hostClients     map[string]DockerApi
 	instanceClients map[string]*instanceEntry
 	storage         storage.StorageApi
 }
@@ -26,18 +26,29 @@ type instanceEntry struct {
 }
 
 func (f *localCachedFactory) GetForSession(session *types.Session) (DockerApi, error) {
+	return f.GetForHost(session.DockerHost)
+}
+
+// GetForHost returns a client of the docker daemon at host, like
+// tcp://10.0.0.2:2375. An empty host is the local daemon.
+func (f *localCachedFactory) GetForHost(host string) (DockerApi, error) {
 	f.rw.Lock()
 	defer f.rw.Unlock()
 
-	if f.sessionClient != nil {
-		if err := f.check(f.sessionClient.GetClient()); err == nil {
-			return f.sessionClient, nil
+	if c, found := f.hostClients[host]; found {
+		if err := f.check(c.GetClient()); err == nil {
+			return c, nil
 		} else {
-			f.sessionClient.GetClient().Close()
+			c.GetClient().Close()
+			delete(f.hostClients, host)
 		}
 	}
 
-	c, err := client.NewClientWithOpts()
+	opts := []client.Opt{}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	c, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -46,8 +57,8 @@ func (f *localCachedFactory) GetForSession(session *types.Session) (DockerApi, e
 		return nil, err
 	}
 	d := NewDocker(c)
-	f.sessionClient = d
-	return f.sessionClient, nil
+	f.hostClients[host] = d
+	return d, nil
 }
 
 func (f *localCachedFactory) GetForInstance(instance *types.Instance) (DockerApi, error) {
@@ -107,6 +118,7 @@ func (f *localCachedFactory) check(c *client.Client) error {
 
 func NewLocalCachedFactory(s storage.StorageApi) *localCachedFactory {
 	return &localCachedFactory{
+		hostClients:     make(map[string]DockerApi),
 		instanceClients: make(map[string]*instanceEntry),
 		storage:         s,
 	}
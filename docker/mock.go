@@ -91,6 +91,26 @@ func (m *Mock) ContainerIPs(id string) (map[string]string, error) {
 	return args.Get(0).(map[string]string), args.Error(1)
 }
 
+func (m *Mock) ContainerList(labels map[string]string) ([]string, error) {
+	args := m.Called(labels)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *Mock) ContainerCommit(name, image string) error {
+	args := m.Called(name, image)
+	return args.Error(0)
+}
+
+func (m *Mock) ImagePull(image string) error {
+	args := m.Called(image)
+	return args.Error(0)
+}
+
+func (m *Mock) ImageRemove(image string) error {
+	args := m.Called(image)
+	return args.Error(0)
+}
+
 func (m *Mock) ExecAttach(instanceName string, command []string, out io.Writer) (int, error) {
 	args := m.Called(instanceName, command, out)
 	return args.Int(0), args.Error(1)
@@ -0,0 +1,67 @@
+package event
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/satori/go.uuid"
+)
+
+// wireEvent is how events travel over a Transport. Args are encoded the same
+// way they are sent to websocket clients, so a handler on a remote replica
+// gets them back as the generic JSON types (string, float64, map, ...).
+type wireEvent struct {
+	Origin string        `json:"origin"`
+	Type   EventType     `json:"type"`
+	Id     string        `json:"id"`
+	Args   []interface{} `json:"args"`
+}
+
+// distributedBroker delivers events to local handlers right away, exactly
+// like the local broker, and also publishes them on a transport so the
+// handlers of every other replica get them as well.
+type distributedBroker struct {
+	*localBroker
+
+	transport Transport
+	subject   string
+	origin    string
+}
+
+func NewDistributedBroker(t Transport, subject string, opts LocalBrokerOpts) (*distributedBroker, error) {
+	b := &distributedBroker{localBroker: NewLocalBrokerWithOpts(opts), transport: t, subject: subject, origin: uuid.NewV4().String()}
+	if err := t.Subscribe(subject, b.receive); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *distributedBroker) Emit(name EventType, id string, args ...interface{}) {
+	b.localBroker.Emit(name, id, args...)
+
+	data, err := json.Marshal(wireEvent{Origin: b.origin, Type: name, Id: id, Args: args})
+	if err != nil {
+		log.Printf("Cannot encode event [%s] for [%s]. Got: %v\n", name, id, err)
+		return
+	}
+	if err := b.transport.Publish(b.subject, data); err != nil {
+		log.Printf("Cannot publish event [%s] for [%s]. Got: %v\n", name, id, err)
+	}
+}
+
+func (b *distributedBroker) receive(data []byte) {
+	var e wireEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Cannot decode event received from transport. Got: %v\n", err)
+		return
+	}
+	if e.Origin == b.origin {
+		// Already delivered locally when it was emitted
+		return
+	}
+	b.localBroker.emit(queuedEvent{name: e.Type, id: e.Id, args: e.Args, remote: true})
+}
+
+func (b *distributedBroker) Close() error {
+	return b.transport.Close()
+}
@@ -0,0 +1,67 @@
+package event
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistributedBroker_DeliversToOtherReplicas(t *testing.T) {
+	transport := NewMemoryTransport()
+	a, err := NewDistributedBroker(transport, "pwd.events", LocalBrokerOpts{})
+	assert.Nil(t, err)
+	b, err := NewDistributedBroker(transport, "pwd.events", LocalBrokerOpts{})
+	assert.Nil(t, err)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	var localArgs, remoteArgs []interface{}
+	a.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		localArgs = args
+		wg.Done()
+	})
+	b.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		assert.Equal(t, "aaaabbbbcccc", sessionId)
+		remoteArgs = args
+		wg.Done()
+	})
+	a.Emit(INSTANCE_STATS, "aaaabbbbcccc", "node1", 12.5, uint(3))
+
+	wg.Wait()
+
+	assert.Equal(t, []interface{}{"node1", 12.5, uint(3)}, localArgs)
+	// Remote handlers get args as they come out of JSON
+	assert.Equal(t, []interface{}{"node1", 12.5, float64(3)}, remoteArgs)
+}
+
+func TestDistributedBroker_DeliversLocallyOnce(t *testing.T) {
+	transport := NewMemoryTransport()
+	broker, err := NewDistributedBroker(transport, "pwd.events", LocalBrokerOpts{})
+	assert.Nil(t, err)
+
+	mx := sync.Mutex{}
+	called := 0
+	broker.OnAny(func(eventType EventType, sessionId string, args ...interface{}) {
+		mx.Lock()
+		defer mx.Unlock()
+		called++
+	})
+	broker.Emit(SESSION_READY, "1")
+
+	time.Sleep(50 * time.Millisecond)
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, 1, called)
+}
+
+func TestDistributedBroker_TransportClosed(t *testing.T) {
+	transport := NewMemoryTransport()
+	transport.Close()
+
+	_, err := NewDistributedBroker(transport, "pwd.events", LocalBrokerOpts{})
+	assert.Equal(t, ErrTransportClosed, err)
+}
@@ -15,14 +15,37 @@ var (
 	SESSION_END              = EventType("session end")
 	SESSION_READY            = EventType("session ready")
 	SESSION_BUILDER_OUT      = EventType("session builder out")
+	SESSION_SETUP_PROGRESS   = EventType("session setup progress")
 	PLAYGROUND_NEW           = EventType("playground_new")
+
+	INSTANCE_DOCKER_PORTS        = EventType("instance docker ports")
+	INSTANCE_DOCKER_SWARM_PORTS  = EventType("instance docker swarm ports")
+	INSTANCE_DOCKER_SWARM_STATUS = EventType("instance docker swarm status")
+	INSTANCE_K8S_STATUS          = EventType("instance k8s status")
+	INSTANCE_K8S_CLUSTER_PORTS   = EventType("instance k8s cluster ports")
+	INSTANCE_UNHEALTHY           = EventType("instance unhealthy")
+	SESSION_EXPIRING             = EventType("session expiring")
+	SESSION_EXTENDED             = EventType("session extended")
+	SESSION_IDLE                 = EventType("session idle")
 )
 
 type Handler func(id string, args ...interface{})
 type AnyHandler func(eventType EventType, id string, args ...interface{})
 
+// EventApi delivers every event to each handler in the order it was
+// emitted. There's no ordering between different handlers.
 type EventApi interface {
 	Emit(name EventType, id string, args ...interface{})
 	On(name EventType, handler Handler)
 	OnAny(handler AnyHandler)
 }
+
+// OriginHandler is like AnyHandler, local tells whether the event was emitted
+// by the current replica or received from another one.
+type OriginHandler func(local bool, eventType EventType, id string, args ...interface{})
+
+// OriginApi is implemented by the brokers, for handlers whose side effects
+// must happen once across all replicas.
+type OriginApi interface {
+	OnAnyWithOrigin(handler OriginHandler)
+}
@@ -0,0 +1,241 @@
+package event
+
+import (
+	"log"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/satori/go.uuid"
+)
+
+// subscriberBacklog is how many events a subscriber can fall behind before
+// its oldest undelivered events are dropped.
+const subscriberBacklog = 1000
+
+// endedSessions is how many ended sessions are remembered so late events or
+// subscriptions don't bring their history back.
+const endedSessions = 10000
+
+// transientEvents are sent over and over and only their last value matters,
+// so they're delivered live but not kept for replays. Otherwise they'd push
+// everything else out of the history.
+var transientEvents = map[EventType]bool{
+	INSTANCE_STATS: true,
+}
+
+// Record is an event kept in the history of a session. Seq starts at 1 and
+// grows by one with every event of the session.
+type Record struct {
+	Seq  uint64
+	Type EventType
+	Args []interface{}
+}
+
+type sessionHistory struct {
+	// records is a ring buffer, first is the index of the oldest record
+	records []Record
+	first   int
+	seq     uint64
+	subs    map[int]*historySub
+}
+
+func (h *sessionHistory) add(r Record, size int) {
+	if len(h.records) < size {
+		h.records = append(h.records, r)
+		return
+	}
+	h.records[h.first] = r
+	h.first = (h.first + 1) % size
+}
+
+func (h *sessionHistory) since(seq uint64) []Record {
+	records := []Record{}
+	for i := 0; i < len(h.records); i++ {
+		r := h.records[(h.first+i)%len(h.records)]
+		if r.Seq > seq {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// historySub queues the events of one subscriber, which get delivered by its
+// own goroutine so a slow subscriber only holds back itself. Its fields are
+// guarded by the mutex of the History.
+type historySub struct {
+	handler func(Record)
+	pending []Record
+	dropped int
+	notify  chan struct{}
+	// closed is set on unsubscribe and ended once SESSION_END is queued.
+	closed bool
+	ended  bool
+}
+
+func (s *historySub) push(r Record) {
+	if len(s.pending) >= subscriberBacklog {
+		s.pending = s.pending[1:]
+		s.dropped++
+	}
+	s.pending = append(s.pending, r)
+	s.wake()
+}
+
+func (s *historySub) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// History keeps the last events emitted for every session so clients that
+// reconnect can catch up with what they missed. A session's history is
+// dropped once SESSION_END has been handed to its subscribers.
+//
+// Sequence numbers are only meaningful to the History that assigned them, as
+// every replica sees the events of a session in its own order. Epoch
+// identifies the History, replays asked for with another epoch must not be
+// trusted.
+type History struct {
+	mx       sync.Mutex
+	size     int
+	sessions map[string]*sessionHistory
+	ended    *lru.Cache
+	nextSub  int
+	epoch    string
+}
+
+func NewHistory(e EventApi, size int) *History {
+	ended, _ := lru.New(endedSessions)
+	h := &History{size: size, sessions: map[string]*sessionHistory{}, ended: ended, epoch: uuid.NewV4().String()}
+	e.OnAny(h.record)
+	return h
+}
+
+func (h *History) Epoch() string {
+	return h.epoch
+}
+
+func (h *History) session(sessionId string) *sessionHistory {
+	sh, found := h.sessions[sessionId]
+	if !found {
+		sh = &sessionHistory{subs: map[int]*historySub{}}
+		h.sessions[sessionId] = sh
+	}
+	return sh
+}
+
+func (h *History) record(name EventType, sessionId string, args ...interface{}) {
+	if name == PLAYGROUND_NEW {
+		// Not a session event
+		return
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.ended.Contains(sessionId) {
+		return
+	}
+	sh := h.session(sessionId)
+	sh.seq++
+	r := Record{Seq: sh.seq, Type: name, Args: args}
+	if h.size > 0 && !transientEvents[name] {
+		sh.add(r, h.size)
+	}
+	for _, s := range sh.subs {
+		s.push(r)
+	}
+	if name == SESSION_END {
+		for _, s := range sh.subs {
+			s.ended = true
+		}
+		delete(h.sessions, sessionId)
+		h.ended.Add(sessionId, struct{}{})
+	}
+}
+
+// deliver hands the queued events of s to its handler, without holding the
+// lock, until s is unsubscribed or its session ends.
+func (h *History) deliver(sessionId string, s *historySub) {
+	for range s.notify {
+		h.mx.Lock()
+		records, dropped, closed, ended := s.pending, s.dropped, s.closed, s.ended
+		s.pending, s.dropped = nil, 0
+		h.mx.Unlock()
+
+		if closed {
+			return
+		}
+		if dropped > 0 {
+			log.Printf("Dropped %d events of session [%s] for a subscriber that fell behind\n", dropped, sessionId)
+		}
+		for _, r := range records {
+			s.handler(r)
+		}
+		if ended {
+			return
+		}
+	}
+}
+
+// Since returns the events of a session with a sequence number greater than
+// seq that are still in the history.
+func (h *History) Since(sessionId string, seq uint64) []Record {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	sh, found := h.sessions[sessionId]
+	if !found {
+		return []Record{}
+	}
+	return sh.since(seq)
+}
+
+// Subscribe calls handler with every new event of a session until the
+// returned function is called. Handlers are called from their own goroutine,
+// one event at a time.
+func (h *History) Subscribe(sessionId string, handler func(Record)) func() {
+	return h.subscribe(sessionId, nil, handler)
+}
+
+// SubscribeSince is like Subscribe, but first replays the events with a
+// sequence number greater than seq. No event is lost or delivered twice
+// between the replay and the live ones.
+func (h *History) SubscribeSince(sessionId string, seq uint64, handler func(Record)) func() {
+	return h.subscribe(sessionId, &seq, handler)
+}
+
+func (h *History) subscribe(sessionId string, seq *uint64, handler func(Record)) func() {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.ended.Contains(sessionId) {
+		return func() {}
+	}
+	sh := h.session(sessionId)
+	s := &historySub{handler: handler, notify: make(chan struct{}, 1)}
+	if seq != nil {
+		s.pending = sh.since(*seq)
+		s.wake()
+	}
+	id := h.nextSub
+	h.nextSub++
+	sh.subs[id] = s
+	go h.deliver(sessionId, s)
+
+	return func() {
+		h.mx.Lock()
+		defer h.mx.Unlock()
+
+		s.closed = true
+		s.wake()
+		if sh, found := h.sessions[sessionId]; found {
+			delete(sh.subs, id)
+			// Don't keep the history of sessions nothing happened in
+			if len(sh.subs) == 0 && len(sh.records) == 0 {
+				delete(h.sessions, sessionId)
+			}
+		}
+	}
+}
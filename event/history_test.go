@@ -0,0 +1,163 @@
+package event
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect returns a handler sending records to a channel, and a function
+// waiting for n of them.
+func collect() (func(Record), func(t *testing.T, n int) []Record) {
+	ch := make(chan Record, 100)
+	return func(r Record) {
+			ch <- r
+		}, func(t *testing.T, n int) []Record {
+			records := []Record{}
+			for len(records) < n {
+				select {
+				case r := <-ch:
+					records = append(records, r)
+				case <-time.After(time.Second):
+					t.Fatalf("Got %d records, expected %d", len(records), n)
+				}
+			}
+			select {
+			case r := <-ch:
+				t.Fatalf("Unexpected record %v", r)
+			case <-time.After(10 * time.Millisecond):
+			}
+			return records
+		}
+}
+
+func TestHistory_Since(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 3)
+
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 1")
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 2")
+	h.record(SESSION_BUILDER_OUT, "ddddeeeeffff", "other")
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 3")
+	h.record(SESSION_READY, "aaaabbbbcccc", true)
+
+	// line 1 fell out of the buffer
+	assert.Equal(t, []Record{
+		{Seq: 2, Type: SESSION_BUILDER_OUT, Args: []interface{}{"line 2"}},
+		{Seq: 3, Type: SESSION_BUILDER_OUT, Args: []interface{}{"line 3"}},
+		{Seq: 4, Type: SESSION_READY, Args: []interface{}{true}},
+	}, h.Since("aaaabbbbcccc", 0))
+	assert.Equal(t, []Record{
+		{Seq: 4, Type: SESSION_READY, Args: []interface{}{true}},
+	}, h.Since("aaaabbbbcccc", 3))
+	assert.Equal(t, []Record{
+		{Seq: 1, Type: SESSION_BUILDER_OUT, Args: []interface{}{"other"}},
+	}, h.Since("ddddeeeeffff", 0))
+	assert.Equal(t, []Record{}, h.Since("unknown", 0))
+}
+
+func TestHistory_SubscribeSince(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 10)
+
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 1")
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 2")
+
+	handler, wait := collect()
+	unsubscribe := h.SubscribeSince("aaaabbbbcccc", 1, handler)
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 3")
+	received := wait(t, 2)
+	unsubscribe()
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 4")
+
+	assert.Equal(t, uint64(2), received[0].Seq)
+	assert.Equal(t, uint64(3), received[1].Seq)
+	wait(t, 0)
+}
+
+func TestHistory_SessionEnd(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 10)
+
+	handler, wait := collect()
+	h.Subscribe("aaaabbbbcccc", handler)
+	h.record(SESSION_READY, "aaaabbbbcccc", true)
+	h.record(SESSION_END, "aaaabbbbcccc")
+
+	received := wait(t, 2)
+	assert.Equal(t, SESSION_READY, received[0].Type)
+	assert.Equal(t, SESSION_END, received[1].Type)
+	assert.Equal(t, []Record{}, h.Since("aaaabbbbcccc", 0))
+
+	// Ended sessions don't get a history back
+	h.record(INSTANCE_DELETE, "aaaabbbbcccc", "node1")
+	h.Subscribe("aaaabbbbcccc", handler)
+	assert.Empty(t, h.sessions)
+	wait(t, 0)
+}
+
+func TestHistory_SlowSubscriber(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 10)
+
+	block := make(chan struct{})
+	h.Subscribe("aaaabbbbcccc", func(r Record) {
+		<-block
+	})
+	handler, wait := collect()
+	h.Subscribe("ddddeeeeffff", handler)
+
+	// Neither recording nor other subscribers wait for the blocked one
+	h.record(SESSION_READY, "aaaabbbbcccc", true)
+	h.record(SESSION_READY, "aaaabbbbcccc", true)
+	h.record(SESSION_READY, "ddddeeeeffff", true)
+	assert.Len(t, wait(t, 1), 1)
+	assert.Len(t, h.Since("aaaabbbbcccc", 0), 2)
+	close(block)
+}
+
+func TestHistory_UnsubscribeQuietSession(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 10)
+
+	unsubscribe := h.Subscribe("aaaabbbbcccc", func(r Record) {})
+	assert.Len(t, h.sessions, 1)
+	unsubscribe()
+	assert.Empty(t, h.sessions)
+}
+
+func TestHistory_RecordsEmittedEvents(t *testing.T) {
+	broker := NewLocalBroker()
+	h := NewHistory(broker, 10)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	h.Subscribe("aaaabbbbcccc", func(r Record) {
+		wg.Done()
+	})
+	broker.Emit(INSTANCE_DELETE, "aaaabbbbcccc", "node1")
+
+	wg.Wait()
+
+	assert.Equal(t, []Record{{Seq: 1, Type: INSTANCE_DELETE, Args: []interface{}{"node1"}}}, h.Since("aaaabbbbcccc", 0))
+}
+
+func TestHistory_TransientEvents(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 3)
+
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 1")
+	for i := 0; i < 10; i++ {
+		h.record(INSTANCE_STATS, "aaaabbbbcccc", "stats")
+	}
+	h.record(SESSION_BUILDER_OUT, "aaaabbbbcccc", "line 2")
+
+	// Stats don't push the builder output out of the history
+	assert.Equal(t, []Record{
+		{Seq: 1, Type: SESSION_BUILDER_OUT, Args: []interface{}{"line 1"}},
+		{Seq: 12, Type: SESSION_BUILDER_OUT, Args: []interface{}{"line 2"}},
+	}, h.Since("aaaabbbbcccc", 0))
+
+	// but still reach subscribers
+	handler, wait := collect()
+	unsubscribe := h.Subscribe("aaaabbbbcccc", handler)
+	defer unsubscribe()
+	h.record(INSTANCE_STATS, "aaaabbbbcccc", "stats")
+	assert.Equal(t, []Record{{Seq: 13, Type: INSTANCE_STATS, Args: []interface{}{"stats"}}}, wait(t, 1))
+}
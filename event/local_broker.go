@@ -1,47 +1,178 @@
 package event
 
-import "sync"
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OverflowPolicy decides what Emit does when the queue of a subscriber is
+// full.
+type OverflowPolicy string
+
+const (
+	// Block waits until the subscriber makes room. Handlers must not emit
+	// events they subscribe to themselves, as they would deadlock once their
+	// queue is full.
+	Block = OverflowPolicy("block")
+	// Drop discards the event for that subscriber.
+	Drop = OverflowPolicy("drop")
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case Block, Drop:
+		return p, nil
+	}
+	return "", fmt.Errorf("Unknown overflow policy %s", s)
+}
+
+const DefaultBufferSize = 1024
+
+type LocalBrokerOpts struct {
+	// BufferSize is how many events can be waiting for each subscriber.
+	BufferSize int
+	Policy     OverflowPolicy
+}
+
+var (
+	queueDepthGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "event_queue_depth",
+		Help: "Events waiting to be handled, by subscribed event",
+	}, []string{"subscription"})
+	droppedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_dropped_total",
+		Help: "Events dropped because a subscriber queue was full, by subscribed event",
+	}, []string{"subscription"})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepthGauge)
+	prometheus.MustRegister(droppedCounter)
+}
+
+type queuedEvent struct {
+	name EventType
+	id   string
+	args []interface{}
+	// remote is set on events received from other replicas.
+	remote bool
+}
+
+// subscriber handles its events one at a time in a goroutine of its own, so
+// every handler sees events in the order they were emitted (which includes
+// all the events of a session) and a slow handler only delays itself.
+type subscriber struct {
+	subscription string
+	queue        chan queuedEvent
+	handle       func(e queuedEvent)
+}
+
+func (s *subscriber) run() {
+	for e := range s.queue {
+		queueDepthGauge.WithLabelValues(s.subscription).Dec()
+		s.safeHandle(e)
+	}
+}
+
+func (s *subscriber) safeHandle(e queuedEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic handling event [%s] for [%s]: %v\n", e.name, e.id, r)
+		}
+	}()
+	s.handle(e)
+}
 
 type localBroker struct {
 	sync.Mutex
 
-	handlers    map[EventType][]Handler
-	anyHandlers []AnyHandler
+	opts        LocalBrokerOpts
+	subscribers map[EventType][]*subscriber
+	any         []*subscriber
 }
 
 func NewLocalBroker() *localBroker {
-	return &localBroker{handlers: map[EventType][]Handler{}, anyHandlers: []AnyHandler{}}
+	return NewLocalBrokerWithOpts(LocalBrokerOpts{BufferSize: DefaultBufferSize, Policy: Block})
+}
+
+func NewLocalBrokerWithOpts(opts LocalBrokerOpts) *localBroker {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.Policy == "" {
+		opts.Policy = Block
+	}
+	return &localBroker{opts: opts, subscribers: map[EventType][]*subscriber{}, any: []*subscriber{}}
+}
+
+func (b *localBroker) subscribe(subscription string, handle func(e queuedEvent)) *subscriber {
+	s := &subscriber{subscription: subscription, queue: make(chan queuedEvent, b.opts.BufferSize), handle: handle}
+	go s.run()
+	return s
 }
 
 func (b *localBroker) On(name EventType, handler Handler) {
+	s := b.subscribe(name.String(), func(e queuedEvent) {
+		handler(e.id, e.args...)
+	})
+
 	b.Lock()
 	defer b.Unlock()
 
-	if b.handlers[name] == nil {
-		b.handlers[name] = []Handler{}
-	}
-	b.handlers[name] = append(b.handlers[name], handler)
+	b.subscribers[name] = append(b.subscribers[name], s)
 }
 
 func (b *localBroker) OnAny(handler AnyHandler) {
+	s := b.subscribe("any", func(e queuedEvent) {
+		handler(e.name, e.id, e.args...)
+	})
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.any = append(b.any, s)
+}
+
+func (b *localBroker) OnAnyWithOrigin(handler OriginHandler) {
+	s := b.subscribe("any", func(e queuedEvent) {
+		handler(!e.remote, e.name, e.id, e.args...)
+	})
+
 	b.Lock()
 	defer b.Unlock()
 
-	b.anyHandlers = append(b.anyHandlers, handler)
+	b.any = append(b.any, s)
 }
 
 func (b *localBroker) Emit(name EventType, sessionId string, args ...interface{}) {
-	go func() {
-		b.Lock()
-		defer b.Unlock()
+	b.emit(queuedEvent{name: name, id: sessionId, args: args})
+}
 
-		for _, handler := range b.anyHandlers {
-			handler(name, sessionId, args...)
-		}
-		if b.handlers[name] != nil {
-			for _, handler := range b.handlers[name] {
-				handler(sessionId, args...)
+func (b *localBroker) emit(e queuedEvent) {
+	name, sessionId := e.name, e.id
+	b.Lock()
+	subscribers := make([]*subscriber, 0, len(b.any)+len(b.subscribers[name]))
+	subscribers = append(subscribers, b.any...)
+	subscribers = append(subscribers, b.subscribers[name]...)
+	b.Unlock()
+
+	for _, s := range subscribers {
+		switch b.opts.Policy {
+		case Drop:
+			queueDepthGauge.WithLabelValues(s.subscription).Inc()
+			select {
+			case s.queue <- e:
+			default:
+				queueDepthGauge.WithLabelValues(s.subscription).Dec()
+				droppedCounter.WithLabelValues(s.subscription).Inc()
+				log.Printf("Dropped event [%s] for [%s], the %s subscriber queue is full\n", name, sessionId, s.subscription)
 			}
+		default:
+			queueDepthGauge.WithLabelValues(s.subscription).Inc()
+			s.queue <- e
 		}
-	}()
+	}
 }
@@ -1,9 +1,12 @@
 package event
 
 import (
+	"fmt"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,3 +61,104 @@ func TestLocalBroker_OnAny(t *testing.T) {
 	assert.Equal(t, "1", receivedSessionId)
 	assert.Equal(t, expectedArgs, receivedArgs)
 }
+
+func TestLocalBroker_Ordered(t *testing.T) {
+	broker := NewLocalBroker()
+
+	wg := sync.WaitGroup{}
+	wg.Add(100)
+
+	received := []string{}
+	broker.OnAny(func(eventType EventType, sessionId string, args ...interface{}) {
+		received = append(received, args[0].(string))
+		wg.Done()
+	})
+	expected := []string{}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("node%d", i)
+		expected = append(expected, name, name)
+		broker.Emit(INSTANCE_NEW, "aaaabbbbcccc", name)
+		broker.Emit(INSTANCE_DELETE, "aaaabbbbcccc", name)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, expected, received)
+}
+
+func TestLocalBroker_Drop(t *testing.T) {
+	broker := NewLocalBrokerWithOpts(LocalBrokerOpts{BufferSize: 1, Policy: Drop})
+
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+	broker.On(SESSION_BUILDER_OUT, func(sessionId string, args ...interface{}) {
+		<-release
+		handled <- args[0].(string)
+	})
+
+	dropped := testutil.ToFloat64(droppedCounter.WithLabelValues(SESSION_BUILDER_OUT.String()))
+
+	// The first one is picked by the handler, which blocks, the second one
+	// waits in the queue and the third one doesn't fit.
+	broker.Emit(SESSION_BUILDER_OUT, "aaaabbbbcccc", "1")
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(queueDepthGauge.WithLabelValues(SESSION_BUILDER_OUT.String())) == 0
+	}, time.Second, time.Millisecond)
+	broker.Emit(SESSION_BUILDER_OUT, "aaaabbbbcccc", "2")
+	broker.Emit(SESSION_BUILDER_OUT, "aaaabbbbcccc", "3")
+
+	assert.Equal(t, dropped+1, testutil.ToFloat64(droppedCounter.WithLabelValues(SESSION_BUILDER_OUT.String())))
+	assert.Equal(t, float64(1), testutil.ToFloat64(queueDepthGauge.WithLabelValues(SESSION_BUILDER_OUT.String())))
+
+	close(release)
+	assert.Equal(t, "1", <-handled)
+	assert.Equal(t, "2", <-handled)
+	select {
+	case out := <-handled:
+		t.Fatalf("Unexpected event %s", out)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLocalBroker_Block(t *testing.T) {
+	broker := NewLocalBrokerWithOpts(LocalBrokerOpts{BufferSize: 1, Policy: Block})
+
+	release := make(chan struct{})
+	broker.On(SESSION_BUILDER_OUT, func(sessionId string, args ...interface{}) {
+		<-release
+	})
+
+	emitted := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			broker.Emit(SESSION_BUILDER_OUT, "aaaabbbbcccc", "out")
+		}
+		close(emitted)
+	}()
+
+	select {
+	case <-emitted:
+		t.Fatal("Emit didn't block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-emitted
+}
+
+func TestLocalBroker_RecoversFromPanic(t *testing.T) {
+	broker := NewLocalBroker()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	broker.On(INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
+		if len(args) == 0 {
+			panic("no args")
+		}
+		wg.Done()
+	})
+	broker.Emit(INSTANCE_DELETE, "aaaabbbbcccc")
+	broker.Emit(INSTANCE_DELETE, "aaaabbbbcccc", "node1")
+
+	wg.Wait()
+}
@@ -0,0 +1,330 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// Payload is the typed form of the args of an event. Args returns them the
+// way they have always been emitted, which is also what websocket clients
+// receive.
+type Payload interface {
+	Args() []interface{}
+}
+
+// argsDecoder is implemented by pointers to payloads. FromArgs must accept
+// both the values passed to Emit and the generic ones produced by decoding
+// them from JSON, as that's what handlers see when events come from another
+// process.
+type argsDecoder interface {
+	Payload
+	FromArgs(args []interface{}) error
+}
+
+type InstanceNewPayload struct {
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	Hostname  string `json:"hostname"`
+	ProxyHost string `json:"proxy_host"`
+}
+
+func (p InstanceNewPayload) Args() []interface{} {
+	return []interface{}{p.Name, p.IP, p.Hostname, p.ProxyHost}
+}
+func (p *InstanceNewPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, &p.Name, &p.IP, &p.Hostname, &p.ProxyHost)
+}
+
+type InstanceDeletePayload struct {
+	Name string `json:"name"`
+}
+
+func (p InstanceDeletePayload) Args() []interface{} {
+	return []interface{}{p.Name}
+}
+func (p *InstanceDeletePayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, &p.Name)
+}
+
+type InstanceViewportResizePayload struct {
+	Cols uint `json:"cols"`
+	Rows uint `json:"rows"`
+}
+
+func (p InstanceViewportResizePayload) Args() []interface{} {
+	return []interface{}{p.Cols, p.Rows}
+}
+func (p *InstanceViewportResizePayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, &p.Cols, &p.Rows)
+}
+
+type InstanceStatsPayload struct {
+	Instance string `json:"instance"`
+	Mem      string `json:"mem"`
+	Cpu      string `json:"cpu"`
+}
+
+func (p InstanceStatsPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *InstanceStatsPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+type DockerPortsPayload struct {
+	Instance string `json:"instance"`
+	Ports    []int  `json:"ports"`
+}
+
+func (p DockerPortsPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *DockerPortsPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+type ClusterPortsPayload struct {
+	Manager   string   `json:"manager"`
+	Instances []string `json:"instances"`
+	Ports     []int    `json:"ports"`
+}
+
+func (p ClusterPortsPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *ClusterPortsPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+type ClusterStatusPayload struct {
+	IsManager bool   `json:"is_manager"`
+	IsWorker  bool   `json:"is_worker"`
+	Instance  string `json:"instance"`
+	// Ready is only reported for k8s nodes.
+	Ready bool `json:"ready,omitempty"`
+}
+
+func (p ClusterStatusPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *ClusterStatusPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+type InstanceUnhealthyPayload struct {
+	Instance string `json:"instance"`
+	Fails    int    `json:"fails"`
+	Error    string `json:"error"`
+}
+
+func (p InstanceUnhealthyPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *InstanceUnhealthyPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+type SessionReadyPayload struct {
+	Ready bool `json:"ready"`
+}
+
+func (p SessionReadyPayload) Args() []interface{} {
+	return []interface{}{p.Ready}
+}
+func (p *SessionReadyPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, &p.Ready)
+}
+
+type SessionBuilderOutPayload struct {
+	Output string `json:"output"`
+}
+
+func (p SessionBuilderOutPayload) Args() []interface{} {
+	return []interface{}{p.Output}
+}
+func (p *SessionBuilderOutPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, &p.Output)
+}
+
+// SessionSetupProgressPayload is a step of the setup of a session, see
+// types.SessionSetupStep.
+type SessionSetupProgressPayload struct {
+	Hostname string    `json:"hostname"`
+	Instance string    `json:"instance"`
+	Step     string    `json:"step"`
+	Command  []string  `json:"command"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output"`
+	Error    string    `json:"error"`
+	At       time.Time `json:"at"`
+}
+
+func (p SessionSetupProgressPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *SessionSetupProgressPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+// SessionExpiringPayload warns that the session will be closed at ExpiresAt,
+// Remaining seconds from when it was emitted.
+type SessionExpiringPayload struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Remaining int       `json:"remaining"`
+}
+
+func (p SessionExpiringPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *SessionExpiringPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+type SessionExtendedPayload struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (p SessionExtendedPayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *SessionExtendedPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+// SessionIdlePayload warns that the session will be closed at ClosesAt
+// unless it's used before.
+type SessionIdlePayload struct {
+	LastActivityAt time.Time `json:"last_activity_at"`
+	ClosesAt       time.Time `json:"closes_at"`
+}
+
+func (p SessionIdlePayload) Args() []interface{} {
+	return []interface{}{p}
+}
+func (p *SessionIdlePayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args, p)
+}
+
+// EmptyPayload is the payload of events that only carry an id, like
+// SESSION_NEW, SESSION_END or PLAYGROUND_NEW.
+type EmptyPayload struct{}
+
+func (p EmptyPayload) Args() []interface{} {
+	return nil
+}
+func (p *EmptyPayload) FromArgs(args []interface{}) error {
+	return fieldsFromArgs(args)
+}
+
+var payloads = map[EventType]reflect.Type{
+	INSTANCE_NEW:                 reflect.TypeOf(InstanceNewPayload{}),
+	INSTANCE_DELETE:              reflect.TypeOf(InstanceDeletePayload{}),
+	INSTANCE_VIEWPORT_RESIZE:     reflect.TypeOf(InstanceViewportResizePayload{}),
+	INSTANCE_STATS:               reflect.TypeOf(InstanceStatsPayload{}),
+	INSTANCE_DOCKER_PORTS:        reflect.TypeOf(DockerPortsPayload{}),
+	INSTANCE_DOCKER_SWARM_PORTS:  reflect.TypeOf(ClusterPortsPayload{}),
+	INSTANCE_DOCKER_SWARM_STATUS: reflect.TypeOf(ClusterStatusPayload{}),
+	INSTANCE_K8S_STATUS:          reflect.TypeOf(ClusterStatusPayload{}),
+	INSTANCE_K8S_CLUSTER_PORTS:   reflect.TypeOf(ClusterPortsPayload{}),
+	INSTANCE_UNHEALTHY:           reflect.TypeOf(InstanceUnhealthyPayload{}),
+	SESSION_NEW:                  reflect.TypeOf(EmptyPayload{}),
+	SESSION_END:                  reflect.TypeOf(EmptyPayload{}),
+	SESSION_READY:                reflect.TypeOf(SessionReadyPayload{}),
+	SESSION_BUILDER_OUT:          reflect.TypeOf(SessionBuilderOutPayload{}),
+	SESSION_SETUP_PROGRESS:       reflect.TypeOf(SessionSetupProgressPayload{}),
+	SESSION_EXPIRING:             reflect.TypeOf(SessionExpiringPayload{}),
+	SESSION_EXTENDED:             reflect.TypeOf(SessionExtendedPayload{}),
+	SESSION_IDLE:                 reflect.TypeOf(SessionIdlePayload{}),
+	PLAYGROUND_NEW:               reflect.TypeOf(EmptyPayload{}),
+}
+
+// fieldsFromArgs decodes every arg into the value dst at the same position
+// points to. Args are converted through JSON so it doesn't matter whether
+// they still have their original type or went through a JSON round trip.
+func fieldsFromArgs(args []interface{}, dst ...interface{}) error {
+	if len(args) != len(dst) {
+		return fmt.Errorf("Expected %d args but got %d", len(dst), len(args))
+	}
+	for i, arg := range args {
+		b, err := json.Marshal(arg)
+		if err != nil {
+			return fmt.Errorf("Cannot encode arg %d. Got: %v", i, err)
+		}
+		if err := json.Unmarshal(b, dst[i]); err != nil {
+			return fmt.Errorf("Cannot decode arg %d. Got: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// NewPayload returns a pointer to an empty payload of the type carried by
+// events of the given type.
+func NewPayload(name EventType) (Payload, error) {
+	t, found := payloads[name]
+	if !found {
+		return nil, fmt.Errorf("Event [%s] doesn't have a payload type", name)
+	}
+	return reflect.New(t).Interface().(argsDecoder), nil
+}
+
+// DecodePayload builds the typed payload of an event from its args.
+func DecodePayload(name EventType, args []interface{}) (Payload, error) {
+	p, err := NewPayload(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.(argsDecoder).FromArgs(args); err != nil {
+		return nil, fmt.Errorf("Malformed [%s] event. Got: %v", name, err)
+	}
+	return p, nil
+}
+
+// MarshalPayload encodes a payload as the JSON array of its args.
+func MarshalPayload(p Payload) ([]byte, error) {
+	args := p.Args()
+	if args == nil {
+		args = []interface{}{}
+	}
+	return json.Marshal(args)
+}
+
+// UnmarshalPayload decodes a payload encoded by MarshalPayload.
+func UnmarshalPayload(name EventType, data []byte) (Payload, error) {
+	var args []interface{}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	return DecodePayload(name, args)
+}
+
+// EmitPayload emits an event with the args of a typed payload.
+func EmitPayload(e EventApi, name EventType, id string, p Payload) {
+	e.Emit(name, id, p.Args()...)
+}
+
+// Subscribe registers a typed handler for an event. handler must be a
+// function like func(id string, p *InstanceNewPayload) taking a pointer to
+// the payload type of the event, otherwise Subscribe panics. Events whose
+// args can't be decoded are logged and dropped instead of reaching handler.
+func Subscribe(e EventApi, name EventType, handler interface{}) {
+	t, found := payloads[name]
+	if !found {
+		panic(fmt.Sprintf("Event [%s] doesn't have a payload type", name))
+	}
+	h := reflect.ValueOf(handler)
+	ht := h.Type()
+	if ht.Kind() != reflect.Func || ht.NumIn() != 2 || ht.NumOut() != 0 || ht.In(0).Kind() != reflect.String || ht.In(1) != reflect.PtrTo(t) {
+		panic(fmt.Sprintf("Handler for [%s] must be a func(string, *%s), got %s", name, t.Name(), ht))
+	}
+	e.On(name, func(id string, args ...interface{}) {
+		p, err := DecodePayload(name, args)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		h.Call([]reflect.Value{reflect.ValueOf(id), reflect.ValueOf(p)})
+	})
+}
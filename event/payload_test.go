@@ -0,0 +1,95 @@
+package event
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	broker := NewLocalBroker()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	var received *InstanceNewPayload
+	Subscribe(broker, INSTANCE_NEW, func(sessionId string, p *InstanceNewPayload) {
+		assert.Equal(t, "aaaabbbbcccc", sessionId)
+		received = p
+		wg.Done()
+	})
+	EmitPayload(broker, INSTANCE_NEW, "aaaabbbbcccc", InstanceNewPayload{Name: "node1", IP: "10.0.0.1", Hostname: "node1", ProxyHost: "ip10-0-0-1"})
+
+	wg.Wait()
+
+	assert.Equal(t, &InstanceNewPayload{Name: "node1", IP: "10.0.0.1", Hostname: "node1", ProxyHost: "ip10-0-0-1"}, received)
+}
+
+func TestSubscribe_DropsMalformedEvents(t *testing.T) {
+	broker := NewLocalBroker()
+
+	mx := sync.Mutex{}
+	called := 0
+	Subscribe(broker, INSTANCE_DELETE, func(sessionId string, p *InstanceDeletePayload) {
+		mx.Lock()
+		defer mx.Unlock()
+		called++
+	})
+	broker.Emit(INSTANCE_DELETE, "aaaabbbbcccc")
+	broker.Emit(INSTANCE_DELETE, "aaaabbbbcccc", 42)
+
+	time.Sleep(50 * time.Millisecond)
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, 0, called)
+}
+
+func TestSubscribe_WrongHandler(t *testing.T) {
+	broker := NewLocalBroker()
+
+	assert.Panics(t, func() {
+		Subscribe(broker, INSTANCE_NEW, func(sessionId string, p *InstanceDeletePayload) {})
+	})
+	assert.Panics(t, func() {
+		Subscribe(broker, INSTANCE_NEW, func(sessionId string, args ...interface{}) {})
+	})
+}
+
+func TestDecodePayload_FromJSON(t *testing.T) {
+	// Args as they arrive from another process
+	var args []interface{}
+	err := json.Unmarshal([]byte(`[{"instance":"node1","mem":"1.00% (10MiB / 1GiB)","cpu":"0.50%"}]`), &args)
+	assert.Nil(t, err)
+
+	p, err := DecodePayload(INSTANCE_STATS, args)
+	assert.Nil(t, err)
+	assert.Equal(t, &InstanceStatsPayload{Instance: "node1", Mem: "1.00% (10MiB / 1GiB)", Cpu: "0.50%"}, p)
+
+	err = json.Unmarshal([]byte(`[80, 24]`), &args)
+	assert.Nil(t, err)
+
+	p, err = DecodePayload(INSTANCE_VIEWPORT_RESIZE, args)
+	assert.Nil(t, err)
+	assert.Equal(t, &InstanceViewportResizePayload{Cols: 80, Rows: 24}, p)
+}
+
+func TestMarshalPayload(t *testing.T) {
+	b, err := MarshalPayload(ClusterPortsPayload{Manager: "node1", Instances: []string{"node1", "node2"}, Ports: []int{8080}})
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"manager":"node1","instances":["node1","node2"],"ports":[8080]}]`, string(b))
+
+	p, err := UnmarshalPayload(INSTANCE_DOCKER_SWARM_PORTS, b)
+	assert.Nil(t, err)
+	assert.Equal(t, &ClusterPortsPayload{Manager: "node1", Instances: []string{"node1", "node2"}, Ports: []int{8080}}, p)
+
+	b, err = MarshalPayload(EmptyPayload{})
+	assert.Nil(t, err)
+	assert.Equal(t, `[]`, string(b))
+
+	_, err = UnmarshalPayload(SESSION_NEW, b)
+	assert.Nil(t, err)
+}
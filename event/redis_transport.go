@@ -0,0 +1,310 @@
+package event
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RedisOpts tells the redis transport how to reach the redis server.
+type RedisOpts struct {
+	Addr string
+	// Username is only needed with redis ACLs, Password alone is sent to
+	// servers protected by requirepass.
+	Username string
+	Password string
+	// TLS is used to connect to the server when set.
+	TLS *tls.Config
+}
+
+// ParseRedisURL parses either a plain host:port or a redis:// URL, like
+// redis://:password@host:6379. The rediss:// scheme connects over TLS.
+func ParseRedisURL(s string) (RedisOpts, error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		// host:port either fails to parse or looks like an opaque URL
+		return RedisOpts{Addr: s}, nil
+	}
+	if u.Host == "" {
+		return RedisOpts{}, fmt.Errorf("Missing host in redis URL %s", s)
+	}
+	opts := RedisOpts{Addr: u.Host}
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	if u.Scheme == "rediss" {
+		opts.TLS = &tls.Config{ServerName: u.Hostname()}
+	}
+	return opts, nil
+}
+
+// redisTransport is a Transport on top of redis PUBLISH/SUBSCRIBE. It speaks
+// just enough of the redis protocol for that. Publishing uses one connection
+// that is dialed lazily, and every subscription holds its own connection that
+// is re-established whenever it drops. Redis doesn't keep messages for
+// subscribers that aren't connected, so whatever is published while a
+// subscription is down is lost.
+type redisTransport struct {
+	opts RedisOpts
+
+	mx     sync.Mutex
+	pub    net.Conn
+	pubR   *bufio.Reader
+	subs   []net.Conn
+	closed bool
+	done   chan struct{}
+}
+
+func NewRedisTransport(opts RedisOpts) *redisTransport {
+	return &redisTransport{opts: opts, done: make(chan struct{})}
+}
+
+// dial connects to the server and authenticates when a password is set.
+func (t *redisTransport) dial() (net.Conn, *bufio.Reader, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var c net.Conn
+	var err error
+	if t.opts.TLS != nil {
+		c, err = tls.DialWithDialer(dialer, "tcp", t.opts.Addr, t.opts.TLS)
+	} else {
+		c, err = dialer.Dial("tcp", t.opts.Addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(c)
+	if t.opts.Password != "" {
+		args := [][]byte{[]byte(t.opts.Password)}
+		if t.opts.Username != "" {
+			args = append([][]byte{[]byte(t.opts.Username)}, args...)
+		}
+		err = writeRedisCommand(c, "AUTH", args...)
+		if err == nil {
+			_, err = readRedisReply(r)
+		}
+		if err != nil {
+			c.Close()
+			return nil, nil, fmt.Errorf("Cannot authenticate to redis. Got: %v", err)
+		}
+	}
+	return c, r, nil
+}
+
+func (t *redisTransport) Publish(subject string, data []byte) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.closed {
+		return ErrTransportClosed
+	}
+	// A connection that was idle for long may have been dropped by the
+	// server, so publishing on a reused one is retried once on a new one.
+	reused := t.pub != nil
+	for {
+		if t.pub == nil {
+			c, r, err := t.dial()
+			if err != nil {
+				return err
+			}
+			t.pub, t.pubR = c, r
+		}
+		err := writeRedisCommand(t.pub, "PUBLISH", []byte(subject), data)
+		if err == nil {
+			_, err = readRedisReply(t.pubR)
+		}
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(redisError); ok {
+			return err
+		}
+		t.pub.Close()
+		t.pub = nil
+		if !reused {
+			return err
+		}
+		reused = false
+	}
+}
+
+func (t *redisTransport) Subscribe(subject string, handler func(data []byte)) error {
+	c, r, err := t.subscribe(subject)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			err := t.receive(c, r, handler)
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+			log.Printf("Lost redis subscription to %s, events published until it's back are lost. Got: %v\n", subject, err)
+			lost := time.Now()
+			for {
+				time.Sleep(time.Second)
+				if c, r, err = t.subscribe(subject); err == nil {
+					break
+				}
+				if err == ErrTransportClosed {
+					return
+				}
+				log.Printf("Cannot subscribe to %s. Got: %v\n", subject, err)
+			}
+			log.Printf("Redis subscription to %s is back, events published in the last %s were lost\n", subject, time.Since(lost).Round(time.Second))
+		}
+	}()
+	return nil
+}
+
+func (t *redisTransport) subscribe(subject string) (net.Conn, *bufio.Reader, error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.closed {
+		return nil, nil, ErrTransportClosed
+	}
+	c, r, err := t.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeRedisCommand(c, "SUBSCRIBE", []byte(subject)); err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	t.subs = append(t.subs, c)
+	return c, r, nil
+}
+
+func (t *redisTransport) receive(c net.Conn, r *bufio.Reader, handler func(data []byte)) error {
+	defer t.forget(c)
+
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return err
+		}
+		// Pushed messages look like ["message", channel, payload]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		if kind, ok := parts[0].([]byte); !ok || string(kind) != "message" {
+			continue
+		}
+		if payload, ok := parts[2].([]byte); ok {
+			handler(payload)
+		}
+	}
+}
+
+func (t *redisTransport) forget(c net.Conn) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	c.Close()
+	for i, s := range t.subs {
+		if s == c {
+			t.subs = append(t.subs[:i], t.subs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (t *redisTransport) Close() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	if t.pub != nil {
+		t.pub.Close()
+	}
+	for _, c := range t.subs {
+		c.Close()
+	}
+	return nil
+}
+
+func writeRedisCommand(w io.Writer, name string, args ...[]byte) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(name), name)
+	for _, arg := range args {
+		fmt.Fprintf(bw, "$%d\r\n", len(arg))
+		bw.Write(arg)
+		bw.WriteString("\r\n")
+	}
+	return bw.Flush()
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// readRedisReply reads one reply. Simple and bulk strings are returned as
+// []byte, integers as int64, arrays as []interface{} and null bulk strings or
+// arrays as nil.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("Malformed redis reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return []byte(rest), nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("Unknown redis reply type %q", kind)
+}
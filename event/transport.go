@@ -0,0 +1,68 @@
+package event
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrTransportClosed = errors.New("Event transport is closed")
+
+// Transport moves encoded events between PWD replicas. Implementations are
+// expected to deliver every message published on a subject to all of its
+// subscribers, including the ones living in the publishing process.
+type Transport interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func(data []byte)) error
+	Close() error
+}
+
+// memoryTransport is a Transport that only lives inside the current process.
+// Several brokers sharing one memoryTransport behave like replicas connected
+// to the same message bus, which is handy for tests.
+type memoryTransport struct {
+	mx     sync.Mutex
+	subs   map[string][]func(data []byte)
+	closed bool
+}
+
+func NewMemoryTransport() *memoryTransport {
+	return &memoryTransport{subs: map[string][]func(data []byte){}}
+}
+
+func (t *memoryTransport) Publish(subject string, data []byte) error {
+	t.mx.Lock()
+	if t.closed {
+		t.mx.Unlock()
+		return ErrTransportClosed
+	}
+	handlers := make([]func(data []byte), len(t.subs[subject]))
+	copy(handlers, t.subs[subject])
+	t.mx.Unlock()
+
+	for _, handler := range handlers {
+		b := make([]byte, len(data))
+		copy(b, data)
+		handler(b)
+	}
+	return nil
+}
+
+func (t *memoryTransport) Subscribe(subject string, handler func(data []byte)) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.closed {
+		return ErrTransportClosed
+	}
+	t.subs[subject] = append(t.subs[subject], handler)
+	return nil
+}
+
+func (t *memoryTransport) Close() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	t.closed = true
+	t.subs = map[string][]func(data []byte){}
+	return nil
+}
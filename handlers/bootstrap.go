@@ -25,6 +25,7 @@ import (
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/webhook"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/negroni"
@@ -36,6 +37,8 @@ import (
 var (
 	core     pwd.PWDApi
 	e        event.EventApi
+	history  *event.History
+	webhooks *webhook.Dispatcher
 	landings = map[string][]byte{}
 )
 
@@ -60,6 +63,8 @@ func init() {
 func Bootstrap(c pwd.PWDApi, ev event.EventApi) {
 	core = c
 	e = ev
+	history = event.NewHistory(ev, config.EventHistorySize)
+	webhooks = webhook.NewDispatcher(ev, c, config.WebhookMaxAttempts, config.WebhookLogSize)
 }
 
 func Register(extend HandlerExtender) {
@@ -85,6 +90,11 @@ func Register(extend HandlerExtender) {
 	corsRouter.HandleFunc("/sessions/{sessionId}/close", CloseSession).Methods("POST")
 	corsRouter.HandleFunc("/sessions/{sessionId}", CloseSession).Methods("DELETE")
 	corsRouter.HandleFunc("/sessions/{sessionId}/setup", SessionSetup).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/extend", ExtendSession).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/snapshot", SnapshotSession).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/clone", CloneSession).Methods("POST")
+	corsRouter.HandleFunc("/snapshots/{snapshotId}/restore", RestoreSnapshot).Methods("POST")
+	corsRouter.HandleFunc("/snapshots/{snapshotId}", DeleteSnapshot).Methods("DELETE")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances", NewInstance).Methods("POST")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/uploads", FileUpload).Methods("POST")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}", DeleteInstance).Methods("DELETE")
@@ -123,6 +133,12 @@ func Register(extend HandlerExtender) {
 	r.HandleFunc("/oauth/providers/{provider}/callback", LoginCallback).Methods("GET")
 	r.HandleFunc("/playgrounds", NewPlayground).Methods("PUT")
 	r.HandleFunc("/playgrounds", ListPlaygrounds).Methods("GET")
+	r.HandleFunc("/playgrounds/{playgroundId}/webhooks/deliveries", ListWebhookDeliveries).Methods("GET")
+	r.HandleFunc("/playgrounds/{playgroundId}/templates", ListTemplates).Methods("GET")
+	r.HandleFunc("/playgrounds/{playgroundId}/templates", SaveTemplate).Methods("POST")
+	r.HandleFunc("/playgrounds/{playgroundId}/templates/{name}", GetTemplate).Methods("GET")
+	r.HandleFunc("/playgrounds/{playgroundId}/templates/{name}", DeleteTemplate).Methods("DELETE")
+	r.HandleFunc("/sessions/activity", SessionActivity).Methods("POST")
 	r.HandleFunc("/my/playground", GetCurrentPlayground).Methods("GET")
 
 	corsRouter.HandleFunc("/", NewSession).Methods("POST")
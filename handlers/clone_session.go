@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+func CloneSession(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	req.ParseForm()
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	playground := core.PlaygroundGet(session.PlaygroundId)
+	if playground == nil {
+		log.Printf("Playground with id %s for session %s was not found!", session.PlaygroundId, session.Id)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userId := ""
+	if len(config.Providers[playground.Id]) > 0 {
+		cookie, err := ReadCookie(req)
+		if err != nil {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		userId = cookie.Id
+	}
+
+	copyFiles := req.Form.Get("copy_files") == "true"
+	sConfig := types.SessionConfig{Playground: playground, UserId: userId, Duration: playground.DefaultSessionDuration, SourceIP: sourceIP(req)}
+	s, err := core.SessionClone(context.Background(), session, sConfig, copyFiles)
+	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+		} else if provisioner.OutOfCapacity(err) {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		} else if !writeQuotaExceeded(rw, err) {
+			log.Println(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(NewSessionResponse{SessionId: s.Id, Hostname: req.Host})
+}
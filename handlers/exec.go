@@ -39,6 +39,10 @@ func Exec(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if err := core.SessionTouch(s.Id); err != nil {
+		log.Printf("Error recording activity of session [%s]. Got: %v\n", s.Id, err)
+	}
+
 	code, err := core.InstanceExec(i, er.Cmd)
 
 	if err != nil {
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+type ExtendSessionResponse struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func ExtendSession(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	req.ParseForm()
+
+	var duration time.Duration
+	if reqDur := req.Form.Get("duration"); reqDur != "" {
+		d, err := time.ParseDuration(reqDur)
+		if err != nil || d <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		duration = d
+	}
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := core.SessionExtend(session, duration); pwd.SessionNotExtendable(err) {
+		rw.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(ExtendSessionResponse{ExpiresAt: session.ExpiresAt})
+}
@@ -4,15 +4,50 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/storage"
 )
 
+// SessionInfo is what anybody with the session id gets to see about it. It
+// leaves out where the session runs and who requested it.
 type SessionInfo struct {
-	*types.Session
-	Instances map[string]*types.Instance `json:"instances"`
+	Id             string                     `json:"id"`
+	CreatedAt      time.Time                  `json:"created_at"`
+	ExpiresAt      time.Time                  `json:"expires_at"`
+	PwdIpAddress   string                     `json:"pwd_ip_address"`
+	Ready          bool                       `json:"ready"`
+	Stack          string                     `json:"stack"`
+	StackName      string                     `json:"stack_name"`
+	ImageName      string                     `json:"image_name"`
+	Host           string                     `json:"host"`
+	UserId         string                     `json:"user_id"`
+	PlaygroundId   string                     `json:"playground_id"`
+	SourceIP       string                     `json:"source_ip"`
+	LastActivityAt time.Time                  `json:"last_activity_at"`
+	Instances      map[string]*types.Instance `json:"instances"`
+	Setup          *types.SessionSetupStatus  `json:"setup,omitempty"`
+}
+
+func newSessionInfo(s *types.Session, instances map[string]*types.Instance, setup *types.SessionSetupStatus) SessionInfo {
+	return SessionInfo{
+		Id:             s.Id,
+		CreatedAt:      s.CreatedAt,
+		ExpiresAt:      s.ExpiresAt,
+		PwdIpAddress:   s.PwdIpAddress,
+		Ready:          s.Ready,
+		Stack:          s.Stack,
+		StackName:      s.StackName,
+		ImageName:      s.ImageName,
+		Host:           s.Host,
+		UserId:         s.UserId,
+		PlaygroundId:   s.PlaygroundId,
+		LastActivityAt: s.LastActivityAt,
+		Instances:      instances,
+		Setup:          setup,
+	}
 }
 
 func GetSession(rw http.ResponseWriter, req *http.Request) {
@@ -39,5 +74,12 @@ func GetSession(rw http.ResponseWriter, req *http.Request) {
 		is[i.Name] = i
 	}
 
-	json.NewEncoder(rw).Encode(SessionInfo{session, is})
+	setup, err := core.SessionSetupStatus(session.Id)
+	if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(newSessionInfo(session, is, setup))
 }
@@ -37,20 +37,6 @@ func NewInstance(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	instances, err := core.InstanceFindBySession(s)
-
-	if err != nil {
-		log.Println(err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	if playground.MaxInstances > 0 && len(instances) >= playground.MaxInstances {
-		log.Println(err)
-		rw.WriteHeader(http.StatusConflict)
-		return
-	}
-
 	if len(playground.DindVolumeSize) > 0 {
 		body.DindVolumeSize = playground.DindVolumeSize
 	}
@@ -68,6 +54,9 @@ func NewInstance(rw http.ResponseWriter, req *http.Request) {
 			fmt.Fprintln(rw, `{"error": "out_of_capacity"}`)
 			return
 		}
+		if writeQuotaExceeded(rw, err) {
+			return
+		}
 		log.Println(err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
@@ -13,6 +13,7 @@ import (
 	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/provisioner"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
 )
 
 type NewSessionResponse struct {
@@ -45,6 +46,7 @@ func NewSession(rw http.ResponseWriter, req *http.Request) {
 	stack := req.Form.Get("stack")
 	stackName := req.Form.Get("stack_name")
 	imageName := req.Form.Get("image_name")
+	templateName := req.Form.Get("template")
 
 	if stack != "" {
 		stack = formatStack(stack)
@@ -60,6 +62,25 @@ func NewSession(rw http.ResponseWriter, req *http.Request) {
 
 	}
 
+	var template *types.SessionTemplate
+	if templateName != "" {
+		version, err := templateVersion(req)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		template, err = core.TemplateGet(playground.Id, templateName, version)
+		if storage.NotFound(err) {
+			log.Printf("Template [%s] could not be found", templateName)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error retrieving template: %s", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	var duration time.Duration
 	if reqDur != "" {
 		d, err := time.ParseDuration(reqDur)
@@ -77,18 +98,35 @@ func NewSession(rw http.ResponseWriter, req *http.Request) {
 		duration = playground.DefaultSessionDuration
 	}
 
-	sConfig := types.SessionConfig{Playground: playground, UserId: userId, Duration: duration, Stack: stack, StackName: stackName, ImageName: imageName}
+	sConfig := types.SessionConfig{Playground: playground, UserId: userId, Duration: duration, Stack: stack, StackName: stackName, ImageName: imageName, SourceIP: sourceIP(req)}
 	s, err := core.SessionNew(context.Background(), sConfig)
 	if err != nil {
 		if provisioner.OutOfCapacity(err) {
 			http.Redirect(rw, req, "/ooc", http.StatusFound)
 			return
 		}
+		if writeQuotaExceeded(rw, err) {
+			return
+		}
 		log.Printf("%#v \n", err)
 		http.Redirect(rw, req, "/500", http.StatusInternalServerError)
 		return
 		//TODO: Return some error code
 	} else {
+		if template != nil {
+			if err := core.SessionSetupTemplate(s, template); err != nil {
+				log.Printf("Could not set up session %s with template %s. Got: %v\n", s.Id, template.Name, err)
+				if err := core.SessionClose(s); err != nil {
+					log.Printf("Could not close session %s. Got: %v\n", s.Id, err)
+				}
+				if writeQuotaExceeded(rw, err) {
+					return
+				}
+				http.Redirect(rw, req, "/500", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		hostname := req.Host
 		// If request is not a form, return sessionId in the body
 		if req.Header.Get("X-Requested-With") == "XMLHttpRequest" {
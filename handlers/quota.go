@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd"
+)
+
+type QuotaExceededResponse struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// writeQuotaExceeded answers with a 429 telling which quota err is about. It
+// returns false when err isn't a pwd.QuotaExceededError.
+func writeQuotaExceeded(rw http.ResponseWriter, err error) bool {
+	q, ok := pwd.QuotaExceeded(err)
+	if !ok {
+		return false
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(rw).Encode(QuotaExceededResponse{Error: "quota_exceeded", Reason: q.Reason})
+	return true
+}
+
+// sourceIP returns the address req comes from. X-Forwarded-For is only
+// believed when the request comes from a trusted proxy, and then only up to
+// the first hop that isn't one, as the ones before can be forged.
+func sourceIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !config.TrustedProxies.Contains(net.ParseIP(host)) {
+		return host
+	}
+	f := req.Header.Get("X-Forwarded-For")
+	if f == "" {
+		return host
+	}
+	hops := strings.Split(f, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		host = strings.TrimSpace(hops[i])
+		if !config.TrustedProxies.Contains(net.ParseIP(host)) {
+			break
+		}
+	}
+	return host
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// SessionActivityRequest is sent by the L2 router with the sessions it
+// proxied connections to.
+type SessionActivityRequest struct {
+	SessionIds []string `json:"session_ids"`
+}
+
+func SessionActivity(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var r SessionActivityRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, sessionId := range r.SessionIds {
+		if err := core.SessionTouch(sessionId); err != nil && !storage.NotFound(err) {
+			log.Printf("Error recording activity of session [%s]. Got: %v\n", sessionId, err)
+		}
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
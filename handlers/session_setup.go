@@ -43,6 +43,14 @@ func SessionSetup(rw http.ResponseWriter, req *http.Request) {
 			rw.Write([]byte("Cannot setup a session that contains instances"))
 			return
 		}
+		if pwd.NoK8sControlPlane(err) {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if writeQuotaExceeded(rw, err) {
+			return
+		}
 		log.Println(err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
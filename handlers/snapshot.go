@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+type SnapshotResponse struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func SnapshotSession(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	req.ParseForm()
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	snapshot, err := core.SessionSnapshot(session, req.Form.Get("name"))
+	if pwd.InvalidSnapshotName(err) {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	} else if pwd.SnapshotExists(err) {
+		rw.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(SnapshotResponse{Id: snapshot.Id, Name: snapshot.Name, CreatedAt: snapshot.CreatedAt, ExpiresAt: snapshot.ExpiresAt})
+}
+
+// snapshotRequest returns the playground of the request and its user, which
+// is empty on playgrounds without login. It writes the error response when
+// either can't be had.
+func snapshotRequest(rw http.ResponseWriter, req *http.Request) (*types.Playground, string, bool) {
+	playground := core.PlaygroundFindByDomain(req.Host)
+	if playground == nil {
+		log.Printf("Playground for domain %s was not found!", req.Host)
+		rw.WriteHeader(http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	userId := ""
+	if len(config.Providers[playground.Id]) > 0 {
+		cookie, err := ReadCookie(req)
+		if err != nil {
+			rw.WriteHeader(http.StatusForbidden)
+			return nil, "", false
+		}
+		userId = cookie.Id
+	}
+	return playground, userId, true
+}
+
+func RestoreSnapshot(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	snapshotId := vars["snapshotId"]
+
+	playground, userId, ok := snapshotRequest(rw, req)
+	if !ok {
+		return
+	}
+
+	sConfig := types.SessionConfig{Playground: playground, UserId: userId, Duration: playground.DefaultSessionDuration, SourceIP: sourceIP(req)}
+	s, err := core.SessionRestore(context.Background(), snapshotId, sConfig)
+	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if storage.NotFound(err) {
+			rw.WriteHeader(http.StatusNotFound)
+		} else if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+		} else if provisioner.OutOfCapacity(err) {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		} else if !writeQuotaExceeded(rw, err) {
+			log.Println(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(NewSessionResponse{SessionId: s.Id, Hostname: req.Host})
+}
+
+func DeleteSnapshot(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	snapshotId := vars["snapshotId"]
+
+	_, userId, ok := snapshotRequest(rw, req)
+	if !ok {
+		return
+	}
+
+	err := core.SnapshotDelete(snapshotId, userId)
+	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if storage.NotFound(err) {
+			rw.WriteHeader(http.StatusNotFound)
+		} else if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+		} else {
+			log.Println(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+func ListTemplates(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(req)
+	playgroundId := vars["playgroundId"]
+
+	if core.PlaygroundGet(playgroundId) == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	templates, err := core.TemplateList(playgroundId)
+	if err != nil {
+		log.Printf("Error listing templates. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(templates)
+}
+
+func SaveTemplate(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(req)
+	playgroundId := vars["playgroundId"]
+
+	if core.PlaygroundGet(playgroundId) == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var template types.SessionTemplate
+	if err := json.NewDecoder(req.Body).Decode(&template); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(rw, "Error saving template. Got: %v", err)
+		return
+	}
+	template.PlaygroundId = playgroundId
+
+	if err := core.TemplateSave(&template); pwd.InvalidTemplate(err) {
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(rw, "Error saving template. Got: %v", err)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(template)
+}
+
+func GetTemplate(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(req)
+	playgroundId := vars["playgroundId"]
+	name := vars["name"]
+
+	version, err := templateVersion(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	template, err := core.TemplateGet(playgroundId, name, version)
+	if storage.NotFound(err) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error getting template %s. Got: %v\n", name, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(template)
+}
+
+func DeleteTemplate(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(req)
+	playgroundId := vars["playgroundId"]
+	name := vars["name"]
+
+	if err := core.TemplateDelete(playgroundId, name); err != nil {
+		log.Printf("Error deleting template %s. Got: %v\n", name, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// templateVersion is the version asked for in the request, 0 meaning the
+// latest one.
+func templateVersion(req *http.Request) (int, error) {
+	v := req.FormValue("template_version")
+	if v == "" {
+		v = req.FormValue("version")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("Invalid template version %s", v)
+	}
+	return version, nil
+}
@@ -209,30 +209,28 @@ func NewManager(s *types.Session) (*manager, error) {
 		instances: make(map[string]*types.Instance),
 	}
 
-	e.On(event.INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+	event.Subscribe(e, event.INSTANCE_NEW, func(sessionId string, p *event.InstanceNewPayload) {
 		if sessionId != s.Id {
 			return
 		}
 
 		// There is a new instance in a session we are tracking. We should track it's terminal
-		instanceName := args[0].(string)
-		instance := core.InstanceGet(s, instanceName)
+		instance := core.InstanceGet(s, p.Name)
 		if instance == nil {
-			log.Printf("Instance [%s] was not found in session [%s]\n", instanceName, sessionId)
+			log.Printf("Instance [%s] was not found in session [%s]\n", p.Name, sessionId)
 			return
 		}
 		m.trackInstance(instance)
 		m.connect(instance)
 	})
 
-	e.On(event.INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
+	event.Subscribe(e, event.INSTANCE_DELETE, func(sessionId string, p *event.InstanceDeletePayload) {
 		if sessionId != s.Id {
 			return
 		}
 
 		// There is a new instance in a session we are tracking. We should track it's terminal
-		instanceName := args[0].(string)
-		instance := &types.Instance{Name: instanceName}
+		instance := &types.Instance{Name: p.Name}
 		m.disconnect(instance)
 	})
 
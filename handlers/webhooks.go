@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func ListWebhookDeliveries(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(req)
+	playgroundId := vars["playgroundId"]
+
+	if core.PlaygroundGet(playgroundId) == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(webhooks.Deliveries(playgroundId))
+}
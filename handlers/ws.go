@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/storage"
 	"github.com/satori/go.uuid"
@@ -21,6 +24,11 @@ var upgrader = websocket.Upgrader{
 type message struct {
 	Name string        `json:"name"`
 	Args []interface{} `json:"args"`
+	// Seq is the sequence number of session events, which clients send back
+	// as the since query param when reconnecting, along with the epoch of
+	// the history it belongs to.
+	Seq   uint64 `json:"seq,omitempty"`
+	Epoch string `json:"epoch,omitempty"`
 }
 
 type socket struct {
@@ -91,6 +99,10 @@ func (s *socket) onMessage(msg message) {
 }
 
 func (s *socket) Emit(ev string, args ...interface{}) {
+	s.send(message{Name: ev, Args: args})
+}
+
+func (s *socket) send(m message) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
@@ -98,7 +110,6 @@ func (s *socket) Emit(ev string, args ...interface{}) {
 		return
 	}
 
-	m := message{Name: ev, Args: args}
 	b, err := json.Marshal(m)
 	if err != nil {
 		log.Printf("Cannot marshal event to json. Got: %v\n", err)
@@ -185,6 +196,9 @@ func ws(so *socket) {
 			name := args[0].(string)
 			data := args[1].(string)
 			m.Send(name, []byte(data))
+			if err := core.SessionTouch(session.Id); err != nil {
+				log.Printf("Error recording activity of session [%s]. Got: %v\n", session.Id, err)
+			}
 		}
 	})
 
@@ -197,14 +211,60 @@ func ws(so *socket) {
 		}
 	})
 
+	// stopped is closed once the keep alives are over, so they're never sent
+	// for a client that was closed already.
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	var stopKeepAlive sync.Once
+	if client != nil && config.ClientTTL > 0 {
+		// Keep the client alive while the socket is open so the scheduler
+		// doesn't reap it.
+		go func() {
+			defer close(stopped)
+			t := time.NewTicker(config.ClientTTL / 3)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					core.ClientKeepAlive(client)
+				case <-done:
+					return
+				}
+			}
+		}()
+	} else {
+		close(stopped)
+	}
+
+	forward := func(r event.Record) {
+		so.send(message{Name: r.Type.String(), Args: r.Args, Seq: r.Seq, Epoch: history.Epoch()})
+	}
+	var unsubscribe func()
+	query := so.Request().URL.Query()
+	if since := query.Get("since"); since != "" {
+		seq, err := strconv.ParseUint(since, 10, 64)
+		if epoch := query.Get("epoch"); epoch != "" && epoch != history.Epoch() {
+			// Reconnected to another replica, or after a restart. Its
+			// sequence numbers don't match the ones the client got.
+			log.Printf("Not replaying events of session [%s] from another history epoch\n", session.Id)
+			unsubscribe = history.Subscribe(session.Id, forward)
+		} else if err != nil {
+			log.Printf("Invalid since [%s] for session [%s]. Got: %v\n", since, session.Id, err)
+			unsubscribe = history.Subscribe(session.Id, forward)
+		} else {
+			unsubscribe = history.SubscribeSince(session.Id, seq, forward)
+		}
+	} else {
+		unsubscribe = history.Subscribe(session.Id, forward)
+	}
+
 	so.On("close", func(args ...interface{}) {
+		stopKeepAlive.Do(func() {
+			close(done)
+			<-stopped
+		})
+		unsubscribe()
 		m.Close()
 		core.ClientClose(client)
 	})
-
-	e.OnAny(func(eventType event.EventType, sessionId string, args ...interface{}) {
-		if session.Id == sessionId {
-			so.Emit(eventType.String(), args...)
-		}
-	})
 }
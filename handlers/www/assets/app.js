@@ -105,6 +105,20 @@
       $scope.socket.emit('session close');
     }
 
+    $scope.extendSession = function(duration) {
+      $http({
+        method: 'POST',
+        url: '/sessions/' + $scope.sessionId + '/extend',
+        params: duration ? { duration: duration } : {}
+      }).then(function(response) {
+        $scope.expiresAt = moment(response.data.expires_at);
+      }, function(response) {
+        if (response.status == 409) {
+          $scope.showAlert('Session cannot be extended', 'Your session already lasts as long as this playground allows.');
+        }
+      });
+    }
+
     $scope.upsertInstance = function(info) {
       var i = info;
       if (!$scope.idx[i.name]) {
@@ -129,8 +143,10 @@
       }).then(function(response) {
         $scope.upsertInstance(response.data);
       }, function(response) {
-        if (response.status == 409) {
+        if (response.status == 429 && response.data.reason == 'max_instances') {
           $scope.showAlert('Max instances reached', 'Maximum number of instances reached')
+        } else if (response.status == 429) {
+          $scope.showAlert('Quota exceeded', 'This session is already using all the resources it is allowed to.')
         } else if (response.status == 503 && response.data.error == 'out_of_capacity') {
           $scope.showAlert('Out Of Capacity', 'We are really sorry. But we are currently out of capacity and cannot create new instances. Please try again later.')
         }
@@ -169,6 +185,7 @@
         url: '/sessions/' + $scope.sessionId,
       }).then(function(response) {
         $scope.setSessionState(response.data.ready);
+        $scope.setup = response.data.setup;
 
         if (response.data.created_at) {
           $scope.expiresAt = moment(response.data.expires_at);
@@ -197,8 +214,14 @@
 		base += ':' + window.location.port;
 	}
 
-	var socket = new ReconnectingWebSocket(base + '/sessions/' + sessionId + '/ws/', null, {reconnectInterval: 1000});
+	var wsUrl = base + '/sessions/' + sessionId + '/ws/';
+	var socket = new ReconnectingWebSocket(wsUrl, null, {reconnectInterval: 1000});
 	socket.listeners = {};
+	// Sequence number of the last session event received. Reconnections
+	// ask the server to replay everything after it. Sequence numbers are
+	// only meaningful to the server that sent them, which epoch identifies.
+	socket.lastSeq = 0;
+	socket.epoch = '';
 
 	socket.on = function(name, cb) {
 		if (!socket.listeners[name]) {
@@ -218,6 +241,7 @@
 
 	socket.addEventListener('open', function (event) {
           $scope.connected = true;
+	  socket.url = wsUrl + '?since=' + socket.lastSeq + '&epoch=' + socket.epoch;
 	  for (var i in $rootScope.instances) {
 		  var instance = $rootScope.instances[i];
 		  if (instance.term) {
@@ -236,6 +260,11 @@
 	});
 	socket.addEventListener('message', function (event) {
 		var m = JSON.parse(event.data);
+		if (m.seq) {
+			socket.lastSeq = m.seq;
+			socket.epoch = m.epoch;
+			socket.url = wsUrl + '?since=' + m.seq + '&epoch=' + m.epoch;
+		}
 		var ls = socket.listeners[m.name];
 		if (ls) {
 			for (var i=0; i<ls.length; i++) {
@@ -287,6 +316,19 @@
           socket.close();
         });
 
+        socket.on('session expiring', function(expiry) {
+          $scope.expiresAt = moment(expiry.expires_at);
+          $scope.showAlert('Session expiring', 'Your session will expire in ' + moment.duration(expiry.remaining, 'seconds').humanize() + ' and all of your instances will be deleted.');
+        });
+
+        socket.on('session idle', function(idle) {
+          $scope.showAlert('Session idle', 'Your session has not been used for a while and will be closed ' + moment(idle.closes_at).fromNow() + ' unless you use it.');
+        });
+
+        socket.on('session extended', function(extension) {
+          $scope.expiresAt = moment(extension.expires_at);
+        });
+
         socket.on('instance new', function(name, ip, hostname, proxyHost) {
           var instance = $scope.upsertInstance({ name: name, ip: ip, hostname: hostname, proxy_host: proxyHost, session_id: $scope.sessionId});
           $scope.$apply(function() {
@@ -349,6 +391,17 @@
             } else {
                 $scope.idx[status.instance].isK8sManager = null
             }
+            $scope.idx[status.instance].isK8sReady = status.ready
+            $scope.$apply();
+        });
+
+        socket.on('session setup progress', function(step) {
+            if (step.instance && $scope.idx[step.instance]) {
+                $scope.idx[step.instance].setupStep = step;
+            }
+            if (step.step == 'setup_finished') {
+                $scope.setup = {state: step.error ? 'failed' : 'done', error: step.error};
+            }
             $scope.$apply();
         });
 
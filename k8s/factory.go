@@ -119,18 +119,19 @@ type kubeletPodsResponse struct {
 	Items []item
 }
 
-func (c *KubeletClient) IsManager() (bool, error) {
+func (c *KubeletClient) hasPod(label string) (bool, error) {
 	res, err := c.client.Get(c.baseURL + "/pods")
 	if err != nil {
 		return false, err
 	}
+	defer res.Body.Close()
 	podsData := &kubeletPodsResponse{}
 
 	json.NewDecoder(res.Body).Decode(podsData)
 
 	for _, i := range podsData.Items {
 		for _, v := range i.Metadata.Labels {
-			if v == "kube-apiserver" {
+			if v == label {
 				return true, nil
 			}
 		}
@@ -138,3 +139,13 @@ func (c *KubeletClient) IsManager() (bool, error) {
 
 	return false, nil
 }
+
+func (c *KubeletClient) IsManager() (bool, error) {
+	return c.hasPod("kube-apiserver")
+}
+
+// IsReady tells whether the node is part of a cluster, which is when
+// kube-proxy gets scheduled on it.
+func (c *KubeletClient) IsReady() (bool, error) {
+	return c.hasPod("kube-proxy")
+}
@@ -7,7 +7,9 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	lru "github.com/hashicorp/golang-lru"
@@ -24,6 +26,7 @@ type DinD struct {
 	storage   storage.StorageApi
 	generator id.Generator
 	cache     *lru.Cache
+	warmHosts *HostRegistry
 }
 
 func NewDinD(generator id.Generator, f docker.FactoryApi, s storage.StorageApi) *DinD {
@@ -31,6 +34,31 @@ func NewDinD(generator id.Generator, f docker.FactoryApi, s storage.StorageApi)
 	return &DinD{generator: generator, factory: f, storage: s, cache: c}
 }
 
+// PlaygroundResources returns the resource limits of the instances of a
+// playground. The ones it leaves empty are taken from the APPARMOR_PROFILE,
+// STORAGE_SIZE, MAX_PROCESSES and MAX_MEMORY_MB env vars, which set them for
+// every playground before playgrounds had their own.
+func PlaygroundResources(playground *types.Playground) types.ResourceLimits {
+	l := playground.Resources
+	if l.AppArmorProfile == "" {
+		l.AppArmorProfile = os.Getenv("APPARMOR_PROFILE")
+	}
+	if l.StorageSize == "" {
+		l.StorageSize = os.Getenv("STORAGE_SIZE")
+	}
+	if l.PidsLimit <= 0 {
+		if i, err := strconv.ParseInt(os.Getenv("MAX_PROCESSES"), 10, 64); err == nil {
+			l.PidsLimit = i
+		}
+	}
+	if l.MemoryMB <= 0 {
+		if i, err := strconv.ParseInt(os.Getenv("MAX_MEMORY_MB"), 10, 64); err == nil {
+			l.MemoryMB = i
+		}
+	}
+	return l
+}
+
 func checkHostnameExists(sessionId, hostname string, instances []*types.Instance) bool {
 	exists := false
 	for _, instance := range instances {
@@ -43,11 +71,11 @@ func checkHostnameExists(sessionId, hostname string, instances []*types.Instance
 }
 
 func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error) {
+	playground, err := d.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return nil, err
+	}
 	if conf.ImageName == "" {
-		playground, err := d.storage.PlaygroundGet(session.PlaygroundId)
-		if err != nil {
-			return nil, err
-		}
 		conf.ImageName = playground.DefaultDinDInstanceImage
 	}
 	log.Printf("NewInstance - using image: [%s]\n", conf.ImageName)
@@ -86,14 +114,17 @@ func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*
 		Networks:       networks,
 		DindVolumeSize: conf.DindVolumeSize,
 		Envs:           conf.Envs,
+		Resources:      PlaygroundResources(playground).Bound(conf.Resources),
 	}
 
 	dockerClient, err := d.factory.GetForSession(session)
 	if err != nil {
 		return nil, err
 	}
-	if err := dockerClient.ContainerCreate(opts); err != nil {
-		return nil, err
+	if !warmEligible(playground, conf) || !d.claimWarmInstance(dockerClient, session, playground, containerName, conf.Hostname) {
+		if err := dockerClient.ContainerCreate(opts); err != nil {
+			return nil, err
+		}
 	}
 
 	ips, err := dockerClient.ContainerIPs(containerName)
@@ -116,6 +147,7 @@ func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*
 	instance.Tls = conf.Tls
 	instance.ProxyHost = router.EncodeHost(session.Id, instance.RoutableIP, router.HostOpts{})
 	instance.SessionHost = session.Host
+	instance.Resources = opts.Resources
 
 	return instance, nil
 }
@@ -0,0 +1,23 @@
+package provisioner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaygroundResources_EnvDefaults(t *testing.T) {
+	for k, v := range map[string]string{"APPARMOR_PROFILE": "docker-dind", "STORAGE_SIZE": "10G", "MAX_PROCESSES": "500", "MAX_MEMORY_MB": "1024"} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	l := PlaygroundResources(&types.Playground{})
+	assert.Equal(t, types.ResourceLimits{AppArmorProfile: "docker-dind", StorageSize: "10G", PidsLimit: 500, MemoryMB: 1024}, l)
+
+	// The playground's own limits win
+	l = PlaygroundResources(&types.Playground{Resources: types.ResourceLimits{MemoryMB: 2048, AppArmorProfile: "unconfined"}})
+	assert.Equal(t, types.ResourceLimits{AppArmorProfile: "unconfined", StorageSize: "10G", PidsLimit: 500, MemoryMB: 2048}, l)
+}
@@ -15,13 +15,27 @@ import (
 
 type overlaySessionProvisioner struct {
 	dockerFactory docker.FactoryApi
+	placement     *Placement
 }
 
 func NewOverlaySessionProvisioner(df docker.FactoryApi) SessionProvisionerApi {
 	return &overlaySessionProvisioner{dockerFactory: df}
 }
 
+// NewOverlaySessionProvisionerWithPlacement creates sessions on the docker
+// host placement picks for them instead of the local one.
+func NewOverlaySessionProvisionerWithPlacement(df docker.FactoryApi, placement *Placement) SessionProvisionerApi {
+	return &overlaySessionProvisioner{dockerFactory: df, placement: placement}
+}
+
 func (p *overlaySessionProvisioner) SessionNew(ctx context.Context, s *types.Session) error {
+	if p.placement != nil && s.DockerHost == "" {
+		host, err := p.placement.Place(s)
+		if err != nil {
+			return err
+		}
+		s.DockerHost = host
+	}
 	dockerClient, err := p.dockerFactory.GetForSession(s)
 	if err != nil {
 		// We assume we are out of capacity
@@ -0,0 +1,308 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+const (
+	// hostRefreshInterval is how long the capacity of a docker host is
+	// trusted before asking its daemon again.
+	hostRefreshInterval = 30 * time.Second
+	// hostRefreshTimeout is how long a docker host has to report its
+	// capacity before it's taken as unreachable.
+	hostRefreshTimeout = 5 * time.Second
+	// pendingPlacementTTL is how long a placed session is counted before it
+	// shows up in storage. Sessions that take longer failed to start.
+	pendingPlacementTTL = time.Minute
+)
+
+// DockerHost is a docker daemon sessions can be placed on, along with its
+// capacity.
+type DockerHost struct {
+	// Addr is the address of the daemon, like tcp://10.0.0.2:2375. Empty is
+	// the local daemon.
+	Addr              string
+	NCPU              int
+	MemTotal          int64
+	ContainersRunning int
+	Sessions          int
+	// MemReserved is the memory the sessions on the host are expected to
+	// use.
+	MemReserved int64
+	Reachable   bool
+	UpdatedAt   time.Time
+}
+
+func (h *DockerHost) MemFree() int64 {
+	return h.MemTotal - h.MemReserved
+}
+
+// HostRegistry keeps the docker hosts sessions can be placed on and how full
+// they are.
+type HostRegistry struct {
+	mx      sync.Mutex
+	hosts   []*DockerHost
+	pending map[string]pendingPlacement
+	factory docker.FactoryApi
+	storage storage.StorageApi
+	// refreshMx makes concurrent placements wait for the refresh in flight
+	// rather than start their own.
+	refreshMx      sync.Mutex
+	refreshTimeout time.Duration
+}
+
+type pendingPlacement struct {
+	addr string
+	at   time.Time
+}
+
+func NewHostRegistry(addrs []string, f docker.FactoryApi, s storage.StorageApi) *HostRegistry {
+	if len(addrs) == 0 {
+		addrs = []string{""}
+	}
+	r := &HostRegistry{pending: map[string]pendingPlacement{}, factory: f, storage: s, refreshTimeout: hostRefreshTimeout}
+	for _, addr := range addrs {
+		r.hosts = append(r.hosts, &DockerHost{Addr: addr})
+	}
+	return r
+}
+
+// refresh asks the daemons whose capacity is older than hostRefreshInterval
+// for it again. Daemons are asked without holding r.mx, and the ones that
+// don't answer within refreshTimeout are marked unreachable.
+func (r *HostRegistry) refresh(now time.Time) {
+	r.refreshMx.Lock()
+	defer r.refreshMx.Unlock()
+
+	r.mx.Lock()
+	stale := []*DockerHost{}
+	for _, h := range r.hosts {
+		if now.Sub(h.UpdatedAt) >= hostRefreshInterval {
+			stale = append(stale, h)
+		}
+	}
+	r.mx.Unlock()
+	if len(stale) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.refreshTimeout)
+	defer cancel()
+	infos := make([]*dtypes.Info, len(stale))
+	var wg sync.WaitGroup
+	for i, h := range stale {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			infos[i] = r.daemonInfo(ctx, addr)
+		}(i, h.Addr)
+	}
+	wg.Wait()
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for i, h := range stale {
+		h.UpdatedAt = now
+		h.Reachable = infos[i] != nil
+		if infos[i] != nil {
+			h.NCPU = infos[i].NCPU
+			h.MemTotal = infos[i].MemTotal
+			h.ContainersRunning = infos[i].ContainersRunning
+		}
+	}
+}
+
+// daemonInfo returns the info of the daemon at addr, or nil when it can't be
+// had before ctx is done.
+func (r *HostRegistry) daemonInfo(ctx context.Context, addr string) *dtypes.Info {
+	type result struct {
+		info dtypes.Info
+		err  error
+	}
+	// Buffered so the call can finish after ctx is done
+	c := make(chan result, 1)
+	go func() {
+		dockerClient, err := r.factory.GetForHost(addr)
+		if err != nil {
+			c <- result{err: fmt.Errorf("Could not connect to docker host [%s]. Got: %v", addr, err)}
+			return
+		}
+		info, err := dockerClient.DaemonInfo()
+		if err != nil {
+			err = fmt.Errorf("Could not get info of docker host [%s]. Got: %v", addr, err)
+		}
+		c <- result{info: info, err: err}
+	}()
+
+	select {
+	case res := <-c:
+		if res.err != nil {
+			log.Println(res.err)
+			return nil
+		}
+		return &res.info
+	case <-ctx.Done():
+		log.Printf("Docker host [%s] didn't report its info in time\n", addr)
+		return nil
+	}
+}
+
+// countSessions updates how many sessions each host has, including the ones
+// placed but not stored yet. Must be called with r.mx held.
+func (r *HostRegistry) countSessions(now time.Time) error {
+	sessions, err := r.storage.SessionGetAll()
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, s := range sessions {
+		counts[s.DockerHost]++
+		delete(r.pending, s.Id)
+	}
+	for id, p := range r.pending {
+		if now.Sub(p.at) > pendingPlacementTTL {
+			delete(r.pending, id)
+			continue
+		}
+		counts[p.addr]++
+	}
+	for _, h := range r.hosts {
+		h.Sessions = counts[h.Addr]
+	}
+	return nil
+}
+
+// Hosts returns a copy of the registered docker hosts as they were last seen.
+func (r *HostRegistry) Hosts() []DockerHost {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	hosts := make([]DockerHost, len(r.hosts))
+	for i, h := range r.hosts {
+		hosts[i] = *h
+	}
+	return hosts
+}
+
+// PlacementStrategy picks the docker host a new session goes to out of the
+// ones with room left, which are never empty.
+type PlacementStrategy interface {
+	Pick(hosts []*DockerHost) *DockerHost
+}
+
+// LeastSessions spreads sessions evenly across hosts.
+type LeastSessions struct{}
+
+func (LeastSessions) Pick(hosts []*DockerHost) *DockerHost {
+	picked := hosts[0]
+	for _, h := range hosts[1:] {
+		if h.Sessions < picked.Sessions {
+			picked = h
+		}
+	}
+	return picked
+}
+
+// LeastMemory picks the host with the most free memory.
+type LeastMemory struct{}
+
+func (LeastMemory) Pick(hosts []*DockerHost) *DockerHost {
+	picked := hosts[0]
+	for _, h := range hosts[1:] {
+		if h.MemFree() > picked.MemFree() {
+			picked = h
+		}
+	}
+	return picked
+}
+
+// BinPacking fills up hosts one at a time, so the ones left empty can be
+// shut down.
+type BinPacking struct{}
+
+func (BinPacking) Pick(hosts []*DockerHost) *DockerHost {
+	picked := hosts[0]
+	for _, h := range hosts[1:] {
+		if h.Sessions > picked.Sessions || (h.Sessions == picked.Sessions && h.MemFree() < picked.MemFree()) {
+			picked = h
+		}
+	}
+	return picked
+}
+
+func ParsePlacementStrategy(name string) (PlacementStrategy, error) {
+	switch name {
+	case "least-sessions":
+		return LeastSessions{}, nil
+	case "least-memory":
+		return LeastMemory{}, nil
+	case "bin-packing":
+		return BinPacking{}, nil
+	}
+	return nil, fmt.Errorf("Unknown placement strategy %s", name)
+}
+
+// Placement decides which docker host each new session goes to.
+type Placement struct {
+	registry *HostRegistry
+	strategy PlacementStrategy
+	// maxSessions is how many sessions a host takes at most and
+	// sessionMemory how many bytes of memory each one is expected to use. 0
+	// means no limit.
+	maxSessions   int
+	sessionMemory int64
+}
+
+func NewPlacement(r *HostRegistry, strategy PlacementStrategy, maxSessions int, sessionMemory int64) *Placement {
+	return &Placement{registry: r, strategy: strategy, maxSessions: maxSessions, sessionMemory: sessionMemory}
+}
+
+func (p *Placement) full(h *DockerHost) bool {
+	if !h.Reachable {
+		return true
+	}
+	if p.maxSessions > 0 && h.Sessions >= p.maxSessions {
+		return true
+	}
+	return p.sessionMemory > 0 && h.MemFree() < p.sessionMemory
+}
+
+// Place picks the docker host of the session and returns its address. It
+// returns OutOfCapacityError when every host is full.
+func (p *Placement) Place(session *types.Session) (string, error) {
+	r := p.registry
+	now := time.Now()
+	r.refresh(now)
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if err := r.countSessions(now); err != nil {
+		return "", err
+	}
+
+	available := []*DockerHost{}
+	for _, h := range r.hosts {
+		h.MemReserved = int64(h.Sessions) * p.sessionMemory
+		if !p.full(h) {
+			available = append(available, h)
+		}
+	}
+	if len(available) == 0 {
+		return "", OutOfCapacityError
+	}
+
+	h := p.strategy.Pick(available)
+	r.pending[session.Id] = pendingPlacement{addr: h.Addr, at: now}
+	log.Printf("Placed session [%s] on docker host [%s]\n", session.Id, h.Addr)
+	return h.Addr, nil
+}
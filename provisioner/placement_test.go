@@ -0,0 +1,100 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlacementStrategies(t *testing.T) {
+	hosts := func() []*DockerHost {
+		return []*DockerHost{
+			{Addr: "a", Sessions: 3, MemTotal: 8 << 30, MemReserved: 3 << 30},
+			{Addr: "b", Sessions: 1, MemTotal: 2 << 30, MemReserved: 1 << 30},
+			{Addr: "c", Sessions: 3, MemTotal: 4 << 30, MemReserved: 3 << 30},
+		}
+	}
+
+	assert.Equal(t, "b", LeastSessions{}.Pick(hosts()).Addr)
+	assert.Equal(t, "a", LeastMemory{}.Pick(hosts()).Addr)
+	assert.Equal(t, "c", BinPacking{}.Pick(hosts()).Addr)
+
+	_, err := ParsePlacementStrategy("random")
+	assert.NotNil(t, err)
+}
+
+func TestPlacement_Place(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_a := &docker.Mock{}
+	_b := &docker.Mock{}
+
+	_f.On("GetForHost", "tcp://a:2375").Return(_a, nil)
+	_f.On("GetForHost", "tcp://b:2375").Return(_b, nil)
+	_f.On("GetForHost", "tcp://c:2375").Return(_b, fmt.Errorf("unreachable"))
+	_a.On("DaemonInfo").Return(dtypes.Info{NCPU: 4, MemTotal: 4 << 30}, nil)
+	_b.On("DaemonInfo").Return(dtypes.Info{NCPU: 4, MemTotal: 4 << 30}, nil)
+	_s.On("SessionGetAll").Return([]*types.Session{{Id: "s1", DockerHost: "tcp://a:2375"}}, nil)
+
+	r := NewHostRegistry([]string{"tcp://a:2375", "tcp://b:2375", "tcp://c:2375"}, _f, _s)
+	p := NewPlacement(r, LeastSessions{}, 2, 1<<30)
+
+	host, err := p.Place(&types.Session{Id: "s2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://b:2375", host)
+
+	// s2 isn't stored yet but still counts
+	host, err = p.Place(&types.Session{Id: "s3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://a:2375", host)
+
+	host, err = p.Place(&types.Session{Id: "s4"})
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://b:2375", host)
+
+	_, err = p.Place(&types.Session{Id: "s5"})
+	assert.True(t, OutOfCapacity(err))
+
+	hosts := r.Hosts()
+	assert.Equal(t, 2, hosts[0].Sessions)
+	assert.Equal(t, 2, hosts[1].Sessions)
+	assert.False(t, hosts[2].Reachable)
+
+	_s.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_a.AssertExpectations(t)
+	_b.AssertExpectations(t)
+}
+
+func TestPlacement_SlowHost(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_a := &docker.Mock{}
+	_b := &docker.Mock{}
+
+	release := make(chan time.Time)
+	defer close(release)
+	_f.On("GetForHost", "tcp://a:2375").Return(_a, nil)
+	_f.On("GetForHost", "tcp://b:2375").Return(_b, nil)
+	_a.On("DaemonInfo").Return(dtypes.Info{NCPU: 4, MemTotal: 4 << 30}, nil)
+	_b.On("DaemonInfo").WaitUntil(release).Return(dtypes.Info{NCPU: 4, MemTotal: 4 << 30}, nil)
+	_s.On("SessionGetAll").Return([]*types.Session{}, nil)
+
+	r := NewHostRegistry([]string{"tcp://a:2375", "tcp://b:2375"}, _f, _s)
+	r.refreshTimeout = 50 * time.Millisecond
+	p := NewPlacement(r, LeastMemory{}, 0, 0)
+
+	host, err := p.Place(&types.Session{Id: "s1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://a:2375", host)
+
+	hosts := r.Hosts()
+	assert.True(t, hosts[0].Reachable)
+	assert.False(t, hosts[1].Reachable)
+}
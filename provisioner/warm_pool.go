@@ -0,0 +1,206 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+const (
+	// WarmNetwork is the network idle warm instances wait on until a session
+	// claims them. Their container names start with it too.
+	WarmNetwork = "pwd_warm"
+
+	warmPlaygroundLabel = "pwd.warm.playground"
+	warmImageLabel      = "pwd.warm.image"
+)
+
+func warmVolumeSize(playground *types.Playground) string {
+	if len(playground.DindVolumeSize) > 0 {
+		return playground.DindVolumeSize
+	}
+	return "5G"
+}
+
+// warmEligible tells whether an instance can be served from the warm pool.
+// Warm instances are created before knowing the session they'll end up in, so
+// only instances that need nothing but what the playground defines can.
+// Their container env says SESSION_ID=pwd_warm for good, see
+// attachWarmInstance.
+func warmEligible(playground *types.Playground, conf types.InstanceConfig) bool {
+	return playground.WarmPoolSize > 0 &&
+		conf.ImageName == playground.DefaultDinDInstanceImage &&
+		conf.PlaygroundFQDN == playground.Domain &&
+		conf.Privileged == playground.Privileged &&
+		conf.DindVolumeSize == warmVolumeSize(playground) &&
+		len(conf.ServerCert) == 0 && len(conf.ServerKey) == 0 && len(conf.CACert) == 0 &&
+		len(conf.Envs) == 0 && conf.Resources == (types.ResourceLimits{}) &&
+		(!config.Unsafe || len(conf.Networks) == 0)
+}
+
+// warmInstances returns the idle warm instances of the playground. Claimed
+// ones keep their labels but not their name.
+func warmInstances(dockerClient docker.DockerApi, labels map[string]string) ([]string, error) {
+	names, err := dockerClient.ContainerList(labels)
+	if err != nil {
+		return nil, err
+	}
+	idle := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, WarmNetwork+"_") {
+			idle = append(idle, name)
+		}
+	}
+	return idle, nil
+}
+
+// claimWarmInstance moves an idle warm instance of the playground into the
+// session, naming it containerName. It returns false when there's none left.
+func (d *DinD) claimWarmInstance(dockerClient docker.DockerApi, session *types.Session, playground *types.Playground, containerName, hostname string) bool {
+	names, err := warmInstances(dockerClient, map[string]string{warmPlaygroundLabel: playground.Id, warmImageLabel: playground.DefaultDinDInstanceImage})
+	if err != nil {
+		log.Printf("Error listing warm instances of playground %s. Got: %v\n", playground.Id, err)
+		return false
+	}
+	for _, name := range names {
+		// Renaming fails if another session claimed it first
+		if err := dockerClient.ContainerRename(name, containerName); err != nil {
+			continue
+		}
+		if err := attachWarmInstance(dockerClient, session, containerName, hostname); err != nil {
+			log.Printf("Error attaching warm instance %s to session %s. Got: %v\n", name, session.Id, err)
+			dockerClient.ContainerDelete(containerName)
+			return false
+		}
+		log.Printf("Claimed warm instance %s as %s\n", name, containerName)
+		return true
+	}
+	return false
+}
+
+func attachWarmInstance(dockerClient docker.DockerApi, session *types.Session, containerName, hostname string) error {
+	if _, err := dockerClient.NetworkConnect(containerName, session.Id, ""); err != nil {
+		return err
+	}
+	if err := dockerClient.NetworkDisconnect(containerName, WarmNetwork); err != nil {
+		return err
+	}
+	// The container keeps the SESSION_ID env var it was created with, which
+	// is WarmNetwork, as docker can't change it. Login shells get the right
+	// one from /etc/profile.d, anything reading the container env doesn't.
+	script := fmt.Sprintf("hostname %[1]s && echo %[1]s > /etc/hostname && echo 'export SESSION_ID=%[2]s' > /etc/profile.d/pwd_session.sh", hostname, session.Id)
+	code, err := dockerClient.Exec(containerName, []string{"sh", "-c", script})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("Setting up hostname exited with %d", code)
+	}
+	return nil
+}
+
+// WarmPoolHosts makes the warm pool of every playground be kept on each host
+// of the registry, as sessions can be placed on any of them. Without it the
+// pool only lives on the local daemon.
+func (d *DinD) WarmPoolHosts(r *HostRegistry) {
+	d.warmHosts = r
+}
+
+// FillWarmPool creates the warm instances the playground is missing on every
+// docker host and removes the ones of an image it doesn't default to anymore.
+// Hosts that were unreachable last time placement looked are skipped.
+func (d *DinD) FillWarmPool(ctx context.Context, playground *types.Playground) error {
+	addrs := []string{""}
+	if d.warmHosts != nil {
+		addrs = []string{}
+		for _, h := range d.warmHosts.Hosts() {
+			if !h.UpdatedAt.IsZero() && !h.Reachable {
+				continue
+			}
+			addrs = append(addrs, h.Addr)
+		}
+	}
+
+	var firstErr error
+	for _, addr := range addrs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := d.fillWarmPool(ctx, addr, playground); err != nil {
+			log.Printf("Error filling warm pool of playground %s on docker host [%s]. Got: %v\n", playground.Id, addr, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (d *DinD) fillWarmPool(ctx context.Context, addr string, playground *types.Playground) error {
+	dockerClient, err := d.factory.GetForHost(addr)
+	if err != nil {
+		return err
+	}
+
+	all, err := warmInstances(dockerClient, map[string]string{warmPlaygroundLabel: playground.Id})
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{warmPlaygroundLabel: playground.Id, warmImageLabel: playground.DefaultDinDInstanceImage}
+	current, err := warmInstances(dockerClient, labels)
+	if err != nil {
+		return err
+	}
+	stale := map[string]bool{}
+	for _, name := range all {
+		stale[name] = true
+	}
+	for _, name := range current {
+		delete(stale, name)
+	}
+	for name := range stale {
+		log.Printf("Removing stale warm instance %s\n", name)
+		if err := dockerClient.ContainerDelete(name); err != nil {
+			log.Printf("Error removing stale warm instance %s. Got: %v\n", name, err)
+		}
+	}
+
+	missing := playground.WarmPoolSize - len(current)
+	if missing <= 0 {
+		return nil
+	}
+	if _, err := dockerClient.NetworkInspect(WarmNetwork); err != nil {
+		if err := dockerClient.NetworkCreate(WarmNetwork, dtypes.NetworkCreate{Driver: "overlay", Attachable: true}); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < missing; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		opts := docker.CreateContainerOpts{
+			Image:          playground.DefaultDinDInstanceImage,
+			SessionId:      WarmNetwork,
+			ContainerName:  fmt.Sprintf("%s_%s", WarmNetwork, d.generator.NewId()),
+			Hostname:       "node",
+			HostFQDN:       playground.Domain,
+			Privileged:     playground.Privileged,
+			Labels:         labels,
+			Networks:       []string{WarmNetwork},
+			DindVolumeSize: warmVolumeSize(playground),
+			Resources:      PlaygroundResources(playground),
+		}
+		if err := dockerClient.ContainerCreate(opts); err != nil {
+			return fmt.Errorf("Could not create warm instance for playground %s. Got: %v", playground.Id, err)
+		}
+	}
+	log.Printf("Created %d warm instances for playground %s on docker host [%s]\n", missing, playground.Id, addr)
+	return nil
+}
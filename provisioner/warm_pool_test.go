@@ -0,0 +1,49 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFillWarmPool_EveryHost(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_a := &docker.Mock{}
+	_b := &docker.Mock{}
+
+	playground := &types.Playground{Id: "foobar", Domain: "localhost", DefaultDinDInstanceImage: "franela/dind", WarmPoolSize: 1}
+	all := map[string]string{warmPlaygroundLabel: "foobar"}
+	current := map[string]string{warmPlaygroundLabel: "foobar", warmImageLabel: "franela/dind"}
+
+	_f.On("GetForHost", "tcp://a:2375").Return(_a, nil)
+	_f.On("GetForHost", "tcp://b:2375").Return(_b, nil)
+	_a.On("ContainerList", all).Return([]string{"pwd_warm_1"}, nil)
+	_a.On("ContainerList", current).Return([]string{"pwd_warm_1"}, nil)
+	_b.On("ContainerList", all).Return([]string{}, nil)
+	_b.On("ContainerList", current).Return([]string{}, nil)
+	_b.On("NetworkInspect", WarmNetwork).Return(dtypes.NetworkResource{}, nil)
+	_g.On("NewId").Return("2")
+	_b.On("ContainerCreate", mock.MatchedBy(func(opts docker.CreateContainerOpts) bool {
+		return opts.ContainerName == "pwd_warm_2" && opts.Image == "franela/dind"
+	})).Return(nil)
+
+	d := NewDinD(_g, _f, _s)
+	d.WarmPoolHosts(NewHostRegistry([]string{"tcp://a:2375", "tcp://b:2375"}, _f, _s))
+
+	err := d.FillWarmPool(context.Background(), playground)
+	assert.Nil(t, err)
+
+	_f.AssertExpectations(t)
+	_a.AssertExpectations(t)
+	_b.AssertExpectations(t)
+	_g.AssertExpectations(t)
+}
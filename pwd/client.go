@@ -4,25 +4,48 @@ import (
 	"log"
 	"time"
 
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
 )
 
 func (p *pwd) ClientNew(id string, session *types.Session) *types.Client {
 	defer observeAction("ClientNew", time.Now())
 	c := &types.Client{Id: id, SessionId: session.Id}
+	if config.ClientTTL > 0 {
+		c.ExpiresAt = time.Now().Add(config.ClientTTL)
+	}
 	if err := p.storage.ClientPut(c); err != nil {
 		log.Println("Error saving client", err)
 	}
 	return c
 }
 
+// clientUpdate changes a copy of the stored client with the given id and
+// saves it. Clients that were closed in the meantime stay closed.
+func (p *pwd) clientUpdate(id string, update func(c *types.Client)) error {
+	p.clientMx.Lock()
+	defer p.clientMx.Unlock()
+
+	stored, err := p.storage.ClientGet(id)
+	if err != nil {
+		return err
+	}
+	c := *stored
+	update(&c)
+	return p.storage.ClientPut(&c)
+}
+
 func (p *pwd) ClientResizeViewPort(c *types.Client, cols, rows uint) {
 	defer observeAction("ClientResizeViewPort", time.Now())
 	c.ViewPort.Rows = rows
 	c.ViewPort.Cols = cols
 
-	if err := p.storage.ClientPut(c); err != nil {
+	err := p.clientUpdate(c.Id, func(stored *types.Client) {
+		stored.ViewPort = c.ViewPort
+	})
+	if err != nil {
 		log.Println("Error saving client", err)
 		return
 	}
@@ -32,13 +55,53 @@ func (p *pwd) ClientResizeViewPort(c *types.Client, cols, rows uint) {
 func (p *pwd) ClientClose(client *types.Client) {
 	defer observeAction("ClientClose", time.Now())
 	// Client has disconnected. Remove from session and recheck terminal sizes.
-	if err := p.storage.ClientDelete(client.Id); err != nil {
+	p.clientMx.Lock()
+	err := p.storage.ClientDelete(client.Id)
+	p.clientMx.Unlock()
+	if err != nil {
 		log.Println("Error deleting client", err)
 		return
 	}
 	p.notifyClientSmallestViewPort(client.SessionId)
 }
 
+// ClientKeepAlive pushes the expiry of the client forward. Only the stored
+// client is updated, as c is shared with the goroutine serving its socket.
+func (p *pwd) ClientKeepAlive(c *types.Client) {
+	defer observeAction("ClientKeepAlive", time.Now())
+	if config.ClientTTL == 0 {
+		return
+	}
+	err := p.clientUpdate(c.Id, func(stored *types.Client) {
+		stored.ExpiresAt = time.Now().Add(config.ClientTTL)
+	})
+	if storage.NotFound(err) {
+		// Closed already, don't bring it back
+		return
+	} else if err != nil {
+		log.Println("Error saving client", err)
+	}
+}
+
+// ClientCloseExpired closes every client that stopped sending keep alives,
+// which happens when its websocket dies without a "close" message reaching
+// us. It returns how many clients were closed.
+func (p *pwd) ClientCloseExpired() (int, error) {
+	defer observeAction("ClientCloseExpired", time.Now())
+	clients, err := p.storage.ClientFindExpired(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range clients {
+		log.Printf("Client [%s] of session [%s] has expired\n", c.Id, c.SessionId)
+		p.ClientClose(c)
+	}
+	if len(clients) > 0 {
+		p.setGauges()
+	}
+	return len(clients), nil
+}
+
 func (p *pwd) ClientCount() int {
 	count, err := p.storage.ClientCount()
 	if err != nil {
@@ -63,5 +126,5 @@ func (p *pwd) notifyClientSmallestViewPort(sessionId string) {
 			log.Println("Error resizing terminal", err)
 		}
 	}
-	p.event.Emit(event.INSTANCE_VIEWPORT_RESIZE, sessionId, vp.Cols, vp.Rows)
+	event.EmitPayload(p.event, event.INSTANCE_VIEWPORT_RESIZE, sessionId, event.InstanceViewportResizePayload{Cols: vp.Cols, Rows: vp.Rows})
 }
@@ -135,6 +135,7 @@ func TestClientResizeViewPort(t *testing.T) {
 	assert.Nil(t, err)
 	client := p.ClientNew("foobar", session)
 	_s.On("ClientFindBySessionId", "aaaabbbbcccc").Return([]*types.Client{client}, nil)
+	_s.On("ClientGet", "foobar").Return(client, nil)
 
 	p.ClientResizeViewPort(client, 80, 24)
 
@@ -146,3 +147,59 @@ func TestClientResizeViewPort(t *testing.T) {
 	_g.AssertExpectations(t)
 	_e.M.AssertExpectations(t)
 }
+
+func TestClientCloseExpired(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(&id.MockGenerator{}, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	expired := &types.Client{Id: "foobar", SessionId: "aaaabbbbcccc", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	_s.On("ClientFindExpired", mock.AnythingOfType("time.Time")).Return([]*types.Client{expired}, nil)
+	_s.On("ClientDelete", "foobar").Return(nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil)
+	_s.On("ClientFindBySessionId", "aaaabbbbcccc").Return([]*types.Client{}, nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("InstanceCount").Return(0, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_e.M.On("Emit", event.INSTANCE_VIEWPORT_RESIZE, "aaaabbbbcccc", []interface{}{uint(80), uint(24)}).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	n, err := p.ClientCloseExpired()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	ttl := config.ClientTTL
+	config.ClientTTL = time.Minute
+	defer func() { config.ClientTTL = ttl }()
+
+	expiresAt := time.Now()
+	client := &types.Client{Id: "foobar", SessionId: "aaaabbbbcccc", ExpiresAt: expiresAt}
+	_s.On("ClientGet", "foobar").Return(&types.Client{Id: "foobar", SessionId: "aaaabbbbcccc", ExpiresAt: expiresAt}, nil)
+	var saved *types.Client
+	_s.On("ClientPut", mock.AnythingOfType("*types.Client")).Run(func(args mock.Arguments) {
+		saved = args.Get(0).(*types.Client)
+	}).Return(nil).Once()
+
+	p.ClientKeepAlive(client)
+	assert.True(t, saved.ExpiresAt.After(expiresAt))
+	// The client shared with its socket isn't touched
+	assert.Equal(t, expiresAt, client.ExpiresAt)
+
+	// Closed clients aren't brought back
+	_s.On("ClientGet", "closed").Return((*types.Client)(nil), storage.NotFoundError)
+	p.ClientKeepAlive(&types.Client{Id: "closed"})
+
+	_s.AssertExpectations(t)
+}
@@ -0,0 +1,131 @@
+package pwd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// cloneArchive is where the home directory of an instance is archived while
+// it's copied over to its clone.
+const cloneArchive = "/tmp/pwd-clone.tgz"
+
+var cloneArchiveScript = fmt.Sprintf(`tar -czf %s -C $HOME .`, cloneArchive)
+var cloneExtractScript = fmt.Sprintf(`tar -xzf %[1]s -C $HOME && rm %[1]s`, cloneArchive)
+
+// SessionClone creates a new session with the same instances as session:
+// same images, hostnames, types, TLS settings and swarm roles. When copyFiles
+// is set the home directory of every instance is copied over to its clone.
+func (p *pwd) SessionClone(ctx context.Context, session *types.Session, config types.SessionConfig, copyFiles bool) (*types.Session, error) {
+	defer observeAction("SessionClone", time.Now())
+
+	instances, err := p.storage.InstanceFindBySessionId(session.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	playground := config.Playground
+	sconf := SessionSetupConf{
+		PlaygroundFQDN: playground.Domain,
+		DindVolumeSize: "5G",
+		Privileged:     playground.Privileged,
+	}
+	if len(playground.DindVolumeSize) > 0 {
+		sconf.DindVolumeSize = playground.DindVolumeSize
+	}
+	for _, i := range instances {
+		conf := SessionSetupInstanceConf{
+			Image:      i.Image,
+			Hostname:   i.Hostname,
+			Type:       i.Type,
+			Tls:        i.Tls,
+			ServerCert: i.ServerCert,
+			ServerKey:  i.ServerKey,
+			CACert:     i.CACert,
+			Cert:       i.Cert,
+			Key:        i.Key,
+		}
+		if i.Type != "windows" {
+			dockerClient, err := p.dockerFactory.GetForInstance(i)
+			if err != nil {
+				return nil, err
+			}
+			conf.IsSwarmManager, conf.IsSwarmWorker, err = docker.SwarmRole(dockerClient)
+			if err != nil {
+				return nil, fmt.Errorf("Could not get swarm status of instance %s. Got: %v", i.Name, err)
+			}
+		}
+		sconf.Instances = append(sconf.Instances, conf)
+	}
+
+	s, err := p.SessionNew(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.SessionSetup(s, sconf)
+	if err == nil && copyFiles {
+		err = p.cloneFiles(s, instances)
+	}
+	if err != nil {
+		log.Printf("Could not clone session [%s]. Got: %v\n", session.Id, err)
+		if err := p.SessionClose(s); err != nil {
+			log.Printf("Could not close session %s. Got: %v\n", s.Id, err)
+		}
+		return nil, err
+	}
+
+	log.Printf("Cloned session [%s] into session [%s]\n", session.Id, s.Id)
+	return s, nil
+}
+
+// cloneFiles copies the home directory of every non windows instance in
+// instances to the instance with the same hostname in session.
+func (p *pwd) cloneFiles(session *types.Session, instances []*types.Instance) error {
+	clones, err := p.storage.InstanceFindBySessionId(session.Id)
+	if err != nil {
+		return err
+	}
+	byHostname := map[string]*types.Instance{}
+	for _, c := range clones {
+		byHostname[c.Hostname] = c
+	}
+
+	for _, i := range instances {
+		clone, found := byHostname[i.Hostname]
+		if i.Type == "windows" || !found {
+			continue
+		}
+		if code, err := p.InstanceExec(i, []string{"sh", "-c", cloneArchiveScript}); err != nil {
+			return err
+		} else if code != 0 {
+			return fmt.Errorf("Archiving home of instance %s exited with %d", i.Name, code)
+		}
+		err := p.copyArchive(i, clone)
+		p.InstanceExec(i, []string{"rm", "-f", cloneArchive})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pwd) copyArchive(from, to *types.Instance) error {
+	r, err := p.InstanceFile(from, cloneArchive)
+	if err != nil {
+		return fmt.Errorf("Could not read home archive of instance %s. Got: %v", from.Name, err)
+	}
+	if err := p.InstanceUploadFromReader(to, "pwd-clone.tgz", "/tmp", r); err != nil {
+		return fmt.Errorf("Could not upload home archive to instance %s. Got: %v", to.Name, err)
+	}
+	if code, err := p.InstanceExec(to, []string{"sh", "-c", cloneExtractScript}); err != nil {
+		return err
+	} else if code != 0 {
+		return fmt.Errorf("Extracting home of instance %s exited with %d", to.Name, code)
+	}
+	return nil
+}
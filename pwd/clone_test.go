@@ -0,0 +1,95 @@
+package pwd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSessionClone(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	playground := &types.Playground{Id: "foobar"}
+	source := &types.Session{Id: "ccccddddeeee", PlaygroundId: "foobar"}
+	node1 := &types.Instance{Name: "ccccdddd_node1", Hostname: "node1", Image: "franela/dind", SessionId: source.Id}
+	clone := &types.Instance{Name: "aaaabbbb_aaaabbbbcccc", Hostname: "node1", Image: "franela/dind", SessionId: "aaaabbbbcccc", IP: "10.0.0.1"}
+	session := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+
+	_s.On("InstanceFindBySessionId", source.Id).Return([]*types.Instance{node1}, nil)
+	_f.On("GetForInstance", node1).Return(_d, nil)
+	_d.On("DaemonInfo").Return(dtypes.Info{Swarm: swarm.Info{LocalNodeState: swarm.LocalNodeStateActive, ControlAvailable: true}}, nil)
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
+	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
+	_d.On("DaemonHost").Return("localhost")
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(0, nil)
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("SessionGet", "aaaabbbbcccc").Return(session, nil)
+	_s.On("SessionGet", source.Id).Return(source, nil)
+
+	var nilArgs []interface{}
+	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
+
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil).Once()
+	_d.On("ContainerCreate", docker.CreateContainerOpts{
+		Image:          "franela/dind",
+		SessionId:      "aaaabbbbcccc",
+		ContainerName:  "aaaabbbb_aaaabbbbcccc",
+		Hostname:       "node1",
+		Networks:       []string{"aaaabbbbcccc"},
+		DindVolumeSize: "5G",
+	}).Return(nil)
+	_d.On("ContainerIPs", "aaaabbbb_aaaabbbbcccc").Return(map[string]string{"aaaabbbbcccc": "10.0.0.1"}, nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", []interface{}{"aaaabbbb_aaaabbbbcccc", "10.0.0.1", "node1", "ip10-0-0-1-aaaabbbbcccc"}).Return()
+	_f.On("GetForInstance", mock.AnythingOfType("*types.Instance")).Return(_d, nil)
+	_d.On("SwarmInit", "10.0.0.1").Return(&docker.SwarmTokens{Manager: "managerToken", Worker: "workerToken"}, nil)
+	_s.On("SessionSetupStatusPut", mock.AnythingOfType("*types.SessionSetupStatus")).Return(nil).Times(4)
+	_e.M.On("Emit", event.SESSION_SETUP_PROGRESS, "aaaabbbbcccc", mock.Anything).Return().Times(3)
+
+	archive := strings.NewReader("archive")
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{clone}, nil).Once()
+	_d.On("Exec", node1.Name, []string{"sh", "-c", cloneArchiveScript}).Return(0, nil)
+	_d.On("CopyFromContainer", node1.Name, cloneArchive).Return(archive, nil)
+	_d.On("CopyToContainer", clone.Name, "/tmp", "pwd-clone.tgz", archive).Return(nil)
+	_d.On("Exec", clone.Name, []string{"sh", "-c", cloneExtractScript}).Return(0, nil)
+	_d.On("Exec", node1.Name, []string{"rm", "-f", cloneArchive}).Return(0, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	s, err := p.SessionClone(context.Background(), source, types.SessionConfig{Playground: playground, Duration: time.Hour}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaabbbbcccc", s.Id)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
@@ -1,6 +1,7 @@
 package pwd
 
 import (
+	"bytes"
 	"io"
 	"log"
 	"net"
@@ -88,7 +89,7 @@ func (p *pwd) InstanceDelete(session *types.Session, instance *types.Instance) e
 		return err
 	}
 
-	p.event.Emit(event.INSTANCE_DELETE, session.Id, instance.Name)
+	event.EmitPayload(p.event, event.INSTANCE_DELETE, session.Id, event.InstanceDeletePayload{Name: instance.Name})
 
 	p.setGauges()
 
@@ -107,6 +108,15 @@ func (p *pwd) InstanceNew(session *types.Session, conf types.InstanceConfig) (*t
 		conf.Tls = true
 	}
 
+	if playground := p.PlaygroundGet(session.PlaygroundId); playground != nil {
+		release, err := p.reserveInstance(session, playground, &conf)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		defer release()
+	}
+
 	instance, err := prov.InstanceNew(session, conf)
 	if err != nil {
 		log.Println(err)
@@ -118,7 +128,7 @@ func (p *pwd) InstanceNew(session *types.Session, conf types.InstanceConfig) (*t
 		return nil, err
 	}
 
-	p.event.Emit(event.INSTANCE_NEW, session.Id, instance.Name, instance.IP, instance.Hostname, instance.ProxyHost)
+	event.EmitPayload(p.event, event.INSTANCE_NEW, session.Id, event.InstanceNewPayload{Name: instance.Name, IP: instance.IP, Hostname: instance.Hostname, ProxyHost: instance.ProxyHost})
 
 	p.setGauges()
 
@@ -140,6 +150,26 @@ func (p *pwd) InstanceExec(instance *types.Instance, cmd []string) (int, error)
 	return exitCode, nil
 }
 
+// instanceExecAttach runs cmd on the instance like InstanceExec, but also
+// returns what it printed. Output of windows instances isn't available.
+func (p *pwd) instanceExecAttach(instance *types.Instance, cmd []string) (int, string, error) {
+	if instance.Type == "windows" {
+		code, err := p.InstanceExec(instance, cmd)
+		return code, "", err
+	}
+
+	dockerClient, err := p.dockerFactory.GetForInstance(instance)
+	if err != nil {
+		return -1, "", err
+	}
+	var b bytes.Buffer
+	code, err := dockerClient.ExecAttach(instance.Name, cmd, &b)
+	if err != nil {
+		return -1, "", err
+	}
+	return code, b.String(), nil
+}
+
 func (p *pwd) InstanceFSTree(instance *types.Instance) (io.Reader, error) {
 	defer observeAction("InstanceFSTree", time.Now())
 
@@ -2,6 +2,7 @@ package pwd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -150,6 +151,8 @@ func TestInstanceNew_Privileged(t *testing.T) {
 
 	assert.Nil(t, err)
 
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
 	// Switch to unsafe mode in order to test custom networks below
 	//
 	// TODO: move config away from being a global in order that we don't
@@ -230,6 +233,8 @@ func TestInstanceNew_WithNotAllowedImage(t *testing.T) {
 
 	assert.Nil(t, err)
 
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
 	// Switch to unsafe mode in order to test custom networks below
 	//
 	// TODO: move config away from being a global in order that we don't
@@ -309,6 +314,8 @@ func TestInstanceNew_WithCustomHostname(t *testing.T) {
 	session, err := p.SessionNew(context.Background(), sConfig)
 	assert.Nil(t, err)
 
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
 	expectedInstance := types.Instance{
 		Name:        fmt.Sprintf("%s_aaaabbbbcccc", session.Id[:8]),
 		Hostname:    "redis-master",
@@ -348,3 +355,133 @@ func TestInstanceNew_WithCustomHostname(t *testing.T) {
 	_g.AssertExpectations(t)
 	_e.M.AssertExpectations(t)
 }
+
+func TestInstanceNew_WithResources(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
+	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
+	_d.On("DaemonHost").Return("localhost")
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(0, nil)
+
+	var nilArgs []interface{}
+	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	playground := &types.Playground{Id: "foobar", Resources: types.ResourceLimits{MemoryMB: 2048, PidsLimit: 500, AppArmorProfile: "docker-dind"}}
+	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
+	session, err := p.SessionNew(context.Background(), sConfig)
+	assert.Nil(t, err)
+
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
+	expectedInstance := types.Instance{
+		Name:        fmt.Sprintf("%s_aaaabbbbcccc", session.Id[:8]),
+		Hostname:    "redis-master",
+		IP:          "10.0.0.1",
+		RoutableIP:  "10.0.0.1",
+		Image:       "redis",
+		SessionHost: session.Host,
+		SessionId:   session.Id,
+		ProxyHost:   router.EncodeHost(session.Id, "10.0.0.1", router.HostOpts{}),
+		Resources:   types.ResourceLimits{MemoryMB: 2048, PidsLimit: 200, AppArmorProfile: "docker-dind"},
+	}
+	expectedContainerOpts := docker.CreateContainerOpts{
+		Image:         expectedInstance.Image,
+		SessionId:     session.Id,
+		ContainerName: expectedInstance.Name,
+		Hostname:      expectedInstance.Hostname,
+		ServerCert:    nil,
+		ServerKey:     nil,
+		CACert:        nil,
+		Privileged:    false,
+		Networks:      []string{session.Id},
+		Resources:     types.ResourceLimits{MemoryMB: 2048, PidsLimit: 200, AppArmorProfile: "docker-dind"},
+	}
+
+	_d.On("ContainerCreate", expectedContainerOpts).Return(nil)
+	_d.On("ContainerIPs", expectedInstance.Name).Return(map[string]string{session.Id: "10.0.0.1"}, nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", []interface{}{"aaaabbbb_aaaabbbbcccc", "10.0.0.1", "redis-master", "ip10-0-0-1-aaaabbbbcccc"}).Return()
+
+	instance, err := p.InstanceNew(session, types.InstanceConfig{ImageName: "redis", Hostname: "redis-master", Resources: types.ResourceLimits{MemoryMB: 4096, PidsLimit: 200, AppArmorProfile: "unconfined"}})
+
+	assert.Nil(t, err)
+
+	assert.Equal(t, expectedInstance, *instance)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestInstanceNew_FromWarmPool(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
+	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
+	_d.On("DaemonHost").Return("localhost")
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(0, nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil)
+
+	var nilArgs []interface{}
+	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	playground := &types.Playground{Id: "foobar", Domain: "localhost", DefaultDinDInstanceImage: "franela/dind", WarmPoolSize: 2}
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
+	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
+	session, err := p.SessionNew(context.Background(), sConfig)
+	assert.Nil(t, err)
+
+	// The first warm instance was claimed by somebody else
+	_d.On("ContainerList", map[string]string{"pwd.warm.playground": "foobar", "pwd.warm.image": "franela/dind"}).Return([]string{"pwd_warm_1", "pwd_warm_2", "aaaabbbb_claimed"}, nil)
+	_d.On("ContainerRename", "pwd_warm_1", "aaaabbbb_aaaabbbbcccc").Return(errors.New("No such container"))
+	_d.On("ContainerRename", "pwd_warm_2", "aaaabbbb_aaaabbbbcccc").Return(nil)
+	_d.On("NetworkConnect", "aaaabbbb_aaaabbbbcccc", session.Id, "").Return("10.0.0.1", nil)
+	_d.On("NetworkDisconnect", "aaaabbbb_aaaabbbbcccc", provisioner.WarmNetwork).Return(nil)
+	_d.On("Exec", "aaaabbbb_aaaabbbbcccc", []string{"sh", "-c", "hostname node1 && echo node1 > /etc/hostname && echo 'export SESSION_ID=aaaabbbbcccc' > /etc/profile.d/pwd_session.sh"}).Return(0, nil)
+	_d.On("ContainerIPs", "aaaabbbb_aaaabbbbcccc").Return(map[string]string{session.Id: "10.0.0.1"}, nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", []interface{}{"aaaabbbb_aaaabbbbcccc", "10.0.0.1", "node1", "ip10-0-0-1-aaaabbbbcccc"}).Return()
+
+	instance, err := p.InstanceNew(session, types.InstanceConfig{PlaygroundFQDN: "localhost", DindVolumeSize: "5G"})
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaabbbb_aaaabbbbcccc", instance.Name)
+	assert.Equal(t, "10.0.0.1", instance.IP)
+
+	_d.AssertNotCalled(t, "ContainerCreate", mock.Anything)
+	_d.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
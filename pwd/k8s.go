@@ -0,0 +1,109 @@
+package pwd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+const (
+	k8sPodNetworkCidr = "10.5.0.0/16"
+	// Pinned to a release so a change upstream can't break or take over
+	// every cluster
+	k8sNetworkAddon = "https://raw.githubusercontent.com/cloudnativelabs/kube-router/v1.5.1/daemonset/kubeadm-kuberouter.yaml"
+)
+
+var noK8sControlPlane = errors.New("K8s workers need a control plane to join")
+
+func NoK8sControlPlane(e error) bool {
+	return e == noK8sControlPlane
+}
+
+// k8sBootstrap bootstraps a kubeadm cluster out of the instances of a session
+// setup. The first control plane initializes the cluster and every other node
+// waits for it to join with the command it prints.
+type k8sBootstrap struct {
+	p *pwd
+	// ready is closed once the cluster is initialized.
+	ready chan struct{}
+	join  string
+	// certificateKey encrypts the control plane certificates uploaded to the
+	// cluster, which additional control planes need to join.
+	certificateKey string
+}
+
+func newK8sBootstrap(p *pwd) (*k8sBootstrap, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &k8sBootstrap{p: p, ready: make(chan struct{}), certificateKey: hex.EncodeToString(key)}, nil
+}
+
+// init runs kubeadm init on i and installs the pod network.
+func (b *k8sBootstrap) init(i *types.Instance) error {
+	initCmd := fmt.Sprintf("kubeadm init --apiserver-advertise-address %[1]s --control-plane-endpoint %[1]s:6443 --pod-network-cidr %s --upload-certs --certificate-key %s", i.IP, k8sPodNetworkCidr, b.certificateKey)
+	if _, err := b.p.instanceExecOutput(i, initCmd); err != nil {
+		log.Printf("Cannot initialize k8s cluster on instance %s. Got: %v\n", i.Name, err)
+		return err
+	}
+	if _, err := b.p.instanceExecOutput(i, "kubectl apply -f "+k8sNetworkAddon); err != nil {
+		log.Printf("Cannot install k8s pod network on instance %s. Got: %v\n", i.Name, err)
+		return err
+	}
+	out, err := b.p.instanceExecOutput(i, "kubeadm token create --print-join-command")
+	if err != nil {
+		log.Printf("Cannot create k8s join token on instance %s. Got: %v\n", i.Name, err)
+		return err
+	}
+	// The output has whatever else the kubeadm wrapper prints
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "kubeadm join") {
+			b.join = line
+		}
+	}
+	if b.join == "" {
+		return fmt.Errorf("Could not find k8s join command in output of instance %s: %s", i.Name, out)
+	}
+	close(b.ready)
+	return nil
+}
+
+// joinCluster joins i to the cluster once it's initialized, as a control plane
+// or as a worker.
+func (b *k8sBootstrap) joinCluster(ctx context.Context, i *types.Instance, controlPlane bool) error {
+	select {
+	case <-b.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	cmd := b.join
+	if controlPlane {
+		cmd = fmt.Sprintf("%s --control-plane --certificate-key %s --apiserver-advertise-address %s", cmd, b.certificateKey, i.IP)
+	}
+	if _, err := b.p.instanceExecOutput(i, cmd); err != nil {
+		log.Printf("Cannot join instance %s to k8s cluster. Got: %v\n", i.Name, err)
+		return err
+	}
+	return nil
+}
+
+// instanceExecOutput runs cmd in a shell on the instance and returns what it
+// printed.
+func (p *pwd) instanceExecOutput(i *types.Instance, cmd string) (string, error) {
+	code, out, err := p.instanceExecAttach(i, []string{"bash", "-c", cmd})
+	if err != nil {
+		return "", err
+	}
+	if code != 0 {
+		return out, fmt.Errorf("Command [%s] returned %d on instance %s", cmd, code, i.Name)
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package pwd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestK8sBootstrap(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	p := NewPWD(_f, &event.Mock{}, &storage.Mock{}, nil, nil)
+
+	cp1 := &types.Instance{Name: "aaaabbbb_cp1", IP: "10.0.0.1"}
+	cp2 := &types.Instance{Name: "aaaabbbb_cp2", IP: "10.0.0.2"}
+	worker := &types.Instance{Name: "aaaabbbb_worker", IP: "10.0.0.3"}
+
+	b, err := newK8sBootstrap(p)
+	assert.Nil(t, err)
+	assert.Len(t, b.certificateKey, 64)
+
+	join := "kubeadm join 10.0.0.1:6443 --token abc --discovery-token-ca-cert-hash sha256:123"
+	exec := func(i *types.Instance, cmd string, code int, out string) {
+		_d.On("ExecAttach", i.Name, []string{"bash", "-c", cmd}, mock.Anything).Run(func(args mock.Arguments) {
+			io.WriteString(args.Get(2).(io.Writer), out)
+		}).Return(code, nil)
+	}
+	_f.On("GetForInstance", mock.AnythingOfType("*types.Instance")).Return(_d, nil)
+	exec(cp1, fmt.Sprintf("kubeadm init --apiserver-advertise-address 10.0.0.1 --control-plane-endpoint 10.0.0.1:6443 --pod-network-cidr 10.5.0.0/16 --upload-certs --certificate-key %s", b.certificateKey), 0, "")
+	exec(cp1, "kubectl apply -f "+k8sNetworkAddon, 0, "")
+	exec(cp1, "kubeadm token create --print-join-command", 0, "RTNETLINK answers: File exists\r\n"+join+" \r\n")
+	exec(cp2, fmt.Sprintf("%s --control-plane --certificate-key %s --apiserver-advertise-address 10.0.0.2", join, b.certificateKey), 0, "")
+	exec(worker, join, 0, "")
+
+	done := make(chan error)
+	go func() {
+		done <- b.joinCluster(context.Background(), worker, false)
+	}()
+	assert.Nil(t, b.init(cp1))
+	assert.Nil(t, <-done)
+	assert.Nil(t, b.joinCluster(context.Background(), cp2, true))
+
+	// Nodes stop waiting when the setup fails elsewhere
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b, _ = newK8sBootstrap(p)
+	assert.Equal(t, context.Canceled, b.joinCluster(ctx, worker, false))
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+}
+
+func TestSessionSetup_NoK8sControlPlane(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	session := &types.Session{Id: "aaaabbbbcccc"}
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil)
+
+	err := p.SessionSetup(session, SessionSetupConf{Instances: []SessionSetupInstanceConf{{Hostname: "worker1", IsK8sWorker: true}}})
+	assert.True(t, NoK8sControlPlane(err))
+
+	_s.AssertExpectations(t)
+}
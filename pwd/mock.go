@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net"
+	"time"
 
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/stretchr/testify/mock"
@@ -43,6 +44,51 @@ func (m *Mock) SessionSetup(session *types.Session, conf SessionSetupConf) error
 	return args.Error(0)
 }
 
+func (m *Mock) SessionExtend(session *types.Session, duration time.Duration) error {
+	args := m.Called(session, duration)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionTouch(sessionId string) error {
+	args := m.Called(sessionId)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionSnapshot(session *types.Session, name string) (*types.Snapshot, error) {
+	args := m.Called(session, name)
+	return args.Get(0).(*types.Snapshot), args.Error(1)
+}
+
+func (m *Mock) SessionRestore(ctx context.Context, id string, config types.SessionConfig) (*types.Session, error) {
+	args := m.Called(ctx, id, config)
+	return args.Get(0).(*types.Session), args.Error(1)
+}
+
+func (m *Mock) SnapshotDelete(id, userId string) error {
+	args := m.Called(id, userId)
+	return args.Error(0)
+}
+
+func (m *Mock) SnapshotDeleteExpired() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *Mock) SessionClone(ctx context.Context, session *types.Session, config types.SessionConfig, copyFiles bool) (*types.Session, error) {
+	args := m.Called(ctx, session, config, copyFiles)
+	return args.Get(0).(*types.Session), args.Error(1)
+}
+
+func (m *Mock) SessionSetupTemplate(session *types.Session, template *types.SessionTemplate) error {
+	args := m.Called(session, template)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionSetupStatus(sessionId string) (*types.SessionSetupStatus, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).(*types.SessionSetupStatus), args.Error(1)
+}
+
 func (m *Mock) InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error) {
 	args := m.Called(session, conf)
 	return args.Get(0).(*types.Instance), args.Error(1)
@@ -110,6 +156,15 @@ func (m *Mock) ClientClose(client *types.Client) {
 	m.Called(client)
 }
 
+func (m *Mock) ClientKeepAlive(client *types.Client) {
+	m.Called(client)
+}
+
+func (m *Mock) ClientCloseExpired() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
 func (m *Mock) ClientCount() int {
 	args := m.Called()
 	return args.Int(0)
@@ -135,6 +190,11 @@ func (m *Mock) UserGet(id string) (*types.User, error) {
 	return args.Get(0).(*types.User), args.Error(1)
 }
 
+func (m *Mock) UserDeleteExpiredLoginRequests() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
 func (m *Mock) PlaygroundNew(playground types.Playground) (*types.Playground, error) {
 	args := m.Called(playground)
 	return args.Get(0).(*types.Playground), args.Error(1)
@@ -153,3 +213,23 @@ func (m *Mock) PlaygroundList() ([]*types.Playground, error) {
 	args := m.Called()
 	return args.Get(0).([]*types.Playground), args.Error(1)
 }
+
+func (m *Mock) TemplateSave(template *types.SessionTemplate) error {
+	args := m.Called(template)
+	return args.Error(0)
+}
+
+func (m *Mock) TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error) {
+	args := m.Called(playgroundId, name, version)
+	return args.Get(0).(*types.SessionTemplate), args.Error(1)
+}
+
+func (m *Mock) TemplateList(playgroundId string) ([]*types.SessionTemplate, error) {
+	args := m.Called(playgroundId)
+	return args.Get(0).([]*types.SessionTemplate), args.Error(1)
+}
+
+func (m *Mock) TemplateDelete(playgroundId, name string) error {
+	args := m.Called(playgroundId, name)
+	return args.Error(0)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/play-with-docker/play-with-docker/docker"
@@ -58,6 +59,26 @@ type pwd struct {
 	instanceProvisionerFactory provisioner.InstanceProvisionerFactoryApi
 	windowsProvisioner         provisioner.InstanceProvisionerApi
 	dindProvisioner            provisioner.InstanceProvisionerApi
+
+	activityMx sync.Mutex
+	// activity holds when the activity of each session was last written to
+	// storage.
+	activity map[string]time.Time
+
+	// clientMx serializes updates of stored clients, so keep alives and
+	// resizes don't undo each other or bring back closed clients.
+	clientMx sync.Mutex
+
+	quotaMx sync.Mutex
+	// pendingSessions are the sessions being created, which count towards
+	// the quotas of their playground before they're stored.
+	pendingSessions map[string]*types.Session
+	// pendingInstances are the instances being created, by reservation.
+	pendingInstances    map[int]pendingInstance
+	nextPendingInstance int
+
+	// templateMx serializes saving templates so versions aren't reused.
+	templateMx sync.Mutex
 }
 
 var sessionNotEmpty = errors.New("Session is not empty")
@@ -66,6 +87,12 @@ func SessionNotEmpty(e error) bool {
 	return e == sessionNotEmpty
 }
 
+var sessionNotExtendable = errors.New("Session cannot be extended any further")
+
+func SessionNotExtendable(e error) bool {
+	return e == sessionNotExtendable
+}
+
 type PWDApi interface {
 	SessionNew(ctx context.Context, config types.SessionConfig) (*types.Session, error)
 	SessionClose(session *types.Session) error
@@ -73,6 +100,15 @@ type PWDApi interface {
 	SessionDeployStack(session *types.Session) error
 	SessionGet(id string) (*types.Session, error)
 	SessionSetup(session *types.Session, conf SessionSetupConf) error
+	SessionExtend(session *types.Session, duration time.Duration) error
+	SessionTouch(sessionId string) error
+	SessionSnapshot(session *types.Session, name string) (*types.Snapshot, error)
+	SessionRestore(ctx context.Context, id string, config types.SessionConfig) (*types.Session, error)
+	SnapshotDelete(id, userId string) error
+	SnapshotDeleteExpired() (int, error)
+	SessionClone(ctx context.Context, session *types.Session, config types.SessionConfig, copyFiles bool) (*types.Session, error)
+	SessionSetupTemplate(session *types.Session, template *types.SessionTemplate) error
+	SessionSetupStatus(sessionId string) (*types.SessionSetupStatus, error)
 
 	InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error)
 	InstanceResizeTerminal(instance *types.Instance, cols, rows uint) error
@@ -89,22 +125,30 @@ type PWDApi interface {
 	ClientNew(id string, session *types.Session) *types.Client
 	ClientResizeViewPort(client *types.Client, cols, rows uint)
 	ClientClose(client *types.Client)
+	ClientKeepAlive(client *types.Client)
+	ClientCloseExpired() (int, error)
 	ClientCount() int
 
 	UserNewLoginRequest(providerName string) (*types.LoginRequest, error)
 	UserGetLoginRequest(id string) (*types.LoginRequest, error)
 	UserLogin(loginRequest *types.LoginRequest, user *types.User) (*types.User, error)
 	UserGet(id string) (*types.User, error)
+	UserDeleteExpiredLoginRequests() (int, error)
 
 	PlaygroundNew(playground types.Playground) (*types.Playground, error)
 	PlaygroundGet(id string) *types.Playground
 	PlaygroundFindByDomain(domain string) *types.Playground
 	PlaygroundList() ([]*types.Playground, error)
+
+	TemplateSave(template *types.SessionTemplate) error
+	TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error)
+	TemplateList(playgroundId string) ([]*types.SessionTemplate, error)
+	TemplateDelete(playgroundId, name string) error
 }
 
 func NewPWD(f docker.FactoryApi, e event.EventApi, s storage.StorageApi, sp provisioner.SessionProvisionerApi, ipf provisioner.InstanceProvisionerFactoryApi) *pwd {
 	//  windowsProvisioner: provisioner.NewWindowsASG(f, s), dindProvisioner: provisioner.NewDinD(f)
-	return &pwd{dockerFactory: f, event: e, storage: s, generator: id.XIDGenerator{}, sessionProvisioner: sp, instanceProvisionerFactory: ipf}
+	return &pwd{dockerFactory: f, event: e, storage: s, generator: id.XIDGenerator{}, sessionProvisioner: sp, instanceProvisionerFactory: ipf, activity: map[string]time.Time{}, pendingSessions: map[string]*types.Session{}, pendingInstances: map[int]pendingInstance{}}
 }
 
 func (p *pwd) getProvisioner(t string) (provisioner.InstanceProvisionerApi, error) {
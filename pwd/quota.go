@@ -0,0 +1,186 @@
+package pwd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+const (
+	QuotaSessionsPerUser = "max_sessions_per_user"
+	QuotaSessionsPerIP   = "max_sessions_per_ip"
+	QuotaSessions        = "max_sessions"
+	QuotaInstances       = "max_instances"
+	QuotaSessionMemory   = "max_session_memory"
+	QuotaSessionCPUs     = "max_session_cpus"
+)
+
+// QuotaExceededError is returned when creating a session or an instance would
+// go over one of the quotas of its playground. Reason is one of the Quota
+// constants.
+type QuotaExceededError struct {
+	Reason string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded: %s", e.Reason)
+}
+
+func QuotaExceeded(e error) (*QuotaExceededError, bool) {
+	var q *QuotaExceededError
+	if errors.As(e, &q) {
+		return q, true
+	}
+	return nil, false
+}
+
+func hasSessionQuotas(q types.Quotas) bool {
+	return q.MaxSessionsPerUser > 0 || q.MaxSessionsPerIP > 0 || q.MaxSessions > 0
+}
+
+// reserveSession checks the session quotas of the playground of s and, when
+// there's room left, counts s until releaseSession is called so sessions
+// being created at the same time can't go over them.
+func (p *pwd) reserveSession(s *types.Session, playground *types.Playground) error {
+	q := playground.Quotas
+	if !hasSessionQuotas(q) {
+		return nil
+	}
+
+	p.quotaMx.Lock()
+	defer p.quotaMx.Unlock()
+
+	sessions, err := p.storage.SessionGetAll()
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	var total, user, ip int
+	count := func(other *types.Session) {
+		if seen[other.Id] || other.PlaygroundId != s.PlaygroundId {
+			return
+		}
+		seen[other.Id] = true
+		total++
+		if s.UserId != "" && other.UserId == s.UserId {
+			user++
+		}
+		if s.SourceIP != "" && other.SourceIP == s.SourceIP {
+			ip++
+		}
+	}
+	for _, other := range sessions {
+		count(other)
+	}
+	for _, other := range p.pendingSessions {
+		count(other)
+	}
+
+	switch {
+	case q.MaxSessions > 0 && total >= q.MaxSessions:
+		return &QuotaExceededError{Reason: QuotaSessions}
+	case q.MaxSessionsPerUser > 0 && user >= q.MaxSessionsPerUser:
+		return &QuotaExceededError{Reason: QuotaSessionsPerUser}
+	case q.MaxSessionsPerIP > 0 && ip >= q.MaxSessionsPerIP:
+		return &QuotaExceededError{Reason: QuotaSessionsPerIP}
+	}
+	p.pendingSessions[s.Id] = s
+	return nil
+}
+
+func (p *pwd) releaseSession(s *types.Session) {
+	p.quotaMx.Lock()
+	defer p.quotaMx.Unlock()
+	delete(p.pendingSessions, s.Id)
+}
+
+// defaultInstanceShares is how many instances what's left of the memory and
+// CPU quotas of a session is split between when its playground doesn't bound
+// the number of instances.
+const defaultInstanceShares = 5
+
+// pendingInstance is an instance being created, which counts towards the
+// quotas of its session before it's stored.
+type pendingInstance struct {
+	sessionId string
+	resources types.ResourceLimits
+}
+
+// reserveInstance checks that an instance asking for conf fits in the quotas
+// of the session and, when it does, counts it until the returned function is
+// called so instances being created at the same time can't go over them.
+// Instances that don't ask for a memory or CPU limit, on a playground that
+// has none, get a share of what's left of the session's quotas, which is why conf is
+// updated.
+func (p *pwd) reserveInstance(session *types.Session, playground *types.Playground, conf *types.InstanceConfig) (func(), error) {
+	q := playground.Quotas
+	if playground.MaxInstances <= 0 && q.MaxSessionMemoryMB <= 0 && q.MaxSessionCPUs <= 0 {
+		return func() {}, nil
+	}
+
+	p.quotaMx.Lock()
+	defer p.quotaMx.Unlock()
+
+	instances, err := p.storage.InstanceFindBySessionId(session.Id)
+	if err != nil {
+		return nil, err
+	}
+	count := len(instances)
+	var memory int64
+	var cpus float64
+	for _, i := range instances {
+		memory += i.Resources.MemoryMB
+		cpus += i.Resources.CPUs
+	}
+	for _, i := range p.pendingInstances {
+		if i.sessionId == session.Id {
+			count++
+			memory += i.resources.MemoryMB
+			cpus += i.resources.CPUs
+		}
+	}
+	if playground.MaxInstances > 0 && count >= playground.MaxInstances {
+		return nil, &QuotaExceededError{Reason: QuotaInstances}
+	}
+
+	requested := provisioner.PlaygroundResources(playground).Bound(conf.Resources)
+	// What's left is split between the instances the session can still have
+	slots := defaultInstanceShares
+	if playground.MaxInstances > 0 {
+		slots = playground.MaxInstances - count
+	}
+	if q.MaxSessionMemoryMB > 0 {
+		left := q.MaxSessionMemoryMB - memory
+		if left <= 0 || requested.MemoryMB > left {
+			return nil, &QuotaExceededError{Reason: QuotaSessionMemory}
+		}
+		if requested.MemoryMB <= 0 {
+			requested.MemoryMB = left / int64(slots)
+			if requested.MemoryMB <= 0 {
+				requested.MemoryMB = left
+			}
+			conf.Resources.MemoryMB = requested.MemoryMB
+		}
+	}
+	if q.MaxSessionCPUs > 0 {
+		left := q.MaxSessionCPUs - cpus
+		if left <= 0 || requested.CPUs > left {
+			return nil, &QuotaExceededError{Reason: QuotaSessionCPUs}
+		}
+		if requested.CPUs <= 0 {
+			requested.CPUs = left / float64(slots)
+			conf.Resources.CPUs = requested.CPUs
+		}
+	}
+
+	id := p.nextPendingInstance
+	p.nextPendingInstance++
+	p.pendingInstances[id] = pendingInstance{sessionId: session.Id, resources: requested}
+	return func() {
+		p.quotaMx.Lock()
+		defer p.quotaMx.Unlock()
+		delete(p.pendingInstances, id)
+	}, nil
+}
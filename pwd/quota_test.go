@@ -0,0 +1,131 @@
+package pwd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionNew_QuotaExceeded(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_s.On("UserGet", "u1").Return(&types.User{Id: "u1"}, nil)
+	_s.On("SessionGetAll").Return([]*types.Session{
+		{Id: "s1", PlaygroundId: "foobar", UserId: "u1", SourceIP: "10.0.0.1"},
+		{Id: "s2", PlaygroundId: "foobar", UserId: "u2", SourceIP: "10.0.0.2"},
+		{Id: "s3", PlaygroundId: "other", UserId: "u1", SourceIP: "10.0.0.1"},
+	}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	playground := &types.Playground{Id: "foobar", Quotas: types.Quotas{MaxSessions: 3, MaxSessionsPerUser: 2, MaxSessionsPerIP: 1}}
+
+	_, err := p.SessionNew(context.Background(), types.SessionConfig{Playground: playground, UserId: "u1", Duration: time.Hour, SourceIP: "10.0.0.1"})
+	q, ok := QuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, QuotaSessionsPerIP, q.Reason)
+
+	// Sessions being created count too
+	p.pendingSessions["s4"] = &types.Session{Id: "s4", PlaygroundId: "foobar", UserId: "u3"}
+	_, err = p.SessionNew(context.Background(), types.SessionConfig{Playground: playground, UserId: "u1", Duration: time.Hour, SourceIP: "10.0.0.3"})
+	q, ok = QuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, QuotaSessions, q.Reason)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+}
+
+func TestReserveInstance(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	session := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{
+		{Name: "node1", Resources: types.ResourceLimits{MemoryMB: 1024, CPUs: 1}},
+		{Name: "node2", Resources: types.ResourceLimits{MemoryMB: 1024, CPUs: 0.5}},
+	}, nil)
+
+	playground := &types.Playground{Id: "foobar", MaxInstances: 3, Quotas: types.Quotas{MaxSessionMemoryMB: 3072, MaxSessionCPUs: 2}}
+
+	// Instances without limits get what's left
+	conf := types.InstanceConfig{}
+	release, err := p.reserveInstance(session, playground, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ResourceLimits{MemoryMB: 1024, CPUs: 0.5}, conf.Resources)
+
+	// Until released, the reserved instance counts
+	_, err = p.reserveInstance(session, playground, &types.InstanceConfig{})
+	q, ok := QuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, QuotaInstances, q.Reason)
+	release()
+
+	conf = types.InstanceConfig{Resources: types.ResourceLimits{MemoryMB: 2048}}
+	_, err = p.reserveInstance(session, playground, &conf)
+	q, ok = QuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, QuotaSessionMemory, q.Reason)
+
+	conf = types.InstanceConfig{Resources: types.ResourceLimits{CPUs: 1}}
+	_, err = p.reserveInstance(session, playground, &conf)
+	q, ok = QuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, QuotaSessionCPUs, q.Reason)
+
+	playground.MaxInstances = 2
+	_, err = p.reserveInstance(session, playground, &types.InstanceConfig{})
+	q, ok = QuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, QuotaInstances, q.Reason)
+
+	_s.AssertExpectations(t)
+}
+
+func TestReserveInstance_Share(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	session := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil)
+
+	// Without an instance count, what's left is split in defaultInstanceShares
+	playground := &types.Playground{Id: "foobar", Quotas: types.Quotas{MaxSessionMemoryMB: 5120, MaxSessionCPUs: 5}}
+	conf := types.InstanceConfig{}
+	release, err := p.reserveInstance(session, playground, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ResourceLimits{MemoryMB: 1024, CPUs: 1}, conf.Resources)
+
+	conf = types.InstanceConfig{}
+	_, err = p.reserveInstance(session, playground, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(819), conf.Resources.MemoryMB)
+	assert.Equal(t, 0.8, conf.Resources.CPUs)
+	release()
+
+	// The playground's limit is used as is
+	playground.Resources = types.ResourceLimits{MemoryMB: 512}
+	conf = types.InstanceConfig{}
+	_, err = p.reserveInstance(session, playground, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), conf.Resources.MemoryMB)
+
+	_s.AssertExpectations(t)
+}
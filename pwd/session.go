@@ -20,6 +20,10 @@ import (
 
 var preparedSessions = map[string]bool{}
 
+// activityFlushInterval is how often the activity of a session is written to
+// storage at most.
+const activityFlushInterval = 30 * time.Second
+
 type AccessDeniedError struct {
 	Err error
 }
@@ -38,7 +42,7 @@ type sessionBuilderWriter struct {
 }
 
 func (s *sessionBuilderWriter) Write(p []byte) (n int, err error) {
-	s.event.Emit(event.SESSION_BUILDER_OUT, s.sessionId, string(p))
+	event.EmitPayload(s.event, event.SESSION_BUILDER_OUT, s.sessionId, event.SessionBuilderOutPayload{Output: string(p)})
 	return len(p), nil
 }
 
@@ -50,13 +54,22 @@ type SessionSetupConf struct {
 }
 
 type SessionSetupInstanceConf struct {
-	Image          string     `json:"image"`
-	Hostname       string     `json:"hostname"`
-	IsSwarmManager bool       `json:"is_swarm_manager"`
-	IsSwarmWorker  bool       `json:"is_swarm_worker"`
-	Type           string     `json:"type"`
-	Run            [][]string `json:"run"`
-	Tls            bool       `json:"tls"`
+	Image             string               `json:"image"`
+	Hostname          string               `json:"hostname"`
+	IsSwarmManager    bool                 `json:"is_swarm_manager"`
+	IsSwarmWorker     bool                 `json:"is_swarm_worker"`
+	IsK8sControlPlane bool                 `json:"is_k8s_control_plane"`
+	IsK8sWorker       bool                 `json:"is_k8s_worker"`
+	Type              string               `json:"type"`
+	Run               [][]string           `json:"run"`
+	Tls               bool                 `json:"tls"`
+	Envs              []string             `json:"envs"`
+	Files             []types.TemplateFile `json:"files"`
+	ServerCert        []byte               `json:"-"`
+	ServerKey         []byte               `json:"-"`
+	CACert            []byte               `json:"-"`
+	Cert              []byte               `json:"-"`
+	Key               []byte               `json:"-"`
 }
 
 func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*types.Session, error) {
@@ -79,6 +92,7 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 	s.Stack = config.Stack
 	s.UserId = config.UserId
 	s.PlaygroundId = config.Playground.Id
+	s.LastActivityAt = s.CreatedAt
 
 	if s.Stack != "" {
 		s.Ready = false
@@ -89,6 +103,14 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 	}
 	s.StackName = stackName
 	s.ImageName = config.ImageName
+	s.SourceIP = config.SourceIP
+	s.DockerHost = config.DockerHost
+
+	if err := p.reserveSession(s, config.Playground); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer p.releaseSession(s)
 
 	log.Printf("NewSession id=[%s]\n", s.Id)
 	if err := p.sessionProvisioner.SessionNew(ctx, s); err != nil {
@@ -139,12 +161,70 @@ func (p *pwd) SessionClose(s *types.Session) error {
 		return err
 	}
 
+	p.activityMx.Lock()
+	delete(p.activity, s.Id)
+	p.activityMx.Unlock()
+
 	log.Printf("Cleaned up session [%s]\n", s.Id)
 	p.setGauges()
 	p.event.Emit(event.SESSION_END, s.Id)
 	return nil
 }
 
+// SessionExtend moves the expiration of the session duration further, up to
+// the maximum session duration of its playground. Playgrounds without a
+// maximum don't let sessions outlive their default session duration. Duration
+// defaults to the default session duration of the playground.
+func (p *pwd) SessionExtend(s *types.Session, duration time.Duration) error {
+	defer observeAction("SessionExtend", time.Now())
+
+	playground := p.PlaygroundGet(s.PlaygroundId)
+	if playground == nil {
+		return fmt.Errorf("Could not find playground %s", s.PlaygroundId)
+	}
+	if duration <= 0 {
+		duration = playground.DefaultSessionDuration
+	}
+
+	maxDuration := playground.MaxSessionDuration
+	if maxDuration <= 0 {
+		maxDuration = playground.DefaultSessionDuration
+	}
+
+	expiresAt := s.ExpiresAt.Add(duration)
+	if limit := s.CreatedAt.Add(maxDuration); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if !expiresAt.After(s.ExpiresAt) {
+		return sessionNotExtendable
+	}
+
+	s.ExpiresAt = expiresAt
+	if err := p.storage.SessionPut(s); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	log.Printf("Extended session [%s] until %s\n", s.Id, s.ExpiresAt)
+	event.EmitPayload(p.event, event.SESSION_EXTENDED, s.Id, event.SessionExtendedPayload{ExpiresAt: s.ExpiresAt})
+	return nil
+}
+
+// SessionTouch records that the session is being used so it isn't closed for
+// being idle.
+func (p *pwd) SessionTouch(sessionId string) error {
+	now := time.Now()
+	p.activityMx.Lock()
+	if now.Sub(p.activity[sessionId]) < activityFlushInterval {
+		p.activityMx.Unlock()
+		return nil
+	}
+	p.activity[sessionId] = now
+	p.activityMx.Unlock()
+
+	return p.storage.SessionActivityPut(sessionId, now)
+}
+
 func (p *pwd) SessionGetSmallestViewPort(sessionId string) types.ViewPort {
 	defer observeAction("SessionGetSmallestViewPort", time.Now())
 
@@ -187,7 +267,7 @@ func (p *pwd) SessionDeployStack(s *types.Session) error {
 	}
 
 	s.Ready = false
-	p.event.Emit(event.SESSION_READY, s.Id, false)
+	event.EmitPayload(p.event, event.SESSION_READY, s.Id, event.SessionReadyPayload{Ready: false})
 	i, err := p.InstanceNew(s, types.InstanceConfig{ImageName: s.ImageName, PlaygroundFQDN: s.Host, DindVolumeSize: "5G", Privileged: true})
 	if err != nil {
 		log.Printf("Error creating instance for stack [%s]: %s\n", s.Stack, err)
@@ -226,7 +306,7 @@ func (p *pwd) SessionDeployStack(s *types.Session) error {
 
 	log.Printf("Stack execution finished with code %d\n", code)
 	s.Ready = true
-	p.event.Emit(event.SESSION_READY, s.Id, true)
+	event.EmitPayload(p.event, event.SESSION_READY, s.Id, event.SessionReadyPayload{Ready: true})
 	if err := p.storage.SessionPut(s); err != nil {
 		return err
 	}
@@ -262,10 +342,31 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 		return sessionNotEmpty
 	}
 
+	// The first control plane is the one initializing the k8s cluster
+	k8sInit := -1
+	var k8sWorkers bool
+	for n, conf := range sconf.Instances {
+		if conf.IsK8sControlPlane && k8sInit < 0 {
+			k8sInit = n
+		}
+		k8sWorkers = k8sWorkers || conf.IsK8sWorker
+	}
+	if k8sWorkers && k8sInit < 0 {
+		return noK8sControlPlane
+	}
+	var k8s *k8sBootstrap
+	if k8sInit >= 0 {
+		if k8s, err = newK8sBootstrap(p); err != nil {
+			return err
+		}
+	}
+
+	progress := p.newSetupProgress(session)
+
 	g, ctx := errgroup.WithContext(context.Background())
 
-	for _, conf := range sconf.Instances {
-		conf := conf
+	for n, conf := range sconf.Instances {
+		n, conf := n, conf
 		g.Go(func() error {
 			instanceConf := types.InstanceConfig{
 				ImageName:      conf.Image,
@@ -273,6 +374,12 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 				PlaygroundFQDN: sconf.PlaygroundFQDN,
 				Type:           conf.Type,
 				Tls:            conf.Tls,
+				ServerCert:     conf.ServerCert,
+				ServerKey:      conf.ServerKey,
+				CACert:         conf.CACert,
+				Cert:           conf.Cert,
+				Key:            conf.Key,
+				Envs:           conf.Envs,
 				DindVolumeSize: sconf.DindVolumeSize,
 				Privileged:     sconf.Privileged,
 			}
@@ -280,6 +387,7 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 			if err != nil {
 				return err
 			}
+			progress.step(i, types.SessionSetupStep{Step: types.SetupStepInstanceCreated})
 
 			if conf.IsSwarmManager || conf.IsSwarmWorker {
 				dockerClient, err := p.dockerFactory.GetForInstance(i)
@@ -317,39 +425,75 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 						return err
 					}
 				}
+				progress.step(i, types.SessionSetupStep{Step: types.SetupStepSwarmJoined})
+			}
+
+			if n == k8sInit {
+				if err := k8s.init(i); err != nil {
+					return err
+				}
+			} else if conf.IsK8sControlPlane || conf.IsK8sWorker {
+				if err := k8s.joinCluster(ctx, i, conf.IsK8sControlPlane); err != nil {
+					return err
+				}
+			}
+			if conf.IsK8sControlPlane || conf.IsK8sWorker {
+				progress.step(i, types.SessionSetupStep{Step: types.SetupStepK8sJoined})
+			}
+
+			for _, f := range conf.Files {
+				if err := p.instanceUploadFile(i, f); err != nil {
+					log.Printf("Cannot upload %s to instance %s. Got: %v\n", f.Path, i.Name, err)
+					return err
+				}
 			}
 
 			for _, cmd := range conf.Run {
-				errch := make(chan error)
-				go func() {
-					exitCode, err := p.InstanceExec(i, cmd)
-					fmt.Printf("Finished execuing command [%s] on instance %s with code [%d] and err [%v]\n", cmd, i.Name, exitCode, err)
+				progress.step(i, types.SessionSetupStep{Step: types.SetupStepCommandStarted, Command: cmd})
 
-					if err != nil {
-						errch <- err
-					}
-					if exitCode != 0 {
-						errch <- fmt.Errorf("Command returned %d on instance %s", exitCode, i.IP)
-					}
-					errch <- nil
+				resch := make(chan setupCommandResult, 1)
+				go func() {
+					code, out, err := p.instanceExecAttach(i, cmd)
+					log.Printf("Finished executing command [%s] on instance %s with code [%d] and err [%v]\n", cmd, i.Name, code, err)
+					resch <- setupCommandResult{code, out, err}
 				}()
 
 				// ctx.Done() could be called if the errgroup is cancelled due to a previous error. In that case, return immediately
+				var res setupCommandResult
 				select {
-				case err = <-errch:
-					return err
+				case res = <-resch:
 				case <-ctx.Done():
 					return ctx.Err()
 				}
+
+				if res.err == nil && res.code != 0 {
+					res.err = fmt.Errorf("Command returned %d on instance %s", res.code, i.IP)
+				}
+				step := types.SessionSetupStep{Step: types.SetupStepCommandFinished, Command: cmd, ExitCode: res.code, Output: res.out}
+				if res.err != nil {
+					step.Error = res.err.Error()
+				}
+				progress.step(i, step)
+				if res.err != nil {
+					return res.err
+				}
 			}
 			return nil
 		})
 	}
 
-	if err := g.Wait(); err != nil {
+	err = g.Wait()
+	progress.finish(err)
+	if err != nil {
 		log.Println(err)
 		return err
 	}
 
 	return nil
 }
+
+type setupCommandResult struct {
+	code int
+	out  string
+	err  error
+}
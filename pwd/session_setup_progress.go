@@ -0,0 +1,100 @@
+package pwd
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// setupOutputLimit is how much of the output of a setup command is kept, the
+// end of it being what matters when it fails.
+const setupOutputLimit = 4096
+
+// setupProgress keeps track of the setup of a session. Every step is emitted
+// on the session and recorded in its setup status, which API clients can
+// poll.
+type setupProgress struct {
+	p      *pwd
+	mx     sync.Mutex
+	status *types.SessionSetupStatus
+}
+
+func (p *pwd) newSetupProgress(session *types.Session) *setupProgress {
+	s := &setupProgress{p: p, status: &types.SessionSetupStatus{
+		SessionId: session.Id,
+		State:     types.SetupRunning,
+		StartedAt: time.Now(),
+		Steps:     []types.SessionSetupStep{},
+	}}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.save()
+	return s
+}
+
+// step records a step of the setup of instance i, or of the whole session
+// when i is nil.
+func (s *setupProgress) step(i *types.Instance, step types.SessionSetupStep) {
+	step.At = time.Now()
+	if i != nil {
+		step.Hostname = i.Hostname
+		step.Instance = i.Name
+	}
+	if len(step.Output) > setupOutputLimit {
+		step.Output = step.Output[len(step.Output)-setupOutputLimit:]
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.status.Steps = append(s.status.Steps, step)
+	s.save()
+	event.EmitPayload(s.p.event, event.SESSION_SETUP_PROGRESS, s.status.SessionId, event.SessionSetupProgressPayload{
+		Hostname: step.Hostname,
+		Instance: step.Instance,
+		Step:     step.Step,
+		Command:  step.Command,
+		ExitCode: step.ExitCode,
+		Output:   step.Output,
+		Error:    step.Error,
+		At:       step.At,
+	})
+}
+
+func (s *setupProgress) finish(err error) {
+	step := types.SessionSetupStep{Step: types.SetupStepFinished}
+	s.mx.Lock()
+	s.status.State = types.SetupDone
+	s.status.FinishedAt = time.Now()
+	if err != nil {
+		s.status.State = types.SetupFailed
+		s.status.Error = err.Error()
+		step.Error = err.Error()
+	}
+	s.mx.Unlock()
+
+	s.step(nil, step)
+}
+
+// save stores a copy of the status, as it keeps changing while readers may
+// be looking at the stored one. It has to be called with mx held.
+func (s *setupProgress) save() {
+	status := *s.status
+	status.Steps = append([]types.SessionSetupStep{}, s.status.Steps...)
+	if err := s.p.storage.SessionSetupStatusPut(&status); err != nil {
+		log.Printf("Could not save setup status of session %s. Got: %v\n", status.SessionId, err)
+	}
+}
+
+// SessionSetupStatus returns the status of the last setup of the session, or
+// nil when it was never set up.
+func (p *pwd) SessionSetupStatus(sessionId string) (*types.SessionSetupStatus, error) {
+	status, err := p.storage.SessionSetupStatusGet(sessionId)
+	if storage.NotFound(err) {
+		return nil, nil
+	}
+	return status, err
+}
@@ -0,0 +1,75 @@
+package pwd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSetupProgress(t *testing.T) {
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, _e, _s, nil, nil)
+
+	session := &types.Session{Id: "aaaabbbbcccc"}
+	i := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1"}
+
+	var saved []*types.SessionSetupStatus
+	_s.On("SessionSetupStatusPut", mock.AnythingOfType("*types.SessionSetupStatus")).Run(func(args mock.Arguments) {
+		saved = append(saved, args.Get(0).(*types.SessionSetupStatus))
+	}).Return(nil)
+	var emitted []event.SessionSetupProgressPayload
+	_e.M.On("Emit", event.SESSION_SETUP_PROGRESS, "aaaabbbbcccc", mock.Anything).Run(func(args mock.Arguments) {
+		emitted = append(emitted, args.Get(2).([]interface{})[0].(event.SessionSetupProgressPayload))
+	}).Return()
+
+	progress := p.newSetupProgress(session)
+	assert.Len(t, saved, 1)
+	assert.Equal(t, types.SetupRunning, saved[0].State)
+	assert.Empty(t, saved[0].Steps)
+
+	progress.step(i, types.SessionSetupStep{Step: types.SetupStepInstanceCreated})
+	progress.step(i, types.SessionSetupStep{Step: types.SetupStepCommandFinished, Command: []string{"false"}, ExitCode: 1, Output: strings.Repeat("a", setupOutputLimit) + "end"})
+	progress.finish(errors.New("Command returned 1 on instance 10.0.0.1"))
+
+	assert.Len(t, emitted, 3)
+	assert.Equal(t, "node1", emitted[0].Hostname)
+	assert.Equal(t, "aaaabbbb_node1", emitted[0].Instance)
+	assert.Equal(t, types.SetupStepInstanceCreated, emitted[0].Step)
+	assert.Equal(t, 1, emitted[1].ExitCode)
+	assert.Len(t, emitted[1].Output, setupOutputLimit)
+	assert.True(t, strings.HasSuffix(emitted[1].Output, "end"))
+	assert.Equal(t, types.SetupStepFinished, emitted[2].Step)
+	assert.Empty(t, emitted[2].Instance)
+
+	status := saved[len(saved)-1]
+	assert.Equal(t, types.SetupFailed, status.State)
+	assert.Equal(t, "Command returned 1 on instance 10.0.0.1", status.Error)
+	assert.False(t, status.FinishedAt.IsZero())
+	assert.Len(t, status.Steps, 3)
+	// Stored statuses don't change afterwards
+	assert.Len(t, saved[1].Steps, 1)
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestSessionSetupStatus_NotSetUp(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	_s.On("SessionSetupStatusGet", "aaaabbbbcccc").Return((*types.SessionSetupStatus)(nil), storage.NotFoundError)
+
+	status, err := p.SessionSetupStatus("aaaabbbbcccc")
+	assert.Nil(t, err)
+	assert.Nil(t, status)
+
+	_s.AssertExpectations(t)
+}
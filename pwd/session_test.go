@@ -207,3 +207,90 @@ func TestSessionSetup(t *testing.T) {
 	_e.M.AssertExpectations(t)
 }
 */
+
+func TestSessionExtend(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(&id.MockGenerator{}, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	now := time.Now()
+	playground := &types.Playground{Id: "foobar", DefaultSessionDuration: time.Hour, MaxSessionDuration: 90 * time.Minute}
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("SessionPut", s).Return(nil)
+	_e.M.On("Emit", event.SESSION_EXTENDED, "aaaabbbbcccc", []interface{}{event.SessionExtendedPayload{ExpiresAt: now.Add(80 * time.Minute)}}).Return().Once()
+	_e.M.On("Emit", event.SESSION_EXTENDED, "aaaabbbbcccc", []interface{}{event.SessionExtendedPayload{ExpiresAt: now.Add(90 * time.Minute)}}).Return().Once()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	assert.Nil(t, p.SessionExtend(s, 20*time.Minute))
+	assert.Equal(t, now.Add(80*time.Minute), s.ExpiresAt)
+
+	// Capped to the maximum session duration
+	assert.Nil(t, p.SessionExtend(s, 0))
+	assert.Equal(t, now.Add(90*time.Minute), s.ExpiresAt)
+
+	err := p.SessionExtend(s, time.Minute)
+	assert.True(t, SessionNotExtendable(err))
+	assert.Equal(t, now.Add(90*time.Minute), s.ExpiresAt)
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestSessionTouch(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(&id.MockGenerator{}, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	var touched time.Time
+	_s.On("SessionActivityPut", "aaaabbbbcccc", mock.AnythingOfType("time.Time")).Run(func(args mock.Arguments) {
+		touched = args.Get(1).(time.Time)
+	}).Return(nil).Once()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	before := time.Now()
+	assert.Nil(t, p.SessionTouch("aaaabbbbcccc"))
+	assert.False(t, touched.Before(before))
+
+	// Activity is written to storage once in a while
+	assert.Nil(t, p.SessionTouch("aaaabbbbcccc"))
+
+	_s.AssertExpectations(t)
+}
+
+func TestSessionExtend_NoMaxDuration(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(&id.MockGenerator{}, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	now := time.Now()
+	playground := &types.Playground{Id: "foobar", DefaultSessionDuration: time.Hour}
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", CreatedAt: now, ExpiresAt: now.Add(30 * time.Minute)}
+
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("SessionPut", s).Return(nil)
+	_e.M.On("Emit", event.SESSION_EXTENDED, "aaaabbbbcccc", []interface{}{event.SessionExtendedPayload{ExpiresAt: now.Add(time.Hour)}}).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	// Without a maximum the session can't outlive the default duration.
+	assert.Nil(t, p.SessionExtend(s, 0))
+	assert.Equal(t, now.Add(time.Hour), s.ExpiresAt)
+
+	err := p.SessionExtend(s, 0)
+	assert.True(t, SessionNotExtendable(err))
+	assert.Equal(t, now.Add(time.Hour), s.ExpiresAt)
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+	_s.AssertNumberOfCalls(t, "SessionPut", 1)
+}
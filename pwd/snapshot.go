@@ -0,0 +1,316 @@
+package pwd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/satori/go.uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+// snapshotArchive is where the docker state of an instance is archived before
+// committing it, as /var/lib/docker is a volume commits leave out.
+const snapshotArchive = "/var/lib/pwd/snapshot.tgz"
+
+// defaultSnapshotDuration is how long snapshots are kept on playgrounds that
+// don't set their own SnapshotDuration.
+const defaultSnapshotDuration = 7 * 24 * time.Hour
+
+var snapshotNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+var snapshotExists = errors.New("Snapshot already exists")
+
+func SnapshotExists(e error) bool {
+	return e == snapshotExists
+}
+
+var invalidSnapshotName = errors.New("Snapshot names can only have lowercase letters, digits, '.', '_' and '-'")
+
+func InvalidSnapshotName(e error) bool {
+	return e == invalidSnapshotName
+}
+
+// archiveScript archives the docker state of an instance into
+// snapshotArchive.
+var archiveScript = fmt.Sprintf(`mkdir -p $(dirname %[1]s) && tar -czf %[1]s -C /var/lib/docker .`, snapshotArchive)
+
+// restoreScript swaps the docker state of a restored instance for the one in
+// its archive. dockerd is restarted with the arguments it was started with.
+var restoreScript = fmt.Sprintf(`set -e
+[ -f %[1]s ] || exit 0
+for i in $(seq 30); do pgrep dockerd > /dev/null && break; sleep 1; done
+pid=$(pgrep -o dockerd)
+cmd=$(tr '\0' ' ' < /proc/$pid/cmdline)
+kill $pid
+while pgrep dockerd > /dev/null; do sleep 1; done
+rm -rf /var/lib/docker/*
+tar -xzf %[1]s -C /var/lib/docker
+rm %[1]s
+nohup $cmd > /var/log/dockerd.log 2>&1 &`, snapshotArchive)
+
+func snapshotImage(id, hostname string) string {
+	return fmt.Sprintf("pwd-snapshot-%s:%s", id, hostname)
+}
+
+// snapshotExpiresAt returns when the snapshot gets deleted. Snapshots taken
+// before they expired last the default duration.
+func snapshotExpiresAt(snapshot *types.Snapshot) time.Time {
+	if snapshot.ExpiresAt.IsZero() {
+		return snapshot.CreatedAt.Add(defaultSnapshotDuration)
+	}
+	return snapshot.ExpiresAt
+}
+
+// SessionSnapshot saves the instances of the session as a snapshot named
+// name. Instances are committed along with their docker state, except for
+// windows ones, which are only recorded. Names are only checked to be unique
+// among the snapshots the user of the session has on its playground, as
+// snapshots are found by their id.
+func (p *pwd) SessionSnapshot(session *types.Session, name string) (*types.Snapshot, error) {
+	defer observeAction("SessionSnapshot", time.Now())
+
+	if !snapshotNameRegex.MatchString(name) {
+		return nil, invalidSnapshotName
+	}
+	if session.UserId != "" {
+		snapshots, err := p.storage.SnapshotGetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range snapshots {
+			if s.PlaygroundId == session.PlaygroundId && s.UserId == session.UserId && s.Name == name {
+				return nil, snapshotExists
+			}
+		}
+	}
+	duration := defaultSnapshotDuration
+	if playground := p.PlaygroundGet(session.PlaygroundId); playground != nil && playground.SnapshotDuration > 0 {
+		duration = playground.SnapshotDuration
+	}
+
+	instances, err := p.storage.InstanceFindBySessionId(session.Id)
+	if err != nil {
+		return nil, err
+	}
+	dockerClient, err := p.dockerFactory.GetForSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshot := &types.Snapshot{
+		Id:           uuid.NewV4().String(),
+		Name:         name,
+		SessionId:    session.Id,
+		PlaygroundId: session.PlaygroundId,
+		UserId:       session.UserId,
+		DockerHost:   session.DockerHost,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(duration),
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			if err := removeSnapshotImages(dockerClient, snapshot); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+	for _, i := range instances {
+		si := types.SnapshotInstance{
+			Hostname:    i.Hostname,
+			Image:       i.Image,
+			SourceImage: i.Image,
+			Type:        i.Type,
+			Tls:         i.Tls,
+			ServerCert:  i.ServerCert,
+			ServerKey:   i.ServerKey,
+			CACert:      i.CACert,
+			Cert:        i.Cert,
+			Key:         i.Key,
+			Resources:   i.Resources,
+		}
+		if i.Type != "windows" {
+			if code, err := p.InstanceExec(i, []string{"sh", "-c", archiveScript}); err != nil {
+				return nil, err
+			} else if code != 0 {
+				return nil, fmt.Errorf("Archiving docker state of instance %s exited with %d", i.Name, code)
+			}
+			si.Image = snapshotImage(snapshot.Id, i.Hostname)
+			err := dockerClient.ContainerCommit(i.Name, si.Image)
+			// The archive isn't needed by the running instance
+			p.InstanceExec(i, []string{"rm", "-f", snapshotArchive})
+			if err != nil {
+				return nil, fmt.Errorf("Could not commit instance %s. Got: %v", i.Name, err)
+			}
+			si.Committed = true
+		}
+		snapshot.Instances = append(snapshot.Instances, si)
+	}
+
+	if err := p.storage.SnapshotPut(snapshot); err != nil {
+		return nil, err
+	}
+	saved = true
+	log.Printf("Saved session [%s] as snapshot [%s] named %s\n", session.Id, snapshot.Id, name)
+	return snapshot, nil
+}
+
+// removeSnapshotImages deletes the images the instances of the snapshot were
+// committed to.
+func removeSnapshotImages(dockerClient docker.DockerApi, snapshot *types.Snapshot) error {
+	for _, si := range snapshot.Instances {
+		if !si.Committed {
+			continue
+		}
+		if err := dockerClient.ImageRemove(si.Image); err != nil {
+			return fmt.Errorf("Could not remove image %s of snapshot %s. Got: %v", si.Image, snapshot.Id, err)
+		}
+	}
+	return nil
+}
+
+// snapshotGet returns the snapshot with the given id, as long as it isn't
+// expired and can be used by userId.
+func (p *pwd) snapshotGet(id, userId string) (*types.Snapshot, error) {
+	snapshot, err := p.storage.SnapshotGet(id)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(snapshotExpiresAt(snapshot)) {
+		return nil, storage.NotFoundError
+	}
+	if snapshot.UserId != "" && snapshot.UserId != userId {
+		return nil, &AccessDeniedError{fmt.Errorf("Snapshot %s belongs to another user", id)}
+	}
+	return snapshot, nil
+}
+
+// SnapshotDelete deletes the snapshot with the given id along with its
+// images. Snapshots of a user can only be deleted by them.
+func (p *pwd) SnapshotDelete(id, userId string) error {
+	defer observeAction("SnapshotDelete", time.Now())
+
+	snapshot, err := p.snapshotGet(id, userId)
+	if err != nil {
+		return err
+	}
+	return p.snapshotDelete(snapshot)
+}
+
+func (p *pwd) snapshotDelete(snapshot *types.Snapshot) error {
+	dockerClient, err := p.dockerFactory.GetForHost(snapshot.DockerHost)
+	if err != nil {
+		return err
+	}
+	// The record is kept until its images are gone so deleting can be retried
+	if err := removeSnapshotImages(dockerClient, snapshot); err != nil {
+		return err
+	}
+	if err := p.storage.SnapshotDelete(snapshot.Id); err != nil {
+		return err
+	}
+	log.Printf("Deleted snapshot [%s]\n", snapshot.Id)
+	return nil
+}
+
+// SnapshotDeleteExpired deletes the snapshots that expired and returns how
+// many there were.
+func (p *pwd) SnapshotDeleteExpired() (int, error) {
+	defer observeAction("SnapshotDeleteExpired", time.Now())
+
+	snapshots, err := p.storage.SnapshotGetAll()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	deleted := 0
+	for _, snapshot := range snapshots {
+		if now.Before(snapshotExpiresAt(snapshot)) {
+			continue
+		}
+		if err := p.snapshotDelete(snapshot); err != nil {
+			log.Printf("Error deleting expired snapshot %s. Got: %v\n", snapshot.Id, err)
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// SessionRestore creates a new session out of the snapshot with the given id,
+// with the same instances and hostnames. The session is placed on the docker
+// host the snapshot was taken on, as that's where its images are.
+func (p *pwd) SessionRestore(ctx context.Context, id string, config types.SessionConfig) (*types.Session, error) {
+	defer observeAction("SessionRestore", time.Now())
+
+	snapshot, err := p.snapshotGet(id, config.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.PlaygroundId != config.Playground.Id {
+		return nil, fmt.Errorf("Snapshot %s belongs to another playground", id)
+	}
+
+	config.DockerHost = snapshot.DockerHost
+	session, err := p.SessionNew(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	playground := config.Playground
+	dindVolumeSize := "5G"
+	if len(playground.DindVolumeSize) > 0 {
+		dindVolumeSize = playground.DindVolumeSize
+	}
+	g, _ := errgroup.WithContext(ctx)
+	for _, si := range snapshot.Instances {
+		si := si
+		g.Go(func() error {
+			i, err := p.InstanceNew(session, types.InstanceConfig{
+				ImageName:      si.Image,
+				Hostname:       si.Hostname,
+				Type:           si.Type,
+				Tls:            si.Tls,
+				ServerCert:     si.ServerCert,
+				ServerKey:      si.ServerKey,
+				CACert:         si.CACert,
+				Cert:           si.Cert,
+				Key:            si.Key,
+				PlaygroundFQDN: playground.Domain,
+				DindVolumeSize: dindVolumeSize,
+				Privileged:     playground.Privileged,
+				Resources:      si.Resources,
+			})
+			if err != nil {
+				return err
+			}
+			if !si.Committed {
+				return nil
+			}
+			if code, err := p.InstanceExec(i, []string{"sh", "-c", restoreScript}); err != nil {
+				return err
+			} else if code != 0 {
+				return fmt.Errorf("Restoring docker state of instance %s exited with %d", i.Name, code)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		log.Printf("Could not restore snapshot [%s]. Got: %v\n", id, err)
+		if err := p.SessionClose(session); err != nil {
+			log.Printf("Could not close session %s. Got: %v\n", session.Id, err)
+		}
+		return nil, err
+	}
+
+	log.Printf("Restored snapshot [%s] into session [%s]\n", id, session.Id)
+	return session, nil
+}
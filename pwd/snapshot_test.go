@@ -0,0 +1,197 @@
+package pwd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSessionSnapshot(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	session := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", UserId: "u1", DockerHost: "tcp://b:2375"}
+	node1 := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1", Image: "franela/dind", SessionId: session.Id, Tls: true}
+	win := &types.Instance{Name: "aaaabbbb_win", Hostname: "win1", Image: "windows", SessionId: session.Id, Type: "windows"}
+
+	_s.On("SnapshotGetAll").Return([]*types.Snapshot{
+		{Id: "id0", Name: "snap0", PlaygroundId: "foobar", UserId: "u1"},
+		{Id: "id1", Name: "snap1", PlaygroundId: "foobar", UserId: "u2"},
+	}, nil)
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar", SnapshotDuration: time.Hour}, nil)
+	_s.On("InstanceFindBySessionId", session.Id).Return([]*types.Instance{node1, win}, nil)
+	_s.On("SessionGet", session.Id).Return(session, nil)
+	_f.On("GetForSession", session).Return(_d, nil)
+	_d.On("Exec", node1.Name, []string{"sh", "-c", archiveScript}).Return(0, nil)
+	var image string
+	_d.On("ContainerCommit", node1.Name, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		image = args.String(1)
+	}).Return(nil)
+	_d.On("Exec", node1.Name, []string{"rm", "-f", snapshotArchive}).Return(0, nil)
+	_s.On("SnapshotPut", mock.AnythingOfType("*types.Snapshot")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	_, err := p.SessionSnapshot(session, "Not valid")
+	assert.True(t, InvalidSnapshotName(err))
+
+	// Names are unique per user
+	_, err = p.SessionSnapshot(session, "snap0")
+	assert.True(t, SnapshotExists(err))
+
+	snapshot, err := p.SessionSnapshot(session, "snap1")
+	assert.Nil(t, err)
+	assert.Len(t, snapshot.Id, 36)
+	assert.Equal(t, "snap1", snapshot.Name)
+	assert.Equal(t, "u1", snapshot.UserId)
+	assert.Equal(t, "tcp://b:2375", snapshot.DockerHost)
+	assert.Equal(t, snapshot.CreatedAt.Add(time.Hour), snapshot.ExpiresAt)
+	assert.Equal(t, "pwd-snapshot-"+snapshot.Id+":node1", image)
+	assert.Equal(t, []types.SnapshotInstance{
+		{Hostname: "node1", Image: image, SourceImage: "franela/dind", Committed: true, Tls: true},
+		{Hostname: "win1", Image: "windows", SourceImage: "windows", Type: "windows"},
+	}, snapshot.Instances)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+}
+
+func TestSessionRestore(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	playground := &types.Playground{Id: "foobar"}
+	snapshot := &types.Snapshot{Id: "id1", Name: "snap1", PlaygroundId: "foobar", CreatedAt: time.Now(), UserId: "u1", DockerHost: "tcp://b:2375", Instances: []types.SnapshotInstance{
+		{Hostname: "node1", Image: "pwd-snapshot-snap1:node1", SourceImage: "franela/dind", Committed: true},
+	}}
+
+	_s.On("SnapshotGet", "id1").Return(snapshot, nil)
+	_s.On("SnapshotGet", "id2").Return(&types.Snapshot{Id: "id2", PlaygroundId: "foobar", CreatedAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)}, nil)
+	_s.On("UserGet", "u1").Return(&types.User{Id: "u1"}, nil)
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
+	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
+	_d.On("DaemonHost").Return("localhost")
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(0, nil)
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("SessionGet", "aaaabbbbcccc").Return(&types.Session{Id: "aaaabbbbcccc", DockerHost: "tcp://b:2375"}, nil)
+
+	var nilArgs []interface{}
+	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
+
+	_d.On("ContainerCreate", docker.CreateContainerOpts{
+		Image:          "pwd-snapshot-snap1:node1",
+		SessionId:      "aaaabbbbcccc",
+		ContainerName:  "aaaabbbb_aaaabbbbcccc",
+		Hostname:       "node1",
+		Networks:       []string{"aaaabbbbcccc"},
+		DindVolumeSize: "5G",
+	}).Return(nil)
+	_d.On("ContainerIPs", "aaaabbbb_aaaabbbbcccc").Return(map[string]string{"aaaabbbbcccc": "10.0.0.1"}, nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", []interface{}{"aaaabbbb_aaaabbbbcccc", "10.0.0.1", "node1", "ip10-0-0-1-aaaabbbbcccc"}).Return()
+	_d.On("Exec", "aaaabbbb_aaaabbbbcccc", []string{"sh", "-c", restoreScript}).Return(0, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	_, err := p.SessionRestore(context.Background(), "id1", types.SessionConfig{Playground: playground, UserId: "u2", Duration: time.Hour})
+	assert.IsType(t, &AccessDeniedError{}, err)
+
+	_, err = p.SessionRestore(context.Background(), "id2", types.SessionConfig{Playground: playground, Duration: time.Hour})
+	assert.True(t, storage.NotFound(err))
+
+	session, err := p.SessionRestore(context.Background(), "id1", types.SessionConfig{Playground: playground, UserId: "u1", Duration: time.Hour})
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://b:2375", session.DockerHost)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestSnapshotDelete(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+
+	snapshot := &types.Snapshot{Id: "id1", UserId: "u1", DockerHost: "tcp://b:2375", CreatedAt: time.Now(), Instances: []types.SnapshotInstance{
+		{Hostname: "node1", Image: "pwd-snapshot-id1:node1", Committed: true},
+		{Hostname: "win1", Image: "windows", Type: "windows"},
+	}}
+	_s.On("SnapshotGet", "id1").Return(snapshot, nil)
+	_f.On("GetForHost", "tcp://b:2375").Return(_d, nil)
+	_d.On("ImageRemove", "pwd-snapshot-id1:node1").Return(nil)
+	_s.On("SnapshotDelete", "id1").Return(nil)
+
+	p := NewPWD(_f, &event.Mock{}, _s, nil, nil)
+
+	err := p.SnapshotDelete("id1", "u2")
+	assert.IsType(t, &AccessDeniedError{}, err)
+
+	assert.Nil(t, p.SnapshotDelete("id1", "u1"))
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+}
+
+func TestSnapshotDeleteExpired(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+
+	now := time.Now()
+	_s.On("SnapshotGetAll").Return([]*types.Snapshot{
+		{Id: "fresh", CreatedAt: now, ExpiresAt: now.Add(time.Hour), Instances: []types.SnapshotInstance{{Image: "pwd-snapshot-fresh:node1", Committed: true}}},
+		{Id: "expired", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Instances: []types.SnapshotInstance{{Image: "pwd-snapshot-expired:node1", Committed: true}}},
+		// Taken before snapshots expired
+		{Id: "old", CreatedAt: now.Add(-defaultSnapshotDuration)},
+	}, nil)
+	_f.On("GetForHost", "").Return(_d, nil)
+	_d.On("ImageRemove", "pwd-snapshot-expired:node1").Return(nil)
+	_s.On("SnapshotDelete", "expired").Return(nil)
+	_s.On("SnapshotDelete", "old").Return(nil)
+
+	p := NewPWD(_f, &event.Mock{}, _s, nil, nil)
+
+	n, err := p.SnapshotDeleteExpired()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+}
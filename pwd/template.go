@@ -0,0 +1,176 @@
+package pwd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+var templateNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// InvalidTemplateError is returned when saving a template that can't be used
+// to set up a session.
+type InvalidTemplateError struct {
+	Reason string
+}
+
+func (e *InvalidTemplateError) Error() string {
+	return fmt.Sprintf("Invalid template: %s", e.Reason)
+}
+
+func InvalidTemplate(e error) bool {
+	_, ok := e.(*InvalidTemplateError)
+	return ok
+}
+
+func validateTemplate(template *types.SessionTemplate, playground *types.Playground) error {
+	if !templateNameRegex.MatchString(template.Name) {
+		return &InvalidTemplateError{"names can only have lowercase letters, digits, '.', '_' and '-'"}
+	}
+	if len(template.Instances) == 0 {
+		return &InvalidTemplateError{"it has no instances"}
+	}
+	if playground.MaxInstances > 0 && len(template.Instances) > playground.MaxInstances {
+		return &InvalidTemplateError{fmt.Sprintf("playground allows at most %d instances", playground.MaxInstances)}
+	}
+	hostnames := map[string]bool{}
+	var k8sControlPlane, k8sWorkers bool
+	for _, i := range template.Instances {
+		k8sControlPlane = k8sControlPlane || i.IsK8sControlPlane
+		k8sWorkers = k8sWorkers || i.IsK8sWorker
+		if i.Hostname != "" {
+			if hostnames[i.Hostname] {
+				return &InvalidTemplateError{fmt.Sprintf("hostname %s is repeated", i.Hostname)}
+			}
+			hostnames[i.Hostname] = true
+		}
+		for _, f := range i.Files {
+			if !path.IsAbs(f.Path) || path.Base(f.Path) == "/" {
+				return &InvalidTemplateError{fmt.Sprintf("file path %s is not an absolute file path", f.Path)}
+			}
+		}
+	}
+	if k8sWorkers && !k8sControlPlane {
+		return &InvalidTemplateError{"k8s workers need a control plane"}
+	}
+	return nil
+}
+
+// TemplateSave saves template as the next version of the template with its
+// name in its playground.
+func (p *pwd) TemplateSave(template *types.SessionTemplate) error {
+	defer observeAction("TemplateSave", time.Now())
+
+	playground, err := p.storage.PlaygroundGet(template.PlaygroundId)
+	if err != nil {
+		return err
+	}
+	if err := validateTemplate(template, playground); err != nil {
+		return err
+	}
+
+	p.templateMx.Lock()
+	defer p.templateMx.Unlock()
+
+	template.Version = 1
+	if latest, err := p.storage.TemplateGet(template.PlaygroundId, template.Name, 0); err == nil {
+		template.Version = latest.Version + 1
+	} else if !storage.NotFound(err) {
+		return err
+	}
+	template.CreatedAt = time.Now()
+
+	if err := p.storage.TemplatePut(template); err != nil {
+		log.Printf("Error saving template %s. Got: %v\n", template.Name, err)
+		return err
+	}
+	return nil
+}
+
+// TemplateGet returns the given version of a template, or its latest one when
+// version is 0.
+func (p *pwd) TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error) {
+	defer observeAction("TemplateGet", time.Now())
+	return p.storage.TemplateGet(playgroundId, name, version)
+}
+
+// TemplateList returns the latest version of every template of the
+// playground.
+func (p *pwd) TemplateList(playgroundId string) ([]*types.SessionTemplate, error) {
+	defer observeAction("TemplateList", time.Now())
+
+	templates, err := p.storage.TemplateFindByPlaygroundId(playgroundId)
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]*types.SessionTemplate{}
+	names := []string{}
+	for _, t := range templates {
+		if l, found := latest[t.Name]; !found {
+			names = append(names, t.Name)
+			latest[t.Name] = t
+		} else if t.Version > l.Version {
+			latest[t.Name] = t
+		}
+	}
+	list := make([]*types.SessionTemplate, len(names))
+	for n, name := range names {
+		list[n] = latest[name]
+	}
+	return list, nil
+}
+
+func (p *pwd) TemplateDelete(playgroundId, name string) error {
+	defer observeAction("TemplateDelete", time.Now())
+	return p.storage.TemplateDelete(playgroundId, name)
+}
+
+// SessionSetupTemplate sets up an empty session as described by template.
+func (p *pwd) SessionSetupTemplate(session *types.Session, template *types.SessionTemplate) error {
+	defer observeAction("SessionSetupTemplate", time.Now())
+
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return err
+	}
+	sconf := SessionSetupConf{
+		PlaygroundFQDN: playground.Domain,
+		DindVolumeSize: "5G",
+		Privileged:     playground.Privileged,
+	}
+	if len(playground.DindVolumeSize) > 0 {
+		sconf.DindVolumeSize = playground.DindVolumeSize
+	}
+	for _, i := range template.Instances {
+		sconf.Instances = append(sconf.Instances, SessionSetupInstanceConf{
+			Image:             i.Image,
+			Hostname:          i.Hostname,
+			IsSwarmManager:    i.IsSwarmManager,
+			IsSwarmWorker:     i.IsSwarmWorker,
+			IsK8sControlPlane: i.IsK8sControlPlane,
+			IsK8sWorker:       i.IsK8sWorker,
+			Type:              i.Type,
+			Run:               i.Run,
+			Tls:               i.Tls,
+			Envs:              i.Envs,
+			Files:             i.Files,
+		})
+	}
+
+	log.Printf("Setting up session [%s] with template [%s] version [%d]\n", session.Id, template.Name, template.Version)
+	return p.SessionSetup(session, sconf)
+}
+
+func (p *pwd) instanceUploadFile(i *types.Instance, f types.TemplateFile) error {
+	dir, name := path.Split(f.Path)
+	if f.Url != "" {
+		return p.InstanceUploadFromUrl(i, name, dir, f.Url)
+	}
+	return p.InstanceUploadFromReader(i, name, dir, bytes.NewReader(f.Content))
+}
@@ -0,0 +1,65 @@
+package pwd
+
+import (
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateSave(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	playground := &types.Playground{Id: "foobar", MaxInstances: 2}
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("TemplateGet", "foobar", "swarm", 0).Return(&types.SessionTemplate{Name: "swarm", PlaygroundId: "foobar", Version: 3}, nil).Once()
+	_s.On("TemplateGet", "foobar", "other", 0).Return((*types.SessionTemplate)(nil), storage.NotFoundError).Once()
+
+	instances := []types.TemplateInstance{{Hostname: "manager1", IsSwarmManager: true}, {Hostname: "worker1", IsSwarmWorker: true}}
+
+	swarm := &types.SessionTemplate{Name: "swarm", PlaygroundId: "foobar", Instances: instances}
+	_s.On("TemplatePut", swarm).Return(nil).Once()
+	assert.Nil(t, p.TemplateSave(swarm))
+	assert.Equal(t, 4, swarm.Version)
+	assert.False(t, swarm.CreatedAt.IsZero())
+
+	other := &types.SessionTemplate{Name: "other", PlaygroundId: "foobar", Instances: instances}
+	_s.On("TemplatePut", other).Return(nil).Once()
+	assert.Nil(t, p.TemplateSave(other))
+	assert.Equal(t, 1, other.Version)
+
+	invalid := []*types.SessionTemplate{
+		{Name: "Not valid", PlaygroundId: "foobar", Instances: instances},
+		{Name: "empty", PlaygroundId: "foobar"},
+		{Name: "big", PlaygroundId: "foobar", Instances: append(instances, types.TemplateInstance{})},
+		{Name: "repeated", PlaygroundId: "foobar", Instances: []types.TemplateInstance{{Hostname: "node1"}, {Hostname: "node1"}}},
+		{Name: "files", PlaygroundId: "foobar", Instances: []types.TemplateInstance{{Files: []types.TemplateFile{{Path: "relative.txt"}}}}},
+	}
+	for _, template := range invalid {
+		assert.True(t, InvalidTemplate(p.TemplateSave(template)), template.Name)
+	}
+
+	_s.AssertExpectations(t)
+}
+
+func TestTemplateList(t *testing.T) {
+	_s := &storage.Mock{}
+	p := NewPWD(&docker.FactoryMock{}, &event.Mock{}, _s, nil, nil)
+
+	_s.On("TemplateFindByPlaygroundId", "foobar").Return([]*types.SessionTemplate{
+		{Name: "swarm", Version: 2},
+		{Name: "k8s", Version: 1},
+		{Name: "swarm", Version: 3},
+		{Name: "swarm", Version: 1},
+	}, nil)
+
+	templates, err := p.TemplateList("foobar")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SessionTemplate{{Name: "swarm", Version: 3}, {Name: "k8s", Version: 1}}, templates)
+
+	_s.AssertExpectations(t)
+}
@@ -19,6 +19,7 @@ type Instance struct {
 	SessionHost string          `json:"session_host" bson:"session_host"`
 	Type        string          `json:"type" bson:"type"`
 	WindowsId   string          `json:"-" bson:"windows_id"`
+	Resources   ResourceLimits  `json:"resources" bson:"resources"`
 	ctx         context.Context `json:"-" bson:"-"`
 }
 
@@ -42,4 +43,7 @@ type InstanceConfig struct {
 	DindVolumeSize string
 	Envs           []string
 	Networks       []string
+	// Resources overrides the limits of the playground, which it can only
+	// lower.
+	Resources ResourceLimits
 }
@@ -0,0 +1,11 @@
+package types
+
+import "time"
+
+// Lease is a named lock that Holder keeps until ExpiresAt unless it renews
+// it.
+type Lease struct {
+	Name      string    `json:"name" bson:"name"`
+	Holder    string    `json:"holder" bson:"holder"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
@@ -3,6 +3,8 @@ package types
 import (
 	"strconv"
 	"time"
+
+	units "github.com/docker/go-units"
 )
 
 type PlaygroundExtras map[string]interface{}
@@ -78,6 +80,9 @@ type Playground struct {
 	AvailableDinDInstanceImages []string         `json:"available_dind_instance_images" bson:"available_dind_instance_images"`
 	AllowWindowsInstances       bool             `json:"allow_windows_instances" bson:"allow_windows_instances"`
 	DefaultSessionDuration      time.Duration    `json:"default_session_duration" bson:"default_session_duration"`
+	MaxSessionDuration          time.Duration    `json:"max_session_duration" bson:"max_session_duration"`
+	IdleTimeout                 time.Duration    `json:"idle_timeout" bson:"idle_timeout"`
+	SnapshotDuration            time.Duration    `json:"snapshot_duration" bson:"snapshot_duration"`
 	DindVolumeSize              string           `json:"dind_volume_size" bson:"dind_volume_size"`
 	Extras                      PlaygroundExtras `json:"extras" bson:"extras"`
 	AssetsDir                   string           `json:"assets_dir" bson:"assets_dir"`
@@ -91,5 +96,82 @@ type Playground struct {
 	AuthRedirectBase            string           `json:"auth_redirect_base" bson:"auth_redirect_base"`
 	DockerHost                  string           `json:"docker_host" bson:"docker_host"`
 	MaxInstances                int              `json:"max_instances" bson:"max_instances"`
+	WarmPoolSize                int              `json:"warm_pool_size" bson:"warm_pool_size"`
 	Privileged                  bool             `json:"privileged" bson:"privileged"`
+	Webhooks                    []Webhook        `json:"webhooks" bson:"webhooks"`
+	HealthPolicy                HealthPolicy     `json:"health_policy" bson:"health_policy"`
+	Resources                   ResourceLimits   `json:"resources" bson:"resources"`
+	Quotas                      Quotas           `json:"quotas" bson:"quotas"`
+}
+
+// Quotas bound how much of a playground can be used at the same time.
+// Sessions are counted per user, per source IP and in total, while memory and
+// CPUs are summed over the instances of a session. Zero values mean no
+// quota.
+type Quotas struct {
+	MaxSessionsPerUser int     `json:"max_sessions_per_user" bson:"max_sessions_per_user"`
+	MaxSessionsPerIP   int     `json:"max_sessions_per_ip" bson:"max_sessions_per_ip"`
+	MaxSessions        int     `json:"max_sessions" bson:"max_sessions"`
+	MaxSessionMemoryMB int64   `json:"max_session_memory_mb" bson:"max_session_memory_mb"`
+	MaxSessionCPUs     float64 `json:"max_session_cpus" bson:"max_session_cpus"`
+}
+
+// ResourceLimits bound what an instance container can use. CPUs is the CPU
+// quota in number of CPUs and StorageSize the size of its root filesystem,
+// like 10G. SeccompProfile is either unconfined or the JSON of a seccomp
+// profile. Zero values mean no limit, or the daemon's default profile.
+type ResourceLimits struct {
+	CPUs            float64 `json:"cpus" bson:"cpus"`
+	MemoryMB        int64   `json:"memory_mb" bson:"memory_mb"`
+	PidsLimit       int64   `json:"pids_limit" bson:"pids_limit"`
+	StorageSize     string  `json:"storage_size" bson:"storage_size"`
+	AppArmorProfile string  `json:"apparmor_profile" bson:"apparmor_profile"`
+	SeccompProfile  string  `json:"seccomp_profile" bson:"seccomp_profile"`
+}
+
+// Bound returns the limits of an instance of a playground limited by l that
+// asks for override. Limits of override are only taken when they're below
+// the ones of l, and security profiles always come from l.
+func (l ResourceLimits) Bound(override ResourceLimits) ResourceLimits {
+	b := l
+	if override.CPUs > 0 && (l.CPUs <= 0 || override.CPUs < l.CPUs) {
+		b.CPUs = override.CPUs
+	}
+	if override.MemoryMB > 0 && (l.MemoryMB <= 0 || override.MemoryMB < l.MemoryMB) {
+		b.MemoryMB = override.MemoryMB
+	}
+	if override.PidsLimit > 0 && (l.PidsLimit <= 0 || override.PidsLimit < l.PidsLimit) {
+		b.PidsLimit = override.PidsLimit
+	}
+	if size, err := units.RAMInBytes(override.StorageSize); err == nil && size > 0 {
+		if max, err := units.RAMInBytes(l.StorageSize); err != nil || size < max {
+			b.StorageSize = override.StorageSize
+		}
+	}
+	return b
+}
+
+const (
+	UnhealthyActionNone     = ""
+	UnhealthyActionRecreate = "recreate"
+	UnhealthyActionDelete   = "delete"
+)
+
+// HealthPolicy decides when an instance whose scheduler tasks keep failing
+// is considered unhealthy and what is done with it then. Action is one of the
+// UnhealthyAction constants.
+type HealthPolicy struct {
+	FailureThreshold int    `json:"failure_threshold" bson:"failure_threshold"`
+	Action           string `json:"action" bson:"action"`
+}
+
+// Webhook is an URL that gets POSTed the events of the sessions of a
+// playground. Requests are signed with an HMAC-SHA256 of the body using
+// Secret. Events holds the names of the events to deliver and defaults to the
+// session and instance lifecycle ones when empty.
+type Webhook struct {
+	Id     string   `json:"id" bson:"id"`
+	URL    string   `json:"url" bson:"url"`
+	Secret string   `json:"secret" bson:"secret"`
+	Events []string `json:"events" bson:"events"`
 }
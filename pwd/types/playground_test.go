@@ -117,3 +117,13 @@ func TestPlayground_Extras_GetDuration(t *testing.T) {
 	assert.True(t, found)
 	assert.Equal(t, time.Hour*3, v)
 }
+
+func TestResourceLimits_Bound(t *testing.T) {
+	l := ResourceLimits{CPUs: 2, MemoryMB: 2048, StorageSize: "10G", SeccompProfile: "default.json"}
+
+	assert.Equal(t, l, l.Bound(ResourceLimits{}))
+	assert.Equal(t, l, l.Bound(ResourceLimits{CPUs: 4, MemoryMB: 4096, StorageSize: "20G", SeccompProfile: "unconfined"}))
+	assert.Equal(t,
+		ResourceLimits{CPUs: 0.5, MemoryMB: 512, PidsLimit: 100, StorageSize: "5G", SeccompProfile: "default.json"},
+		l.Bound(ResourceLimits{CPUs: 0.5, MemoryMB: 512, PidsLimit: 100, StorageSize: "5G"}))
+}
@@ -11,6 +11,10 @@ type SessionConfig struct {
 	Stack      string
 	StackName  string
 	ImageName  string
+	SourceIP   string
+	// DockerHost pins the session to a docker host instead of letting
+	// placement pick one.
+	DockerHost string
 }
 
 type Session struct {
@@ -25,4 +29,12 @@ type Session struct {
 	Host         string    `json:"host" bson:"host"`
 	UserId       string    `json:"user_id" bson:"user_id"`
 	PlaygroundId string    `json:"playground_id" bson:"playground_id"`
+	// SourceIP is the address the session was requested from.
+	SourceIP string `json:"source_ip" bson:"source_ip"`
+	// DockerHost is the address of the docker daemon the session was placed
+	// on. Empty means the local one.
+	DockerHost string `json:"docker_host" bson:"docker_host"`
+	// LastActivityAt is when somebody last used the session, which is what
+	// idle sessions are reaped by.
+	LastActivityAt time.Time `json:"last_activity_at" bson:"last_activity_at"`
 }
@@ -0,0 +1,42 @@
+package types
+
+import "time"
+
+const (
+	SetupRunning = "running"
+	SetupDone    = "done"
+	SetupFailed  = "failed"
+)
+
+const (
+	SetupStepInstanceCreated = "instance_created"
+	SetupStepSwarmJoined     = "swarm_joined"
+	SetupStepK8sJoined       = "k8s_joined"
+	SetupStepCommandStarted  = "command_started"
+	SetupStepCommandFinished = "command_finished"
+	SetupStepFinished        = "setup_finished"
+)
+
+// SessionSetupStatus is the progress of the setup of a session. State is one
+// of the Setup constants.
+type SessionSetupStatus struct {
+	SessionId  string             `json:"session_id" bson:"session_id"`
+	State      string             `json:"state" bson:"state"`
+	Error      string             `json:"error" bson:"error"`
+	StartedAt  time.Time          `json:"started_at" bson:"started_at"`
+	FinishedAt time.Time          `json:"finished_at" bson:"finished_at"`
+	Steps      []SessionSetupStep `json:"steps" bson:"steps"`
+}
+
+// SessionSetupStep is a step of the setup of an instance. ExitCode and Output
+// are only set when a command finishes.
+type SessionSetupStep struct {
+	Hostname string    `json:"hostname" bson:"hostname"`
+	Instance string    `json:"instance" bson:"instance"`
+	Step     string    `json:"step" bson:"step"`
+	Command  []string  `json:"command" bson:"command"`
+	ExitCode int       `json:"exit_code" bson:"exit_code"`
+	Output   string    `json:"output" bson:"output"`
+	Error    string    `json:"error" bson:"error"`
+	At       time.Time `json:"at" bson:"at"`
+}
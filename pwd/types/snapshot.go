@@ -0,0 +1,38 @@
+package types
+
+import "time"
+
+// Snapshot is the saved state of a session that can be restored into a new
+// one. Its instances were committed to images on DockerHost, which is where
+// restored sessions have to be placed. Id is random, as it's all it takes to
+// restore snapshots of playgrounds without users, while Name is only unique
+// among the snapshots of a user.
+type Snapshot struct {
+	Id           string             `json:"id" bson:"id"`
+	Name         string             `json:"name" bson:"name"`
+	SessionId    string             `json:"session_id" bson:"session_id"`
+	PlaygroundId string             `json:"playground_id" bson:"playground_id"`
+	UserId       string             `json:"user_id" bson:"user_id"`
+	DockerHost   string             `json:"docker_host" bson:"docker_host"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time          `json:"expires_at" bson:"expires_at"`
+	Instances    []SnapshotInstance `json:"instances" bson:"instances"`
+}
+
+// SnapshotInstance is an instance of a snapshot. Image is the one it was
+// committed to, or the one it was created from for instances that can't be
+// committed, like windows ones.
+type SnapshotInstance struct {
+	Hostname    string         `json:"hostname" bson:"hostname"`
+	Image       string         `json:"image" bson:"image"`
+	SourceImage string         `json:"source_image" bson:"source_image"`
+	Committed   bool           `json:"committed" bson:"committed"`
+	Type        string         `json:"type" bson:"type"`
+	Tls         bool           `json:"tls" bson:"tls"`
+	ServerCert  []byte         `json:"server_cert" bson:"server_cert"`
+	ServerKey   []byte         `json:"server_key" bson:"server_key"`
+	CACert      []byte         `json:"ca_cert" bson:"ca_cert"`
+	Cert        []byte         `json:"cert" bson:"cert"`
+	Key         []byte         `json:"key" bson:"key"`
+	Resources   ResourceLimits `json:"resources" bson:"resources"`
+}
@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+// SessionTemplate describes how to set up a new session of a playground.
+// Saving a template under an existing name adds a new version of it, older
+// versions are kept.
+type SessionTemplate struct {
+	Name         string             `json:"name" bson:"name"`
+	PlaygroundId string             `json:"playground_id" bson:"playground_id"`
+	Version      int                `json:"version" bson:"version"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	Instances    []TemplateInstance `json:"instances" bson:"instances"`
+}
+
+type TemplateInstance struct {
+	Image             string         `json:"image" bson:"image"`
+	Hostname          string         `json:"hostname" bson:"hostname"`
+	IsSwarmManager    bool           `json:"is_swarm_manager" bson:"is_swarm_manager"`
+	IsSwarmWorker     bool           `json:"is_swarm_worker" bson:"is_swarm_worker"`
+	IsK8sControlPlane bool           `json:"is_k8s_control_plane" bson:"is_k8s_control_plane"`
+	IsK8sWorker       bool           `json:"is_k8s_worker" bson:"is_k8s_worker"`
+	Type              string         `json:"type" bson:"type"`
+	Tls               bool           `json:"tls" bson:"tls"`
+	Envs              []string       `json:"envs" bson:"envs"`
+	Files             []TemplateFile `json:"files" bson:"files"`
+	Run               [][]string     `json:"run" bson:"run"`
+}
+
+// TemplateFile is a file uploaded to an instance before its commands are run.
+// Its contents are either Content or whatever is downloaded from Url.
+type TemplateFile struct {
+	Path    string `json:"path" bson:"path"`
+	Content []byte `json:"content" bson:"content"`
+	Url     string `json:"url" bson:"url"`
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type User struct {
 	Id             string `json:"id" bson:"id"`
 	Name           string `json:"name" bson:"name"`
@@ -11,6 +13,7 @@ type User struct {
 }
 
 type LoginRequest struct {
-	Id       string `json:"id" bson:"id"`
-	Provider string `json:"provider" bson:"provider"`
+	Id        string    `json:"id" bson:"id"`
+	Provider  string    `json:"provider" bson:"provider"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
 }
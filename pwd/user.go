@@ -2,7 +2,10 @@ package pwd
 
 import (
 	"errors"
+	"log"
+	"time"
 
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/storage"
 )
@@ -11,6 +14,9 @@ var userBannedError = errors.New("User is banned")
 
 func (p *pwd) UserNewLoginRequest(providerName string) (*types.LoginRequest, error) {
 	req := &types.LoginRequest{Id: p.generator.NewId(), Provider: providerName}
+	if config.LoginRequestTTL > 0 {
+		req.ExpiresAt = time.Now().Add(config.LoginRequestTTL)
+	}
 	if err := p.storage.LoginRequestPut(req); err != nil {
 		return nil, err
 	}
@@ -20,11 +26,30 @@ func (p *pwd) UserNewLoginRequest(providerName string) (*types.LoginRequest, err
 func (p *pwd) UserGetLoginRequest(id string) (*types.LoginRequest, error) {
 	if req, err := p.storage.LoginRequestGet(id); err != nil {
 		return nil, err
+	} else if !req.ExpiresAt.IsZero() && time.Now().After(req.ExpiresAt) {
+		// The sweeper might not have removed it yet
+		return nil, storage.NotFoundError
 	} else {
 		return req, nil
 	}
 }
 
+// UserDeleteExpiredLoginRequests removes login requests of OAuth attempts
+// that were never completed. It returns how many were removed.
+func (p *pwd) UserDeleteExpiredLoginRequests() (int, error) {
+	reqs, err := p.storage.LoginRequestFindExpired(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, req := range reqs {
+		if err := p.storage.LoginRequestDelete(req.Id); err != nil {
+			log.Printf("Error deleting login request %s. Got: %v\n", req.Id, err)
+			return 0, err
+		}
+	}
+	return len(reqs), nil
+}
+
 func (p *pwd) UserLogin(loginRequest *types.LoginRequest, user *types.User) (*types.User, error) {
 	if err := p.storage.LoginRequestDelete(loginRequest.Id); err != nil {
 		return nil, err
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const activityReportInterval = 30 * time.Second
+
+// activityReporter collects the sessions connections were proxied to and
+// periodically reports them to PWD so they aren't reaped for being idle.
+type activityReporter struct {
+	url    string
+	token  string
+	client *http.Client
+
+	mx       sync.Mutex
+	sessions map[string]bool
+}
+
+func newActivityReporter(url, token string) *activityReporter {
+	return &activityReporter{url: url, token: token, client: &http.Client{Timeout: 10 * time.Second}, sessions: map[string]bool{}}
+}
+
+func (a *activityReporter) touch(sessionId string) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	a.sessions[sessionId] = true
+}
+
+func (a *activityReporter) flush() error {
+	a.mx.Lock()
+	sessionIds := make([]string, 0, len(a.sessions))
+	for sessionId := range a.sessions {
+		sessionIds = append(sessionIds, sessionId)
+	}
+	a.sessions = map[string]bool{}
+	a.mx.Unlock()
+
+	if len(sessionIds) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(struct {
+		SessionIds []string `json:"session_ids"`
+	}{sessionIds})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("", a.token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Reporting activity responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (a *activityReporter) run() {
+	for range time.Tick(activityReportInterval) {
+		if err := a.flush(); err != nil {
+			log.Printf("Error reporting session activity. Got: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivityReporter(t *testing.T) {
+	reported := [][]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, token, ok := req.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "secret", token)
+
+		var body struct {
+			SessionIds []string `json:"session_ids"`
+		}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&body))
+		reported = append(reported, body.SessionIds)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	a := newActivityReporter(ts.URL, "secret")
+
+	// Nothing to report
+	assert.Nil(t, a.flush())
+	assert.Empty(t, reported)
+
+	a.touch("aaaabbbbcccc")
+	a.touch("aaaabbbbcccc")
+	assert.Nil(t, a.flush())
+	assert.Equal(t, [][]string{{"aaaabbbbcccc"}}, reported)
+
+	// Sessions are only reported once
+	assert.Nil(t, a.flush())
+	assert.Len(t, reported, 1)
+}
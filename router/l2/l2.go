@@ -23,12 +23,18 @@ import (
 	"github.com/urfave/negroni"
 )
 
+var activity *activityReporter
+
 func director(protocol router.Protocol, host string) (*router.DirectorInfo, error) {
 	info, err := router.DecodeHost(host)
 	if err != nil {
 		return nil, err
 	}
 
+	if activity != nil && protocol != router.ProtocolDNS {
+		activity.touch(info.SessionId)
+	}
+
 	port := info.Port
 
 	if info.EncodedPort > 0 {
@@ -139,6 +145,11 @@ func main() {
 	}
 	go monitorNetworks()
 
+	if config.ActivityURL != "" {
+		activity = newActivityReporter(config.ActivityURL, config.AdminToken)
+		go activity.run()
+	}
+
 	ro := mux.NewRouter()
 	ro.HandleFunc("/ping", ping).Methods("GET")
 	n := negroni.Classic()
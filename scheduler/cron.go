@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule tells when a playground task is due after t. A zero time
+// means never.
+type cronSchedule interface {
+	Next(t time.Time) time.Time
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// specSchedule is a standard five field cron expression: minute, hour, day
+// of month, month and day of week. Every field is a bitmask of the values it
+// matches.
+type specSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, when both days are restricted either of them matching is
+	// enough.
+	domStar, dowStar bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronBounds struct {
+	min, max int
+}
+
+var (
+	minuteBounds = cronBounds{0, 59}
+	hourBounds   = cronBounds{0, 23}
+	domBounds    = cronBounds{1, 31}
+	monthBounds  = cronBounds{1, 12}
+	// Both 0 and 7 are sunday
+	dowBounds = cronBounds{0, 7}
+)
+
+func parseCron(spec string) (cronSchedule, error) {
+	if e, found := cronDescriptors[spec]; found {
+		spec = e
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression [%s]. Got: %v", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("Invalid cron expression [%s]. Interval must be positive", spec)
+		}
+		return everySchedule(d), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid cron expression [%s]. Expected 5 fields but got %d", spec, len(fields))
+	}
+
+	s := &specSchedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	for i, f := range []struct {
+		dst    *uint64
+		bounds cronBounds
+	}{{&s.minute, minuteBounds}, {&s.hour, hourBounds}, {&s.dom, domBounds}, {&s.month, monthBounds}, {&s.dow, dowBounds}} {
+		bits, err := parseCronField(fields[i], f.bounds)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression [%s]. Got: %v", spec, err)
+		}
+		*f.dst = bits
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and *,
+// each optionally followed by /step.
+func parseCronField(field string, bounds cronBounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in [%s]", item)
+			}
+			step = s
+			item = item[:i]
+		}
+
+		from, to := bounds.min, bounds.max
+		if item != "*" {
+			parts := strings.SplitN(item, "-", 2)
+			v, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value [%s]", parts[0])
+			}
+			from, to = v, v
+			if len(parts) == 2 {
+				if to, err = strconv.Atoi(parts[1]); err != nil {
+					return 0, fmt.Errorf("invalid value [%s]", parts[1])
+				}
+			} else if step > 1 {
+				// a/step means from a to the end
+				to = bounds.max
+			}
+		}
+		if from < bounds.min || to > bounds.max || from > to {
+			return 0, fmt.Errorf("[%s] is out of range %d-%d", item, bounds.min, bounds.max)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func matches(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (s *specSchedule) dayMatches(t time.Time) bool {
+	dom := matches(s.dom, t.Day())
+	dow := matches(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *specSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Give up on expressions that never match, like the 30th of February
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !matches(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !matches(s.hour, t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !matches(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// parseTaskEntry splits an entry of Playground.Tasks into its cron schedule
+// and the expression matching task names. Entries without a schedule, like
+// "docker_.*", select instance tasks. Scheduled entries select playground
+// tasks and look like "*/5 * * * * prune_.*", "@hourly refresh_images" or
+// "@every 30s prune_.*".
+func parseTaskEntry(entry string) (cronSchedule, string, error) {
+	fields := strings.Fields(entry)
+	var spec, expr string
+	switch {
+	case len(fields) >= 3 && fields[0] == "@every":
+		spec, expr = strings.Join(fields[:2], " "), strings.Join(fields[2:], " ")
+	case len(fields) >= 2 && strings.HasPrefix(fields[0], "@"):
+		spec, expr = fields[0], strings.Join(fields[1:], " ")
+	case len(fields) == 6:
+		spec, expr = strings.Join(fields[:5], " "), fields[5]
+	default:
+		return nil, entry, nil
+	}
+	schedule, err := parseCron(spec)
+	if err != nil {
+		return nil, "", err
+	}
+	return schedule, expr, nil
+}
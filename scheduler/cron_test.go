@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	from := time.Date(2021, time.March, 10, 14, 37, 20, 0, time.UTC)
+
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.March, 10, 14, 38, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.March, 10, 14, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2021, time.March, 11, 3, 0, 0, 0, time.UTC)},
+		{"30 8-10 * * 1-5", time.Date(2021, time.March, 11, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.March, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2021, time.March, 12, 0, 0, 0, 0, time.UTC)},
+		{"5,10 12 1 1 *", time.Date(2022, time.January, 1, 12, 5, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.March, 10, 15, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		schedule, err := parseCron(c.spec)
+		assert.Nil(t, err, c.spec)
+		assert.Equal(t, c.next, schedule.Next(from), c.spec)
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *", "@every -1s", "@every"} {
+		_, err := parseCron(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestParseTaskEntry(t *testing.T) {
+	schedule, expr, err := parseTaskEntry("docker_.*")
+	assert.Nil(t, err)
+	assert.Nil(t, schedule)
+	assert.Equal(t, "docker_.*", expr)
+
+	schedule, expr, err = parseTaskEntry("*/5 * * * * prune_.*")
+	assert.Nil(t, err)
+	assert.NotNil(t, schedule)
+	assert.Equal(t, "prune_.*", expr)
+
+	schedule, expr, err = parseTaskEntry("@daily refresh_images")
+	assert.Nil(t, err)
+	assert.NotNil(t, schedule)
+	assert.Equal(t, "refresh_images", expr)
+
+	schedule, expr, err = parseTaskEntry("@every 30s prune_.*")
+	assert.Nil(t, err)
+	assert.Equal(t, everySchedule(30*time.Second), schedule)
+	assert.Equal(t, "prune_.*", expr)
+
+	_, _, err = parseTaskEntry("@sometimes prune_.*")
+	assert.NotNil(t, err)
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"regexp"
 	"sync"
 	"time"
 
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satori/go.uuid"
 )
 
 type Task interface {
@@ -19,6 +23,75 @@ type Task interface {
 	Run(ctx context.Context, instance *types.Instance) error
 }
 
+// PlaygroundTask runs on a whole playground on the cron schedule of the
+// entries of Playground.Tasks that match it.
+type PlaygroundTask interface {
+	Name() string
+	Run(ctx context.Context, playground *types.Playground) error
+}
+
+// IntervalTask is implemented by tasks that need to run less often than
+// every defaultTaskInterval.
+type IntervalTask interface {
+	Interval() time.Duration
+}
+
+// TimeoutTask is implemented by tasks and playground tasks that need a
+// deadline other than defaultTaskTimeout.
+type TimeoutTask interface {
+	Timeout() time.Duration
+}
+
+const (
+	defaultTaskInterval = time.Second
+	defaultTaskTimeout  = 10 * time.Second
+	defaultWorkers      = 32
+
+	// An instance is unhealthy after this many task runs in a row failed,
+	// unless its playground says otherwise. Tasks then back off starting at
+	// unhealthyBackoff and doubling up to maxUnhealthyBackoff.
+	defaultFailureThreshold = 10
+	unhealthyBackoff        = 5 * time.Second
+	maxUnhealthyBackoff     = 5 * time.Minute
+
+	defaultIdleGrace = 2 * time.Minute
+)
+
+func taskInterval(t Task) time.Duration {
+	if it, ok := t.(IntervalTask); ok && it.Interval() > 0 {
+		return it.Interval()
+	}
+	return defaultTaskInterval
+}
+
+func taskTimeout(t interface{}) time.Duration {
+	if tt, ok := t.(TimeoutTask); ok && tt.Timeout() > 0 {
+		return tt.Timeout()
+	}
+	return defaultTaskTimeout
+}
+
+var (
+	taskDurationHistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "scheduler_task_duration_seconds",
+		Help: "How long it took to run a task on an instance",
+	}, []string{"task"})
+	taskFailuresCounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_task_failures_total",
+		Help: "Task runs that returned an error or timed out",
+	}, []string{"task"})
+	taskSkippedCounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_task_skipped_total",
+		Help: "Task runs skipped because the previous one was still running or no worker was free",
+	}, []string{"task"})
+)
+
+func init() {
+	prometheus.MustRegister(taskDurationHistogramVec)
+	prometheus.MustRegister(taskFailuresCounterVec)
+	prometheus.MustRegister(taskSkippedCounterVec)
+}
+
 type SchedulerApi interface {
 	Start() error
 	Stop()
@@ -27,6 +100,9 @@ type SchedulerApi interface {
 type scheduledSession struct {
 	session *types.Session
 	cancel  context.CancelFunc
+	// extended receives the new expiration of the session when it's
+	// extended.
+	extended chan time.Time
 }
 
 type scheduledInstance struct {
@@ -34,38 +110,104 @@ type scheduledInstance struct {
 	playgroundId string
 	ticker       *time.Ticker
 	cancel       context.CancelFunc
-	fails        int
+
+	mx      sync.Mutex
+	lastRun map[string]time.Time
+	running map[string]bool
+	// fails counts the consecutive failed runs of each task
+	fails        map[string]int
+	unhealthy    bool
+	backoff      time.Duration
+	backoffUntil time.Time
 }
 
+type cronJob struct {
+	playground *types.Playground
+	task       PlaygroundTask
+	schedule   cronSchedule
+	next       time.Time
+	running    bool
+}
+
+// schedulerLease is held by the replica that schedules sessions and
+// instances. Every other replica stands by until it expires.
+const schedulerLease = "scheduler"
+
+const defaultLeaseTTL = 15 * time.Second
+
 type scheduler struct {
 	scheduledSessions  map[string]*scheduledSession
 	scheduledInstances map[string]*scheduledInstance
 	tasks              map[string]Task
 	playgrounds        map[string]*types.Playground
 	playgroundTasks    map[string][]Task
+	cronTasks          map[string]PlaygroundTask
+	cronJobs           map[string]*cronJob
+	cronTicker         *time.Ticker
 	started            bool
 	ticker             *time.Ticker
+	sweepTicker        *time.Ticker
+	electTicker        *time.Ticker
+	holder             string
+	leaseTTL           time.Duration
+	leader             bool
+	jobs               chan func()
+	expiryWarnings     []time.Duration
+	idleGrace          time.Duration
+	// idleWarned holds the last activity of the idle sessions that were
+	// already warned about being closed.
+	idleWarned map[string]time.Time
+	// closingIdle holds the idle sessions that are being closed, so later
+	// sweeps don't close them again.
+	closingIdle map[string]bool
 
 	storage storage.StorageApi
 	event   event.EventApi
 	pwd     pwd.PWDApi
 	mx      sync.Mutex
+	// smx guards leader, scheduledSessions and scheduledInstances, which are
+	// updated from event handlers running concurrently.
+	smx sync.Mutex
 }
 
-func NewScheduler(tasks []Task, s storage.StorageApi, e event.EventApi, p pwd.PWDApi) (*scheduler, error) {
-	sch := &scheduler{storage: s, event: e, pwd: p}
+func NewScheduler(tasks []Task, playgroundTasks []PlaygroundTask, s storage.StorageApi, e event.EventApi, p pwd.PWDApi) (*scheduler, error) {
+	sch := &scheduler{storage: s, event: e, pwd: p, leaseTTL: config.SchedulerLeaseTTL, expiryWarnings: config.SessionExpiryWarnings, idleGrace: config.SessionIdleGrace, idleWarned: map[string]time.Time{}, closingIdle: map[string]bool{}}
+	if sch.leaseTTL <= 0 {
+		sch.leaseTTL = defaultLeaseTTL
+	}
+	if sch.idleGrace <= 0 {
+		sch.idleGrace = defaultIdleGrace
+	}
+	workers := config.SchedulerWorkers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	sch.jobs = make(chan func(), workers)
+	for i := 0; i < workers; i++ {
+		go sch.work()
+	}
+
+	hostname, _ := os.Hostname()
+	sch.holder = fmt.Sprintf("%s-%s", hostname, uuid.NewV4().String())
 
 	sch.tasks = make(map[string]Task)
 	sch.scheduledSessions = make(map[string]*scheduledSession)
 	sch.scheduledInstances = make(map[string]*scheduledInstance)
 	sch.playgrounds = make(map[string]*types.Playground)
 	sch.playgroundTasks = make(map[string][]Task)
+	sch.cronTasks = make(map[string]PlaygroundTask)
+	sch.cronJobs = make(map[string]*cronJob)
 
 	for _, task := range tasks {
 		if err := sch.addTask(task); err != nil {
 			return nil, err
 		}
 	}
+	for _, task := range playgroundTasks {
+		if err := sch.addPlaygroundTask(task); err != nil {
+			return nil, err
+		}
+	}
 
 	return sch, nil
 }
@@ -85,6 +227,101 @@ func (s *scheduler) updatePlaygrounds() {
 		matchedTasks := s.getMatchedTasks(playground)
 		s.playgroundTasks[playground.Id] = matchedTasks
 	}
+
+	playgrounds, err := s.storage.PlaygroundGetAll()
+	if err != nil {
+		log.Printf("Could not retrieve playgrounds. Got: %v\n", err)
+		return
+	}
+	s.updateCronJobs(playgrounds, time.Now())
+}
+
+// updateCronJobs schedules the playground tasks every playground asks for.
+// Jobs that were already scheduled keep their next run. The caller must hold
+// mx.
+func (s *scheduler) updateCronJobs(playgrounds []*types.Playground, now time.Time) {
+	jobs := map[string]*cronJob{}
+	for _, playground := range playgrounds {
+		for _, entry := range playground.Tasks {
+			schedule, expr, err := parseTaskEntry(entry)
+			if err != nil {
+				log.Printf("Invalid task entry [%s] in playground %s. Got: %v\n", entry, playground.Id, err)
+				continue
+			}
+			if schedule == nil {
+				continue
+			}
+			for _, task := range s.cronTasks {
+				if !matchTask(expr, task.Name()) {
+					continue
+				}
+				key := fmt.Sprintf("%s/%s/%s", playground.Id, entry, task.Name())
+				job, found := s.cronJobs[key]
+				if !found {
+					job = &cronJob{task: task, schedule: schedule, next: schedule.Next(now)}
+				}
+				job.playground = playground
+				jobs[key] = job
+			}
+		}
+	}
+	s.cronJobs = jobs
+}
+
+func (s *scheduler) scheduleCron() {
+	s.cronTicker = time.NewTicker(time.Second)
+	go func() {
+		for now := range s.cronTicker.C {
+			s.runCronJobs(now)
+		}
+	}()
+}
+
+// runCronJobs hands the playground tasks that are due to the worker pool.
+// Like instance tasks, a run is skipped while the previous one is still
+// going.
+func (s *scheduler) runCronJobs(now time.Time) {
+	if !s.isLeader() {
+		return
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, job := range s.cronJobs {
+		if job.next.IsZero() || now.Before(job.next) {
+			continue
+		}
+		job.next = job.schedule.Next(now)
+		name := job.task.Name()
+		if job.running {
+			taskSkippedCounterVec.WithLabelValues(name).Inc()
+			continue
+		}
+
+		job := job
+		task, playground := job.task, job.playground
+		run := func() {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), taskTimeout(task))
+			err := task.Run(ctx, playground)
+			cancel()
+			taskDurationHistogramVec.WithLabelValues(name).Observe(time.Since(start).Seconds())
+			if err != nil {
+				taskFailuresCounterVec.WithLabelValues(name).Inc()
+				log.Printf("Error running task %s on playground %s. Got: %v\n", name, playground.Id, err)
+			}
+
+			s.mx.Lock()
+			job.running = false
+			s.mx.Unlock()
+		}
+		select {
+		case s.jobs <- run:
+			job.running = true
+		default:
+			taskSkippedCounterVec.WithLabelValues(name).Inc()
+		}
+	}
 }
 
 func (s *scheduler) schedulePlaygroundsUpdate() {
@@ -97,21 +334,129 @@ func (s *scheduler) schedulePlaygroundsUpdate() {
 	}()
 }
 
+func (s *scheduler) scheduleSweep() {
+	s.sweepTicker = time.NewTicker(time.Minute)
+	go func() {
+		for range s.sweepTicker.C {
+			s.sweep()
+		}
+	}()
+}
+
+// sweep removes clients whose websocket died without closing, login
+// requests that were never completed, expired snapshots and idle sessions.
+func (s *scheduler) sweep() {
+	if !s.isLeader() {
+		return
+	}
+	if n, err := s.pwd.ClientCloseExpired(); err != nil {
+		log.Printf("Error closing expired clients. Got: %v\n", err)
+	} else if n > 0 {
+		log.Printf("Closed %d expired clients\n", n)
+	}
+	if n, err := s.pwd.UserDeleteExpiredLoginRequests(); err != nil {
+		log.Printf("Error deleting expired login requests. Got: %v\n", err)
+	} else if n > 0 {
+		log.Printf("Deleted %d expired login requests\n", n)
+	}
+	if n, err := s.pwd.SnapshotDeleteExpired(); err != nil {
+		log.Printf("Error deleting expired snapshots. Got: %v\n", err)
+	} else if n > 0 {
+		log.Printf("Deleted %d expired snapshots\n", n)
+	}
+	s.reapIdleSessions(time.Now())
+}
+
+func (s *scheduler) idleTimeout(playgroundId string) time.Duration {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	playground, found := s.playgrounds[playgroundId]
+	if !found {
+		return 0
+	}
+	return playground.IdleTimeout
+}
+
+// reapIdleSessions closes sessions nobody used for longer than the idle
+// timeout of their playground. Their clients are warned idleGrace before.
+func (s *scheduler) reapIdleSessions(now time.Time) {
+	sessions, err := s.storage.SessionGetAll()
+	if err != nil {
+		log.Printf("Error retrieving sessions. Got: %v\n", err)
+		return
+	}
+
+	warned := map[string]time.Time{}
+	for _, session := range sessions {
+		timeout := s.idleTimeout(session.PlaygroundId)
+		if timeout <= 0 {
+			continue
+		}
+		lastActivity := session.LastActivityAt
+		if lastActivity.IsZero() {
+			lastActivity = session.CreatedAt
+		}
+		closesAt := lastActivity.Add(timeout)
+		if !now.Before(closesAt) {
+			s.closeIdleSession(session, lastActivity)
+			continue
+		}
+		if now.Before(closesAt.Add(-s.idleGrace)) {
+			continue
+		}
+		if at, found := s.idleWarned[session.Id]; !found || !at.Equal(lastActivity) {
+			event.EmitPayload(s.event, event.SESSION_IDLE, session.Id, event.SessionIdlePayload{LastActivityAt: lastActivity, ClosesAt: closesAt})
+		}
+		warned[session.Id] = lastActivity
+	}
+	s.idleWarned = warned
+}
+
+// closeIdleSession closes session in the background unless an earlier sweep
+// is already closing it.
+func (s *scheduler) closeIdleSession(session *types.Session, lastActivity time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.closingIdle[session.Id] {
+		return
+	}
+	s.closingIdle[session.Id] = true
+
+	log.Printf("Closing session %s, idle since %s\n", session.Id, lastActivity)
+	go func() {
+		if err := s.pwd.SessionClose(session); err != nil {
+			log.Printf("Error closing idle session %s. Got: %v\n", session.Id, err)
+		}
+		s.mx.Lock()
+		delete(s.closingIdle, session.Id)
+		s.mx.Unlock()
+	}()
+}
+
+func matchTask(expr, name string) bool {
+	if expr == name {
+		return true
+	}
+	matched, err := regexp.MatchString(expr, name)
+	if err != nil {
+		return false
+	}
+	return matched
+}
+
 func (s *scheduler) getMatchedTasks(playground *types.Playground) []Task {
 	matchedTasks := []Task{}
-	for _, expr := range playground.Tasks {
+	for _, entry := range playground.Tasks {
+		schedule, expr, err := parseTaskEntry(entry)
+		if err != nil || schedule != nil {
+			// Scheduled entries are for playground tasks
+			continue
+		}
 		for _, task := range s.tasks {
-			if expr == task.Name() {
+			if matchTask(expr, task.Name()) {
 				matchedTasks = append(matchedTasks, task)
-				continue
-			}
-			matched, err := regexp.MatchString(expr, task.Name())
-			if err != nil {
-				continue
-			}
-			if matched {
-				matchedTasks = append(matchedTasks, task)
-				continue
 			}
 		}
 	}
@@ -125,15 +470,44 @@ func (s *scheduler) getTasks(playgroundId string) []Task {
 	return s.playgroundTasks[playgroundId]
 }
 
+// nextExpiryWarning returns the largest expiry warning that is still ahead
+// for a session expiring at expiresAt.
+func nextExpiryWarning(warnings []time.Duration, expiresAt, now time.Time) (time.Duration, bool) {
+	remaining := expiresAt.Sub(now)
+	var next time.Duration
+	found := false
+	for _, w := range warnings {
+		if w > 0 && w < remaining && w > next {
+			next = w
+			found = true
+		}
+	}
+	return next, found
+}
+
 func (s *scheduler) processSession(ctx context.Context, ss *scheduledSession) {
 	defer s.unscheduleSession(ss.session)
-	select {
-	case <-time.After(time.Until(ss.session.ExpiresAt)):
-		// Session has expired. Need to close the session.
-		s.pwd.SessionClose(ss.session)
-		return
-	case <-ctx.Done():
-		return
+	expiresAt := ss.session.ExpiresAt
+	for {
+		at := expiresAt
+		warning, warn := nextExpiryWarning(s.expiryWarnings, expiresAt, time.Now())
+		if warn {
+			at = expiresAt.Add(-warning)
+		}
+		select {
+		case <-time.After(time.Until(at)):
+			if warn {
+				event.EmitPayload(s.event, event.SESSION_EXPIRING, ss.session.Id, event.SessionExpiringPayload{ExpiresAt: expiresAt, Remaining: int(warning.Seconds())})
+				continue
+			}
+			// Session has expired. Need to close the session.
+			s.pwd.SessionClose(ss.session)
+			return
+		case expiresAt = <-ss.extended:
+			log.Printf("Rescheduled session %s to expire at %s\n", ss.session.Id, expiresAt)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 func (s *scheduler) processInstance(ctx context.Context, si *scheduledInstance) {
@@ -157,17 +531,171 @@ func (s *scheduler) processInstance(ctx context.Context, si *scheduledInstance)
 					log.Printf("Error retrieving instance %s from storage. Got: %v\n", si.instance.Name, err)
 					continue
 				}
+				now := time.Now()
 				for _, task := range s.getTasks(si.playgroundId) {
-					err := task.Run(ctx, si.instance)
-					if err != nil {
-						log.Printf("Error running task %s on instance %s. Got: %v\n", task.Name(), si.instance.Name, err)
-					}
+					s.runTask(ctx, si, task, now)
 				}
 			}
 		}
 	}
 }
 
+func (s *scheduler) work() {
+	for job := range s.jobs {
+		job()
+	}
+}
+
+// runTask hands task to the worker pool if it's due on the instance. Runs
+// are skipped when the previous one hasn't finished yet or every worker is
+// busy, so a hung task never piles up.
+func (s *scheduler) runTask(ctx context.Context, si *scheduledInstance, task Task, now time.Time) {
+	name := task.Name()
+
+	si.mx.Lock()
+	defer si.mx.Unlock()
+
+	if now.Before(si.backoffUntil) || now.Sub(si.lastRun[name]) < taskInterval(task) {
+		return
+	}
+	if si.running[name] {
+		taskSkippedCounterVec.WithLabelValues(name).Inc()
+		return
+	}
+
+	job := func() {
+		start := time.Now()
+		tctx, cancel := context.WithTimeout(ctx, taskTimeout(task))
+		err := task.Run(tctx, si.instance)
+		cancel()
+		taskDurationHistogramVec.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			taskFailuresCounterVec.WithLabelValues(name).Inc()
+			log.Printf("Error running task %s on instance %s. Got: %v\n", name, si.instance.Name, err)
+		}
+
+		si.mx.Lock()
+		si.running[name] = false
+		si.mx.Unlock()
+
+		s.trackHealth(si, name, err)
+	}
+	select {
+	case s.jobs <- job:
+		si.lastRun[name] = now
+		si.running[name] = true
+	default:
+		taskSkippedCounterVec.WithLabelValues(name).Inc()
+	}
+}
+
+func (s *scheduler) healthPolicy(playgroundId string) types.HealthPolicy {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	policy := types.HealthPolicy{}
+	if playground, found := s.playgrounds[playgroundId]; found {
+		policy = playground.HealthPolicy
+	}
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = defaultFailureThreshold
+	}
+	return policy
+}
+
+// trackHealth counts consecutive failed runs of each task of an instance.
+// When those of a task reach the failure threshold of its playground the
+// instance is reported as unhealthy, its tasks back off and the playground's
+// unhealthy action is applied. It's healthy again once every failing task
+// succeeded, as other tasks succeeding says nothing about them.
+func (s *scheduler) trackHealth(si *scheduledInstance, name string, err error) {
+	policy := s.healthPolicy(si.playgroundId)
+
+	si.mx.Lock()
+	if err == nil {
+		delete(si.fails, name)
+		if len(si.fails) == 0 {
+			si.unhealthy = false
+			si.backoff = 0
+			si.backoffUntil = time.Time{}
+		}
+		si.mx.Unlock()
+		return
+	}
+	si.fails[name]++
+	fails := si.fails[name]
+	if fails < policy.FailureThreshold {
+		si.mx.Unlock()
+		return
+	}
+	if si.backoff == 0 {
+		si.backoff = unhealthyBackoff
+	} else if si.backoff < maxUnhealthyBackoff {
+		si.backoff *= 2
+		if si.backoff > maxUnhealthyBackoff {
+			si.backoff = maxUnhealthyBackoff
+		}
+	}
+	si.backoffUntil = time.Now().Add(si.backoff)
+	reported := si.unhealthy
+	si.unhealthy = true
+	si.mx.Unlock()
+
+	if reported {
+		return
+	}
+	log.Printf("Instance %s is unhealthy after %d failures\n", si.instance.Name, fails)
+	event.EmitPayload(s.event, event.INSTANCE_UNHEALTHY, si.instance.SessionId, event.InstanceUnhealthyPayload{Instance: si.instance.Name, Fails: fails, Error: err.Error()})
+
+	switch policy.Action {
+	case types.UnhealthyActionDelete, types.UnhealthyActionRecreate:
+		go s.quarantine(si.instance, policy.Action)
+	}
+}
+
+func (s *scheduler) quarantine(instance *types.Instance, action string) {
+	session, err := s.pwd.SessionGet(instance.SessionId)
+	if err != nil {
+		log.Printf("Session [%s] of unhealthy instance %s was not found. Got: %v\n", instance.SessionId, instance.Name, err)
+		return
+	}
+	playground := s.pwd.PlaygroundGet(session.PlaygroundId)
+	if playground == nil {
+		log.Printf("Playground [%s] of unhealthy instance %s was not found\n", session.PlaygroundId, instance.Name)
+		return
+	}
+
+	log.Printf("Deleting unhealthy instance %s\n", instance.Name)
+	if err := s.pwd.InstanceDelete(session, instance); err != nil {
+		log.Printf("Error deleting unhealthy instance %s. Got: %v\n", instance.Name, err)
+		return
+	}
+	if action != types.UnhealthyActionRecreate {
+		return
+	}
+
+	conf := types.InstanceConfig{
+		ImageName:      instance.Image,
+		Hostname:       instance.Hostname,
+		Type:           instance.Type,
+		Tls:            instance.Tls,
+		ServerCert:     instance.ServerCert,
+		ServerKey:      instance.ServerKey,
+		CACert:         instance.CACert,
+		Cert:           instance.Cert,
+		Key:            instance.Key,
+		PlaygroundFQDN: playground.Domain,
+		Privileged:     playground.Privileged,
+		DindVolumeSize: "5G",
+	}
+	if len(playground.DindVolumeSize) > 0 {
+		conf.DindVolumeSize = playground.DindVolumeSize
+	}
+	if _, err := s.pwd.InstanceNew(session, conf); err != nil {
+		log.Printf("Error recreating unhealthy instance %s. Got: %v\n", instance.Name, err)
+	}
+}
+
 func (s *scheduler) addTask(task Task) error {
 	if _, found := s.tasks[task.Name()]; found {
 		return fmt.Errorf("Task [%s] was already added", task.Name())
@@ -177,7 +705,19 @@ func (s *scheduler) addTask(task Task) error {
 	return nil
 }
 
+func (s *scheduler) addPlaygroundTask(task PlaygroundTask) error {
+	if _, found := s.cronTasks[task.Name()]; found {
+		return fmt.Errorf("Playground task [%s] was already added", task.Name())
+	}
+	s.cronTasks[task.Name()] = task
+
+	return nil
+}
+
 func (s *scheduler) unscheduleSession(session *types.Session) {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+
 	ss, found := s.scheduledSessions[session.Id]
 	if !found {
 		return
@@ -188,18 +728,39 @@ func (s *scheduler) unscheduleSession(session *types.Session) {
 	log.Printf("Unscheduled session %s\n", session.Id)
 }
 func (s *scheduler) scheduleSession(session *types.Session) {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+
 	if _, found := s.scheduledSessions[session.Id]; found {
 		log.Printf("Session %s is already scheduled. Ignoring.\n", session.Id)
 		return
 	}
-	ss := &scheduledSession{session: session}
+	ss := &scheduledSession{session: session, extended: make(chan time.Time, 1)}
 	s.scheduledSessions[session.Id] = ss
 	ctx, cancel := context.WithCancel(context.Background())
 	ss.cancel = cancel
 	go s.processSession(ctx, ss)
 	log.Printf("Scheduled session %s\n", session.Id)
 }
+func (s *scheduler) extendSession(sessionId string, expiresAt time.Time) {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+
+	ss, found := s.scheduledSessions[sessionId]
+	if !found {
+		return
+	}
+	// Only the latest expiration matters
+	select {
+	case <-ss.extended:
+	default:
+	}
+	ss.extended <- expiresAt
+}
 func (s *scheduler) unscheduleInstance(instance *types.Instance) {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+
 	si, found := s.scheduledInstances[instance.Name]
 	if !found {
 		return
@@ -210,11 +771,14 @@ func (s *scheduler) unscheduleInstance(instance *types.Instance) {
 	log.Printf("Unscheduled instance %s\n", instance.Name)
 }
 func (s *scheduler) scheduleInstance(instance *types.Instance, playgroundId string) {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+
 	if _, found := s.scheduledInstances[instance.Name]; found {
 		log.Printf("Instance %s is already scheduled. Ignoring.\n", instance.Name)
 		return
 	}
-	si := &scheduledInstance{instance: instance, playgroundId: playgroundId}
+	si := &scheduledInstance{instance: instance, playgroundId: playgroundId, lastRun: map[string]time.Time{}, running: map[string]bool{}, fails: map[string]int{}}
 	s.scheduledInstances[instance.Name] = si
 	ctx, cancel := context.WithCancel(context.Background())
 	si.cancel = cancel
@@ -223,31 +787,71 @@ func (s *scheduler) scheduleInstance(instance *types.Instance, playgroundId stri
 	log.Printf("Scheduled instance %s\n", instance.Name)
 }
 
-func (s *scheduler) Stop() {
-	s.ticker.Stop()
-	for _, ss := range s.scheduledSessions {
-		s.unscheduleSession(ss.session)
+func (s *scheduler) isLeader() bool {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+
+	return s.leader
+}
+
+// elect tries to acquire or renew the scheduler lease. The replica that gets
+// it starts scheduling every session, and one that loses it stops.
+func (s *scheduler) elect() error {
+	ok, err := s.storage.LeaseAcquire(schedulerLease, s.holder, s.leaseTTL)
+	if err != nil {
+		// We can't tell whether somebody else took over, so step down
+		log.Printf("Error acquiring scheduler lease. Got: %v\n", err)
 	}
-	for _, si := range s.scheduledInstances {
-		s.unscheduleInstance(si.instance)
+	leader := s.isLeader()
+	if ok && !leader {
+		log.Printf("Acquired scheduler lease as %s\n", s.holder)
+		if err := s.lead(); err != nil {
+			s.follow()
+			if err := s.storage.LeaseRelease(schedulerLease, s.holder); err != nil {
+				log.Printf("Error releasing scheduler lease. Got: %v\n", err)
+			}
+			return err
+		}
+	} else if !ok && leader {
+		log.Printf("Lost scheduler lease\n")
+		s.follow()
 	}
-	s.started = false
+	return nil
 }
 
-func (s *scheduler) Start() error {
+func (s *scheduler) scheduleElection() {
+	s.electTicker = time.NewTicker(s.leaseTTL / 3)
+	go func() {
+		for range s.electTicker.C {
+			if err := s.elect(); err != nil {
+				log.Printf("Error taking over scheduling. Got: %v\n", err)
+			}
+		}
+	}()
+}
+
+// lead schedules every session and instance in storage.
+func (s *scheduler) lead() error {
+	s.smx.Lock()
+	s.leader = true
+	s.smx.Unlock()
+
 	sessions, err := s.storage.SessionGetAll()
 	if err != nil {
 		return err
 	}
 	for _, session := range sessions {
 		s.scheduleSession(session)
+		s.mx.Lock()
 		if _, found := s.playgrounds[session.PlaygroundId]; !found {
 			playground, err := s.storage.PlaygroundGet(session.PlaygroundId)
 			if err != nil {
+				s.mx.Unlock()
 				return err
 			}
 			s.playgrounds[playground.Id] = playground
 		}
+		s.mx.Unlock()
 
 		instances, err := s.storage.InstanceFindBySessionId(session.Id)
 		if err != nil {
@@ -258,11 +862,58 @@ func (s *scheduler) Start() error {
 			s.scheduleInstance(instance, session.PlaygroundId)
 		}
 	}
+	s.updatePlaygrounds()
+	return nil
+}
+
+// follow unschedules everything, leaving it to the leader.
+func (s *scheduler) follow() {
+	s.smx.Lock()
+	s.leader = false
+	sessions := []*types.Session{}
+	for _, ss := range s.scheduledSessions {
+		sessions = append(sessions, ss.session)
+	}
+	instances := []*types.Instance{}
+	for _, si := range s.scheduledInstances {
+		instances = append(instances, si.instance)
+	}
+	s.smx.Unlock()
 
+	for _, session := range sessions {
+		s.unscheduleSession(session)
+	}
+	for _, instance := range instances {
+		s.unscheduleInstance(instance)
+	}
+}
+
+func (s *scheduler) Stop() {
+	s.ticker.Stop()
+	s.sweepTicker.Stop()
+	s.electTicker.Stop()
+	s.cronTicker.Stop()
+	s.follow()
+	if err := s.storage.LeaseRelease(schedulerLease, s.holder); err != nil {
+		log.Printf("Error releasing scheduler lease. Got: %v\n", err)
+	}
+	s.started = false
+}
+
+func (s *scheduler) Start() error {
 	// Refresh playground conf every 5 minutes
 	s.schedulePlaygroundsUpdate()
 
+	// Garbage collect expired clients and login requests every minute
+	s.scheduleSweep()
+
+	// Run playground tasks on their cron schedule
+	s.scheduleCron()
+
 	s.event.On(event.SESSION_NEW, func(sessionId string, args ...interface{}) {
+		if !s.isLeader() {
+			return
+		}
 		s.mx.Lock()
 		defer s.mx.Unlock()
 
@@ -287,12 +938,18 @@ func (s *scheduler) Start() error {
 		session := &types.Session{Id: sessionId}
 		s.unscheduleSession(session)
 	})
-	s.event.On(event.INSTANCE_NEW, func(sessionId string, args ...interface{}) {
-		instanceName := args[0].(string)
-		log.Printf("EVENT: Instance New %s\n", instanceName)
-		instance, err := s.storage.InstanceGet(instanceName)
+	event.Subscribe(s.event, event.SESSION_EXTENDED, func(sessionId string, p *event.SessionExtendedPayload) {
+		log.Printf("EVENT: Session Extended %s\n", sessionId)
+		s.extendSession(sessionId, p.ExpiresAt)
+	})
+	event.Subscribe(s.event, event.INSTANCE_NEW, func(sessionId string, p *event.InstanceNewPayload) {
+		if !s.isLeader() {
+			return
+		}
+		log.Printf("EVENT: Instance New %s\n", p.Name)
+		instance, err := s.storage.InstanceGet(p.Name)
 		if err != nil {
-			log.Printf("Instance [%s] was not found in storage. Got %s\n", instanceName, err)
+			log.Printf("Instance [%s] was not found in storage. Got %s\n", p.Name, err)
 			return
 		}
 		session, err := s.storage.SessionGet(instance.SessionId)
@@ -302,10 +959,9 @@ func (s *scheduler) Start() error {
 		}
 		s.scheduleInstance(instance, session.PlaygroundId)
 	})
-	s.event.On(event.INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
-		instanceName := args[0].(string)
-		log.Printf("EVENT: Instance Delete %s\n", instanceName)
-		instance := &types.Instance{Name: instanceName}
+	event.Subscribe(s.event, event.INSTANCE_DELETE, func(sessionId string, p *event.InstanceDeletePayload) {
+		log.Printf("EVENT: Instance Delete %s\n", p.Name)
+		instance := &types.Instance{Name: p.Name}
 		s.unscheduleInstance(instance)
 	})
 	s.event.On(event.PLAYGROUND_NEW, func(playgroundId string, args ...interface{}) {
@@ -318,7 +974,12 @@ func (s *scheduler) Start() error {
 		// We just update all playgrounds we manage to be safe. This is pretty fast anyway and this event should be fairly rare
 		s.updatePlaygrounds()
 	})
+
+	// Only one replica schedules sessions at a time. The others keep trying
+	// to take over in case it dies.
+	err := s.elect()
+	s.scheduleElection()
 	s.started = true
 
-	return nil
+	return err
 }
@@ -2,13 +2,19 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 type fakeTask struct {
@@ -34,7 +40,7 @@ func TestScheduler_getMatchedTasks(t *testing.T) {
 	_e := &event.Mock{}
 	_p := &pwd.Mock{}
 
-	s, err := NewScheduler(tasks, _s, _e, _p)
+	s, err := NewScheduler(tasks, []PlaygroundTask{}, _s, _e, _p)
 	assert.Nil(t, err)
 
 	// No matches
@@ -56,3 +62,363 @@ func TestScheduler_getMatchedTasks(t *testing.T) {
 	assert.Subset(t, []Task{fakeTask{name: "docker_task1"}}, matched)
 	assert.Len(t, matched, 1)
 }
+
+func scheduledSessions(s *scheduler) int {
+	s.smx.Lock()
+	defer s.smx.Unlock()
+	return len(s.scheduledSessions)
+}
+
+func TestScheduler_Failover(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	assert.Nil(t, err)
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
+
+	_s, err := storage.NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+	assert.Nil(t, _s.PlaygroundPut(&types.Playground{Id: "foobar"}))
+	assert.Nil(t, _s.SessionPut(&types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	newScheduler := func() *scheduler {
+		s, err := NewScheduler([]Task{}, []PlaygroundTask{}, _s, event.NewLocalBroker(), &pwd.Mock{})
+		assert.Nil(t, err)
+		s.leaseTTL = 30 * time.Millisecond
+		return s
+	}
+
+	s1 := newScheduler()
+	assert.Nil(t, s1.Start())
+	defer s1.Stop()
+	s2 := newScheduler()
+	assert.Nil(t, s2.Start())
+	defer s2.Stop()
+
+	assert.True(t, s1.isLeader())
+	assert.Equal(t, 1, scheduledSessions(s1))
+	assert.False(t, s2.isLeader())
+	assert.Equal(t, 0, scheduledSessions(s2))
+
+	// s1 dies without releasing its lease
+	s1.electTicker.Stop()
+
+	assert.Eventually(t, func() bool {
+		return s2.isLeader() && scheduledSessions(s2) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// When s1 comes back it finds out it isn't the leader anymore
+	assert.Nil(t, s1.elect())
+	assert.False(t, s1.isLeader())
+	assert.Equal(t, 0, scheduledSessions(s1))
+}
+
+type slowTask struct {
+	name     string
+	interval time.Duration
+	timeout  time.Duration
+	runs     chan error
+	release  chan struct{}
+}
+
+func (f *slowTask) Name() string {
+	return f.name
+}
+func (f *slowTask) Interval() time.Duration {
+	return f.interval
+}
+func (f *slowTask) Timeout() time.Duration {
+	return f.timeout
+}
+func (f *slowTask) Run(ctx context.Context, instance *types.Instance) error {
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+	}
+	f.runs <- ctx.Err()
+	return ctx.Err()
+}
+
+func newScheduledInstance() *scheduledInstance {
+	return &scheduledInstance{instance: &types.Instance{Name: "node1"}, lastRun: map[string]time.Time{}, running: map[string]bool{}, fails: map[string]int{}}
+}
+
+func TestScheduler_runTask_Interval(t *testing.T) {
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{})
+	assert.Nil(t, err)
+
+	task := &slowTask{name: "interval", interval: time.Minute, runs: make(chan error, 10), release: make(chan struct{})}
+	close(task.release)
+	si := newScheduledInstance()
+
+	now := time.Now()
+	s.runTask(context.Background(), si, task, now)
+	assert.Nil(t, <-task.runs)
+
+	s.runTask(context.Background(), si, task, now.Add(time.Second))
+	s.runTask(context.Background(), si, task, now.Add(time.Minute))
+	assert.Nil(t, <-task.runs)
+
+	select {
+	case <-task.runs:
+		t.Fatal("Task ran before its interval elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestScheduler_runTask_SkipWhileRunning(t *testing.T) {
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{})
+	assert.Nil(t, err)
+
+	task := &slowTask{name: "skip", runs: make(chan error, 10), release: make(chan struct{})}
+	si := newScheduledInstance()
+
+	now := time.Now()
+	s.runTask(context.Background(), si, task, now)
+	s.runTask(context.Background(), si, task, now.Add(time.Second))
+	assert.Equal(t, float64(1), testutil.ToFloat64(taskSkippedCounterVec.WithLabelValues("skip")))
+
+	close(task.release)
+	assert.Nil(t, <-task.runs)
+	select {
+	case <-task.runs:
+		t.Fatal("Skipped run was executed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestScheduler_runTask_Timeout(t *testing.T) {
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{})
+	assert.Nil(t, err)
+
+	task := &slowTask{name: "timeout", timeout: 10 * time.Millisecond, runs: make(chan error, 10), release: make(chan struct{})}
+	si := newScheduledInstance()
+
+	s.runTask(context.Background(), si, task, time.Now())
+	assert.Equal(t, context.DeadlineExceeded, <-task.runs)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(taskFailuresCounterVec.WithLabelValues("timeout")) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestScheduler_trackHealth(t *testing.T) {
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, &storage.Mock{}, _e, _p)
+	assert.Nil(t, err)
+
+	playground := &types.Playground{Id: "foobar", Domain: "localhost", HealthPolicy: types.HealthPolicy{FailureThreshold: 2, Action: types.UnhealthyActionDelete}}
+	s.playgrounds[playground.Id] = playground
+	session := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+	si := newScheduledInstance()
+	si.instance.SessionId = session.Id
+	si.playgroundId = playground.Id
+
+	deleted := make(chan struct{})
+	_e.M.On("Emit", event.INSTANCE_UNHEALTHY, "aaaabbbbcccc", []interface{}{event.InstanceUnhealthyPayload{Instance: "node1", Fails: 2, Error: "boom"}}).Return().Once()
+	_p.On("SessionGet", "aaaabbbbcccc").Return(session, nil)
+	_p.On("PlaygroundGet", "foobar").Return(playground)
+	_p.On("InstanceDelete", session, si.instance).Return(nil).Run(func(args mock.Arguments) {
+		close(deleted)
+	})
+
+	s.trackHealth(si, "check", fmt.Errorf("boom"))
+	assert.Equal(t, 1, si.fails["check"])
+	assert.True(t, si.backoffUntil.IsZero())
+
+	s.trackHealth(si, "check", fmt.Errorf("boom"))
+	assert.Equal(t, 2, si.fails["check"])
+	assert.Equal(t, unhealthyBackoff, si.backoff)
+	<-deleted
+
+	// Keeps backing off without reporting it again
+	s.trackHealth(si, "check", fmt.Errorf("boom"))
+	assert.Equal(t, 2*unhealthyBackoff, si.backoff)
+
+	// Skipped while backing off
+	task := &slowTask{name: "backoff", runs: make(chan error, 1), release: make(chan struct{})}
+	s.runTask(context.Background(), si, task, time.Now())
+	si.mx.Lock()
+	assert.False(t, si.running["backoff"])
+	si.mx.Unlock()
+
+	s.trackHealth(si, "check", nil)
+	assert.Equal(t, 0, si.fails["check"])
+	assert.True(t, si.backoffUntil.IsZero())
+
+	_e.M.AssertExpectations(t)
+	_p.AssertExpectations(t)
+}
+
+func TestScheduler_trackHealth_PerTask(t *testing.T) {
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, &storage.Mock{}, _e, _p)
+	assert.Nil(t, err)
+
+	playground := &types.Playground{Id: "foobar", Domain: "localhost", HealthPolicy: types.HealthPolicy{FailureThreshold: 3}}
+	s.playgrounds[playground.Id] = playground
+	si := newScheduledInstance()
+	si.instance.SessionId = "aaaabbbbcccc"
+	si.playgroundId = playground.Id
+
+	_e.M.On("Emit", event.INSTANCE_UNHEALTHY, "aaaabbbbcccc", []interface{}{event.InstanceUnhealthyPayload{Instance: "node1", Fails: 3, Error: "boom"}}).Return().Once()
+
+	// A task that always succeeds doesn't hide one that always fails
+	for i := 0; i < 3; i++ {
+		s.trackHealth(si, "failing", fmt.Errorf("boom"))
+		s.trackHealth(si, "working", nil)
+	}
+	assert.Equal(t, 3, si.fails["failing"])
+	assert.Equal(t, unhealthyBackoff, si.backoff)
+
+	_e.M.AssertExpectations(t)
+	_p.AssertExpectations(t)
+}
+
+func TestScheduler_processSession(t *testing.T) {
+	_e := event.NewLocalBroker()
+	_p := &pwd.Mock{}
+
+	warnings := make(chan *event.SessionExpiringPayload, 10)
+	event.Subscribe(_e, event.SESSION_EXPIRING, func(sessionId string, p *event.SessionExpiringPayload) {
+		warnings <- p
+	})
+
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, &storage.Mock{}, _e, _p)
+	assert.Nil(t, err)
+	s.expiryWarnings = []time.Duration{200 * time.Millisecond, 100 * time.Millisecond}
+
+	closed := make(chan time.Time, 1)
+	session := &types.Session{Id: "aaaabbbbcccc", ExpiresAt: time.Now().Add(300 * time.Millisecond)}
+	_p.On("SessionClose", session).Return(nil).Run(func(args mock.Arguments) {
+		closed <- time.Now()
+	})
+
+	s.scheduleSession(session)
+	expiresAt := time.Now().Add(600 * time.Millisecond)
+	s.extendSession(session.Id, expiresAt)
+
+	w := <-warnings
+	assert.WithinDuration(t, expiresAt, w.ExpiresAt, 0)
+	w = <-warnings
+	assert.WithinDuration(t, expiresAt, w.ExpiresAt, 0)
+
+	select {
+	case at := <-closed:
+		assert.False(t, at.Before(expiresAt))
+	case <-time.After(time.Second):
+		t.Fatal("Session was not closed")
+	}
+	assert.Eventually(t, func() bool { return scheduledSessions(s) == 0 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, warnings, 0)
+}
+
+func TestScheduler_reapIdleSessions(t *testing.T) {
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+
+	s, err := NewScheduler([]Task{}, []PlaygroundTask{}, _s, _e, _p)
+	assert.Nil(t, err)
+	s.playgrounds["foobar"] = &types.Playground{Id: "foobar", IdleTimeout: 10 * time.Minute}
+	s.playgrounds["nolimit"] = &types.Playground{Id: "nolimit"}
+
+	now := time.Now()
+	active := &types.Session{Id: "active", PlaygroundId: "foobar", LastActivityAt: now.Add(-time.Minute)}
+	idle := &types.Session{Id: "idle", PlaygroundId: "foobar", LastActivityAt: now.Add(-9 * time.Minute)}
+	expired := &types.Session{Id: "expired", PlaygroundId: "foobar", LastActivityAt: now.Add(-11 * time.Minute)}
+	untouched := &types.Session{Id: "untouched", PlaygroundId: "nolimit", LastActivityAt: now.Add(-time.Hour)}
+
+	closed := make(chan *types.Session, 1)
+	release := make(chan struct{})
+	_s.On("SessionGetAll").Return([]*types.Session{active, idle, expired, untouched}, nil)
+	_e.M.On("Emit", event.SESSION_IDLE, "idle", []interface{}{event.SessionIdlePayload{LastActivityAt: idle.LastActivityAt, ClosesAt: now.Add(time.Minute)}}).Return().Once()
+	_p.On("SessionClose", expired).Return(nil).Run(func(args mock.Arguments) {
+		closed <- args.Get(0).(*types.Session)
+		<-release
+	})
+
+	s.reapIdleSessions(now)
+	assert.Equal(t, expired, <-closed)
+
+	// Idle sessions are only warned once, and sessions being closed aren't
+	// closed again
+	s.reapIdleSessions(now.Add(time.Second))
+	select {
+	case <-closed:
+		t.Fatal("Session was closed twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.Eventually(t, func() bool {
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		return len(s.closingIdle) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	_e.M.AssertExpectations(t)
+	_p.AssertNumberOfCalls(t, "SessionClose", 1)
+}
+
+type fakePlaygroundTask struct {
+	name string
+	runs chan string
+}
+
+func (f *fakePlaygroundTask) Name() string {
+	return f.name
+}
+func (f *fakePlaygroundTask) Run(ctx context.Context, playground *types.Playground) error {
+	f.runs <- playground.Id
+	return nil
+}
+
+func TestScheduler_runCronJobs(t *testing.T) {
+	prune := &fakePlaygroundTask{name: "prune_networks", runs: make(chan string, 10)}
+	refresh := &fakePlaygroundTask{name: "refresh_images", runs: make(chan string, 10)}
+
+	s, err := NewScheduler([]Task{fakeTask{name: "docker_task1"}}, []PlaygroundTask{prune, refresh}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{})
+	assert.Nil(t, err)
+	s.leader = true
+
+	playground := &types.Playground{Id: "foobar", Tasks: []string{"docker_.*", "@every 1m prune_.*"}}
+	assert.Equal(t, []Task{fakeTask{name: "docker_task1"}}, s.getMatchedTasks(playground))
+
+	now := time.Now()
+	s.mx.Lock()
+	s.updateCronJobs([]*types.Playground{playground}, now)
+	s.mx.Unlock()
+	assert.Len(t, s.cronJobs, 1)
+
+	s.runCronJobs(now.Add(30 * time.Second))
+	s.runCronJobs(now.Add(time.Minute))
+	assert.Equal(t, "foobar", <-prune.runs)
+	assert.Eventually(t, func() bool {
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		for _, job := range s.cronJobs {
+			if job.running {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+
+	// Updating keeps the schedule of existing jobs
+	s.mx.Lock()
+	s.updateCronJobs([]*types.Playground{playground}, now.Add(time.Minute))
+	s.mx.Unlock()
+	s.runCronJobs(now.Add(90 * time.Second))
+	s.runCronJobs(now.Add(2 * time.Minute))
+	assert.Equal(t, "foobar", <-prune.runs)
+
+	select {
+	case <-prune.runs:
+		t.Fatal("Task ran before it was due")
+	case <-refresh.runs:
+		t.Fatal("Task that wasn't scheduled ran")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
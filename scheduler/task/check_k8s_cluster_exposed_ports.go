@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/k8s"
@@ -18,13 +19,17 @@ type checkK8sClusterExposedPortsTask struct {
 var CheckK8sClusterExpoedPortsEvent event.EventType
 
 func init() {
-	CheckK8sClusterExpoedPortsEvent = event.EventType("instance k8s cluster ports")
+	CheckK8sClusterExpoedPortsEvent = event.INSTANCE_K8S_CLUSTER_PORTS
 }
 
 func (t *checkK8sClusterExposedPortsTask) Name() string {
 	return "CheckK8sClusterPorts"
 }
 
+func (t *checkK8sClusterExposedPortsTask) Interval() time.Duration {
+	return 5 * time.Second
+}
+
 func NewCheckK8sClusterExposedPorts(e event.EventApi, f k8s.FactoryApi) *checkK8sClusterExposedPortsTask {
 	return &checkK8sClusterExposedPortsTask{event: e, factory: f}
 }
@@ -72,6 +77,6 @@ func (c checkK8sClusterExposedPortsTask) Run(ctx context.Context, i *types.Insta
 		instances = append(instances, node.Name)
 	}
 
-	c.event.Emit(CheckSwarmPortsEvent, i.SessionId, ClusterPorts{Manager: i.Name, Instances: instances, Ports: exposedPorts})
+	event.EmitPayload(c.event, CheckSwarmPortsEvent, i.SessionId, ClusterPorts{Manager: i.Name, Instances: instances, Ports: exposedPorts})
 	return nil
 }
@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/k8s"
@@ -17,7 +18,7 @@ type checkK8sClusterStatusTask struct {
 var CheckK8sStatusEvent event.EventType
 
 func init() {
-	CheckK8sStatusEvent = event.EventType("instance k8s status")
+	CheckK8sStatusEvent = event.INSTANCE_K8S_STATUS
 }
 
 func NewCheckK8sClusterStatus(e event.EventApi, f k8s.FactoryApi) *checkK8sClusterStatusTask {
@@ -28,18 +29,22 @@ func (c *checkK8sClusterStatusTask) Name() string {
 	return "CheckK8sClusterStatus"
 }
 
+func (c *checkK8sClusterStatusTask) Interval() time.Duration {
+	return 5 * time.Second
+}
+
 func (c checkK8sClusterStatusTask) Run(ctx context.Context, i *types.Instance) error {
 	status := ClusterStatus{Instance: i.Name}
 
 	kc, err := c.factory.GetKubeletForInstance(i)
 	if err != nil {
 		log.Println(err)
-		c.event.Emit(CheckSwarmStatusEvent, i.SessionId, status)
+		event.EmitPayload(c.event, CheckSwarmStatusEvent, i.SessionId, status)
 		return err
 	}
 
 	if isManager, err := kc.IsManager(); err != nil {
-		c.event.Emit(CheckSwarmStatusEvent, i.SessionId, status)
+		event.EmitPayload(c.event, CheckSwarmStatusEvent, i.SessionId, status)
 		return err
 	} else if !isManager {
 		// Not a manager node, nothing to do for this task
@@ -48,7 +53,14 @@ func (c checkK8sClusterStatusTask) Run(ctx context.Context, i *types.Instance) e
 		status.IsManager = true
 	}
 
-	c.event.Emit(CheckK8sStatusEvent, i.SessionId, status)
+	if ready, err := kc.IsReady(); err != nil {
+		event.EmitPayload(c.event, CheckK8sStatusEvent, i.SessionId, status)
+		return err
+	} else {
+		status.Ready = ready
+	}
+
+	event.EmitPayload(c.event, CheckK8sStatusEvent, i.SessionId, status)
 
 	return nil
 }
@@ -9,10 +9,7 @@ import (
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
-type DockerPorts struct {
-	Instance string `json:"instance"`
-	Ports    []int  `json:"ports"`
-}
+type DockerPorts = event.DockerPortsPayload
 
 type checkPorts struct {
 	event   event.EventApi
@@ -22,7 +19,7 @@ type checkPorts struct {
 var CheckPortsEvent event.EventType
 
 func init() {
-	CheckPortsEvent = event.EventType("instance docker ports")
+	CheckPortsEvent = event.INSTANCE_DOCKER_PORTS
 }
 
 func (t *checkPorts) Name() string {
@@ -46,7 +43,7 @@ func (t *checkPorts) Run(ctx context.Context, instance *types.Instance) error {
 		ports[i] = int(port)
 	}
 
-	t.event.Emit(CheckPortsEvent, instance.SessionId, DockerPorts{Instance: instance.Name, Ports: ports})
+	event.EmitPayload(t.event, CheckPortsEvent, instance.SessionId, DockerPorts{Instance: instance.Name, Ports: ports})
 	return nil
 }
 
@@ -17,7 +17,7 @@ type checkSwarmPorts struct {
 var CheckSwarmPortsEvent event.EventType
 
 func init() {
-	CheckSwarmPortsEvent = event.EventType("instance docker swarm ports")
+	CheckSwarmPortsEvent = event.INSTANCE_DOCKER_SWARM_PORTS
 }
 
 func (t *checkSwarmPorts) Name() string {
@@ -51,7 +51,7 @@ func (t *checkSwarmPorts) Run(ctx context.Context, instance *types.Instance) err
 		ports[i] = int(port)
 	}
 
-	t.event.Emit(CheckSwarmPortsEvent, instance.SessionId, ClusterPorts{Manager: instance.Name, Instances: hosts, Ports: ports})
+	event.EmitPayload(t.event, CheckSwarmPortsEvent, instance.SessionId, ClusterPorts{Manager: instance.Name, Instances: hosts, Ports: ports})
 	return nil
 }
 
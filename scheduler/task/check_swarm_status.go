@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 
-	"github.com/docker/docker/api/types/swarm"
 	"github.com/play-with-docker/play-with-docker/docker"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
@@ -18,7 +17,7 @@ type checkSwarmStatus struct {
 var CheckSwarmStatusEvent event.EventType
 
 func init() {
-	CheckSwarmStatusEvent = event.EventType("instance docker swarm status")
+	CheckSwarmStatusEvent = event.INSTANCE_DOCKER_SWARM_STATUS
 }
 
 func (t *checkSwarmStatus) Name() string {
@@ -39,7 +38,7 @@ func (t *checkSwarmStatus) Run(ctx context.Context, instance *types.Instance) er
 	}
 	status.Instance = instance.Name
 
-	t.event.Emit(CheckSwarmStatusEvent, instance.SessionId, status)
+	event.EmitPayload(t.event, CheckSwarmStatusEvent, instance.SessionId, status)
 	return nil
 }
 
@@ -49,15 +48,12 @@ func NewCheckSwarmStatus(e event.EventApi, f docker.FactoryApi) *checkSwarmStatu
 
 func getDockerSwarmStatus(ctx context.Context, client docker.DockerApi) (ClusterStatus, error) {
 	status := ClusterStatus{}
-	info, err := client.DaemonInfo()
+	isManager, isWorker, err := docker.SwarmRole(client)
 	if err != nil {
 		return status, err
 	}
-
-	if info.Swarm.LocalNodeState != swarm.LocalNodeStateInactive && info.Swarm.LocalNodeState != swarm.LocalNodeStateLocked {
-		status.IsManager = info.Swarm.ControlAvailable
-		status.IsWorker = !info.Swarm.ControlAvailable
-	}
+	status.IsManager = isManager
+	status.IsWorker = isWorker
 
 	return status, nil
 }
@@ -20,11 +20,7 @@ import (
 	"github.com/play-with-docker/play-with-docker/storage"
 )
 
-type InstanceStats struct {
-	Instance string `json:"instance"`
-	Mem      string `json:"mem"`
-	Cpu      string `json:"cpu"`
-}
+type InstanceStats = event.InstanceStatsPayload
 
 type collectStats struct {
 	event   event.EventApi
@@ -37,7 +33,7 @@ type collectStats struct {
 var CollectStatsEvent event.EventType
 
 func init() {
-	CollectStatsEvent = event.EventType("instance stats")
+	CollectStatsEvent = event.INSTANCE_STATS
 }
 
 func (t *collectStats) Name() string {
@@ -72,7 +68,7 @@ func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error
 
 		stats.Mem = fmt.Sprintf("%.2f%% (%s / %s)", ((info["mem_used"] / info["mem_total"]) * 100), units.BytesSize(info["mem_used"]), units.BytesSize(info["mem_total"]))
 		stats.Cpu = fmt.Sprintf("%.2f%%", info["cpu"]*100)
-		t.event.Emit(CollectStatsEvent, instance.SessionId, stats)
+		event.EmitPayload(t.event, CollectStatsEvent, instance.SessionId, stats)
 		return nil
 	}
 	var session *types.Session
@@ -120,7 +116,7 @@ func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error
 	cpuPercent := calculateCPUPercentUnix(previousCPU, previousSystem, v)
 	stats.Cpu = fmt.Sprintf("%.2f%%", cpuPercent)
 
-	t.event.Emit(CollectStatsEvent, instance.SessionId, stats)
+	event.EmitPayload(t.event, CollectStatsEvent, instance.SessionId, stats)
 	return nil
 }
 
@@ -0,0 +1,37 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+type WarmPool interface {
+	FillWarmPool(ctx context.Context, playground *types.Playground) error
+}
+
+// fillWarmPool tops up the warm pool of pre-created instances of playgrounds
+// that have one.
+type fillWarmPool struct {
+	pool WarmPool
+}
+
+func (t *fillWarmPool) Name() string {
+	return "FillWarmPool"
+}
+
+func (t *fillWarmPool) Timeout() time.Duration {
+	return 10 * time.Minute
+}
+
+func (t *fillWarmPool) Run(ctx context.Context, playground *types.Playground) error {
+	if playground.WarmPoolSize <= 0 {
+		return nil
+	}
+	return t.pool.FillWarmPool(ctx, playground)
+}
+
+func NewFillWarmPool(p WarmPool) *fillWarmPool {
+	return &fillWarmPool{pool: p}
+}
@@ -0,0 +1,56 @@
+package task
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// pullImages pulls the instance images of a playground so the first
+// instances using them don't have to wait.
+type pullImages struct {
+	factory docker.FactoryApi
+}
+
+func (t *pullImages) Name() string {
+	return "PullImages"
+}
+
+func (t *pullImages) Timeout() time.Duration {
+	return 30 * time.Minute
+}
+
+func (t *pullImages) Run(ctx context.Context, playground *types.Playground) error {
+	dockerClient, err := t.factory.GetForSession(&types.Session{PlaygroundId: playground.Id})
+	if err != nil {
+		return err
+	}
+
+	images := map[string]bool{}
+	if playground.DefaultDinDInstanceImage != "" {
+		images[playground.DefaultDinDInstanceImage] = true
+	}
+	for _, image := range playground.AvailableDinDInstanceImages {
+		images[image] = true
+	}
+
+	var lastErr error
+	for image := range images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		log.Printf("Pulling image %s for playground %s\n", image, playground.Id)
+		if err := dockerClient.ImagePull(image); err != nil {
+			log.Printf("Error pulling image %s. Got: %v\n", image, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func NewPullImages(f docker.FactoryApi) *pullImages {
+	return &pullImages{factory: f}
+}
@@ -0,0 +1,35 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPullImages_Run(t *testing.T) {
+	d := &docker.Mock{}
+	f := &docker.FactoryMock{}
+
+	p := &types.Playground{
+		Id:                          "foobar",
+		DefaultDinDInstanceImage:    "franela/dind",
+		AvailableDinDInstanceImages: []string{"franela/dind", "franela/dind:overlay2-dev"},
+	}
+
+	f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(d, nil)
+	d.On("ImagePull", "franela/dind").Return(nil).Once()
+	d.On("ImagePull", "franela/dind:overlay2-dev").Return(nil).Once()
+
+	task := NewPullImages(f)
+	assert.Equal(t, "PullImages", task.Name())
+
+	err := task.Run(context.Background(), p)
+
+	assert.Nil(t, err)
+	d.AssertExpectations(t)
+	f.AssertExpectations(t)
+}
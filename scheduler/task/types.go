@@ -1,13 +1,7 @@
 package task
 
-type ClusterStatus struct {
-	IsManager bool   `json:"is_manager"`
-	IsWorker  bool   `json:"is_worker"`
-	Instance  string `json:"instance"`
-}
+import "github.com/play-with-docker/play-with-docker/event"
 
-type ClusterPorts struct {
-	Manager   string   `json:"manager"`
-	Instances []string `json:"instances"`
-	Ports     []int    `json:"ports"`
-}
+type ClusterStatus = event.ClusterStatusPayload
+
+type ClusterPorts = event.ClusterPortsPayload
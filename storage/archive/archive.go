@@ -0,0 +1,347 @@
+// Package archive moves PWD state between storage.StorageApi implementations.
+//
+// An archive is a single JSON document:
+//
+//	{
+//	  "version": 4,
+//	  "created_at": "2017-11-20T10:00:00Z",
+//	  "playgrounds": [...],
+//	  "templates": [...],
+//	  "users": [...],
+//	  "login_requests": [...],
+//	  "sessions": [...],
+//	  "setup_statuses": [...],
+//	  "instances": [...],
+//	  "windows_instances": [...],
+//	  "clients": [...],
+//	  "snapshots": [...]
+//	}
+//
+// Every list holds the objects exactly as they are encoded by the types in
+// pwd/types. Instances, windows instances, clients and setup statuses
+// reference their session through their session id, so sessions are always
+// imported before them. Readers must reject archives with a version they
+// don't know about.
+//
+// Templates hold every version of the templates of each playground, and are
+// imported after playgrounds.
+//
+// Version 2 added snapshots, version 3 templates and version 4 setup
+// statuses. Older archives are still read, the lists they don't have are
+// empty.
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// Version is the version of the archive format written by Export.
+const Version = 4
+
+type Archive struct {
+	Version          int                         `json:"version"`
+	CreatedAt        time.Time                   `json:"created_at"`
+	Playgrounds      []*types.Playground         `json:"playgrounds"`
+	Templates        []*types.SessionTemplate    `json:"templates"`
+	Users            []*types.User               `json:"users"`
+	LoginRequests    []*types.LoginRequest       `json:"login_requests"`
+	Sessions         []*types.Session            `json:"sessions"`
+	SetupStatuses    []*types.SessionSetupStatus `json:"setup_statuses"`
+	Instances        []*types.Instance           `json:"instances"`
+	WindowsInstances []*types.WindowsInstance    `json:"windows_instances"`
+	Clients          []*types.Client             `json:"clients"`
+	Snapshots        []*types.Snapshot           `json:"snapshots"`
+}
+
+// ConflictPolicy decides what Import does with objects that already exist in
+// the target storage.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing object.
+	ConflictSkip = ConflictPolicy("skip")
+	// ConflictOverwrite replaces the existing object with the archived one.
+	ConflictOverwrite = ConflictPolicy("overwrite")
+	// ConflictFail aborts the import on the first conflict.
+	ConflictFail = ConflictPolicy("fail")
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("Unknown conflict policy %s", s)
+}
+
+type ConflictError struct {
+	Kind string
+	Id   string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %s already exists", e.Kind, e.Id)
+}
+
+type ImportOpts struct {
+	// DryRun reports what would be imported without writing anything.
+	DryRun     bool
+	OnConflict ConflictPolicy
+}
+
+// Counts holds how many objects of a kind were created, overwritten or
+// skipped by an import.
+type Counts struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+}
+
+type Report map[string]*Counts
+
+func (r Report) count(kind string) *Counts {
+	if r[kind] == nil {
+		r[kind] = &Counts{}
+	}
+	return r[kind]
+}
+
+// Export reads every object from s.
+func Export(s storage.StorageApi) (*Archive, error) {
+	a := &Archive{Version: Version, CreatedAt: time.Now()}
+	var err error
+
+	if a.Playgrounds, err = s.PlaygroundGetAll(); err != nil {
+		return nil, err
+	}
+	a.Templates = []*types.SessionTemplate{}
+	for _, p := range a.Playgrounds {
+		templates, err := s.TemplateFindByPlaygroundId(p.Id)
+		if err != nil {
+			return nil, err
+		}
+		a.Templates = append(a.Templates, templates...)
+	}
+	if a.Users, err = s.UserGetAll(); err != nil {
+		return nil, err
+	}
+	if a.LoginRequests, err = s.LoginRequestGetAll(); err != nil {
+		return nil, err
+	}
+	if a.Sessions, err = s.SessionGetAll(); err != nil {
+		return nil, err
+	}
+	if a.WindowsInstances, err = s.WindowsInstanceGetAll(); err != nil {
+		return nil, err
+	}
+	a.Instances = []*types.Instance{}
+	a.Clients = []*types.Client{}
+	a.SetupStatuses = []*types.SessionSetupStatus{}
+	for _, session := range a.Sessions {
+		instances, err := s.InstanceFindBySessionId(session.Id)
+		if err != nil {
+			return nil, err
+		}
+		a.Instances = append(a.Instances, instances...)
+
+		clients, err := s.ClientFindBySessionId(session.Id)
+		if err != nil {
+			return nil, err
+		}
+		a.Clients = append(a.Clients, clients...)
+
+		status, err := s.SessionSetupStatusGet(session.Id)
+		if err == nil {
+			a.SetupStatuses = append(a.SetupStatuses, status)
+		} else if !storage.NotFound(err) {
+			return nil, err
+		}
+	}
+	if a.Snapshots, err = s.SnapshotGetAll(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func Write(w io.Writer, a *Archive) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(a)
+}
+
+func Read(r io.Reader) (*Archive, error) {
+	var a Archive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, err
+	}
+	if a.Version < 1 || a.Version > Version {
+		return nil, fmt.Errorf("Unsupported archive version %d", a.Version)
+	}
+	return &a, nil
+}
+
+// Import writes every object in a into s. Objects are written in dependency
+// order so sessions exist before anything that belongs to them.
+func Import(s storage.StorageApi, a *Archive, opts ImportOpts) (Report, error) {
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictFail
+	}
+	report := Report{}
+
+	put := func(kind, id string, exists bool, put func() error) error {
+		c := report.count(kind)
+		if exists {
+			switch opts.OnConflict {
+			case ConflictSkip:
+				c.Skipped++
+				return nil
+			case ConflictFail:
+				return &ConflictError{Kind: kind, Id: id}
+			}
+		}
+		if !opts.DryRun {
+			if err := put(); err != nil {
+				return fmt.Errorf("Could not import %s %s. Got: %v", kind, id, err)
+			}
+		}
+		if exists {
+			c.Overwritten++
+		} else {
+			c.Created++
+		}
+		return nil
+	}
+	exists := func(err error) (bool, error) {
+		if err == nil {
+			return true, nil
+		}
+		if storage.NotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, p := range a.Playgrounds {
+		_, err := s.PlaygroundGet(p.Id)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		p := p
+		if err := put("playground", p.Id, found, func() error { return s.PlaygroundPut(p) }); err != nil {
+			return report, err
+		}
+	}
+	for _, t := range a.Templates {
+		_, err := s.TemplateGet(t.PlaygroundId, t.Name, t.Version)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		t := t
+		id := fmt.Sprintf("%s/%s@%d", t.PlaygroundId, t.Name, t.Version)
+		if err := put("template", id, found, func() error { return s.TemplatePut(t) }); err != nil {
+			return report, err
+		}
+	}
+	for _, u := range a.Users {
+		_, err := s.UserGet(u.Id)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		u := u
+		if err := put("user", u.Id, found, func() error { return s.UserPut(u) }); err != nil {
+			return report, err
+		}
+	}
+	for _, lr := range a.LoginRequests {
+		_, err := s.LoginRequestGet(lr.Id)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		lr := lr
+		if err := put("login_request", lr.Id, found, func() error { return s.LoginRequestPut(lr) }); err != nil {
+			return report, err
+		}
+	}
+	for _, session := range a.Sessions {
+		_, err := s.SessionGet(session.Id)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		session := session
+		if err := put("session", session.Id, found, func() error { return s.SessionPut(session) }); err != nil {
+			return report, err
+		}
+	}
+	for _, status := range a.SetupStatuses {
+		_, err := s.SessionSetupStatusGet(status.SessionId)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		status := status
+		if err := put("setup_status", status.SessionId, found, func() error { return s.SessionSetupStatusPut(status) }); err != nil {
+			return report, err
+		}
+	}
+	for _, i := range a.Instances {
+		_, err := s.InstanceGet(i.Name)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		i := i
+		if err := put("instance", i.Name, found, func() error { return s.InstancePut(i) }); err != nil {
+			return report, err
+		}
+	}
+	windows, err := s.WindowsInstanceGetAll()
+	if err != nil {
+		return report, err
+	}
+	existingWindows := map[string]bool{}
+	for _, w := range windows {
+		existingWindows[w.Id] = true
+	}
+	for _, w := range a.WindowsInstances {
+		w := w
+		if err := put("windows_instance", w.Id, existingWindows[w.Id], func() error { return s.WindowsInstancePut(w) }); err != nil {
+			return report, err
+		}
+	}
+	for _, c := range a.Clients {
+		_, err := s.ClientGet(c.Id)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		c := c
+		if err := put("client", c.Id, found, func() error { return s.ClientPut(c) }); err != nil {
+			return report, err
+		}
+	}
+	for _, snapshot := range a.Snapshots {
+		_, err := s.SnapshotGet(snapshot.Id)
+		found, err := exists(err)
+		if err != nil {
+			return report, err
+		}
+		snapshot := snapshot
+		if err := put("snapshot", snapshot.Id, found, func() error { return s.SnapshotPut(snapshot) }); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newStorage(t *testing.T) storage.StorageApi {
+	s, err := storage.NewSQLStorage("sqlite", ":memory:")
+	assert.Nil(t, err)
+	return s
+}
+
+func populate(t *testing.T, s storage.StorageApi) {
+	assert.Nil(t, s.PlaygroundPut(&types.Playground{Id: "p1", Domain: "localhost"}))
+	assert.Nil(t, s.TemplatePut(&types.SessionTemplate{Name: "t1", PlaygroundId: "p1", Version: 1, Instances: []types.TemplateInstance{{Hostname: "node1"}}}))
+	assert.Nil(t, s.UserPut(&types.User{Id: "u1", Provider: "github", ProviderUserId: "1"}))
+	assert.Nil(t, s.LoginRequestPut(&types.LoginRequest{Id: "lr1", Provider: "github"}))
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1", PlaygroundId: "p1", SourceIP: "10.1.1.1", DockerHost: "tcp://10.0.0.2:2375"}))
+	assert.Nil(t, s.SessionSetupStatusPut(&types.SessionSetupStatus{SessionId: "s1", State: types.SetupDone}))
+	assert.Nil(t, s.InstancePut(&types.Instance{Name: "i1", SessionId: "s1", Hostname: "node1"}))
+	assert.Nil(t, s.WindowsInstancePut(&types.WindowsInstance{Id: "w1", SessionId: "s1"}))
+	assert.Nil(t, s.ClientPut(&types.Client{Id: "c1", SessionId: "s1"}))
+	assert.Nil(t, s.SnapshotPut(&types.Snapshot{Id: "sn1", Name: "snap1", SessionId: "s1", PlaygroundId: "p1"}))
+}
+
+func TestExportImport(t *testing.T) {
+	src := newStorage(t)
+	populate(t, src)
+
+	a, err := Export(src)
+	assert.Nil(t, err)
+
+	var b bytes.Buffer
+	assert.Nil(t, Write(&b, a))
+	a, err = Read(&b)
+	assert.Nil(t, err)
+
+	dst := newStorage(t)
+	report, err := Import(dst, a, ImportOpts{})
+	assert.Nil(t, err)
+	for _, kind := range []string{"playground", "template", "user", "login_request", "session", "setup_status", "instance", "windows_instance", "client", "snapshot"} {
+		assert.Equal(t, &Counts{Created: 1}, report[kind], kind)
+	}
+
+	session, err := dst.SessionGet("s1")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.1.1", session.SourceIP)
+	assert.Equal(t, "tcp://10.0.0.2:2375", session.DockerHost)
+
+	exported, err := Export(dst)
+	assert.Nil(t, err)
+	exported.CreatedAt = a.CreatedAt
+	assert.Equal(t, a, exported)
+}
+
+func TestImport_DryRun(t *testing.T) {
+	src := newStorage(t)
+	populate(t, src)
+	a, err := Export(src)
+	assert.Nil(t, err)
+
+	dst := newStorage(t)
+	report, err := Import(dst, a, ImportOpts{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report["instance"].Created)
+
+	count, err := dst.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestImport_Conflicts(t *testing.T) {
+	src := newStorage(t)
+	populate(t, src)
+	a, err := Export(src)
+	assert.Nil(t, err)
+
+	dst := newStorage(t)
+	assert.Nil(t, dst.SessionPut(&types.Session{Id: "s1", StackName: "existing"}))
+
+	_, err = Import(dst, a, ImportOpts{OnConflict: ConflictFail})
+	assert.IsType(t, &ConflictError{}, err)
+
+	report, err := Import(dst, a, ImportOpts{OnConflict: ConflictSkip})
+	assert.Nil(t, err)
+	assert.Equal(t, &Counts{Skipped: 1}, report["session"])
+	s, err := dst.SessionGet("s1")
+	assert.Nil(t, err)
+	assert.Equal(t, "existing", s.StackName)
+
+	report, err = Import(dst, a, ImportOpts{OnConflict: ConflictOverwrite})
+	assert.Nil(t, err)
+	assert.Equal(t, &Counts{Overwritten: 1}, report["session"])
+	s, err = dst.SessionGet("s1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", s.StackName)
+}
+
+func TestRead_OldVersion(t *testing.T) {
+	a, err := Read(bytes.NewBufferString(`{"version": 1, "sessions": [{"id": "s1"}]}`))
+	assert.Nil(t, err)
+
+	dst := newStorage(t)
+	report, err := Import(dst, a, ImportOpts{})
+	assert.Nil(t, err)
+	assert.Equal(t, Report{"session": {Created: 1}}, report)
+}
+
+func TestRead_UnknownVersion(t *testing.T) {
+	_, err := Read(bytes.NewBufferString(`{"version": 99}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,33 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/play-with-docker/play-with-docker/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestFileStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageApi {
+		dir, err := ioutil.TempDir("", "pwd")
+		assert.Nil(t, err)
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		s, err := storage.NewFileStorage(filepath.Join(dir, "sessions"))
+		assert.Nil(t, err)
+		return s
+	})
+}
+
+func TestSQLStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageApi {
+		s, err := storage.NewSQLStorage("sqlite", ":memory:")
+		assert.Nil(t, err)
+		return s
+	})
+}
@@ -3,26 +3,45 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
+// defaultCompactAfter is the number of log entries after which the log is
+// folded into a new snapshot of the whole DB.
+const defaultCompactAfter = 1000
+
 type storage struct {
 	rw   sync.Mutex
 	path string
 	db   *DB
+
+	wal          *os.File
+	walEntries   int
+	compactAfter int
+	readOnly     bool
 }
 
 type DB struct {
-	Sessions         map[string]*types.Session         `json:"sessions"`
-	Instances        map[string]*types.Instance        `json:"instances"`
-	Clients          map[string]*types.Client          `json:"clients"`
-	WindowsInstances map[string]*types.WindowsInstance `json:"windows_instances"`
-	LoginRequests    map[string]*types.LoginRequest    `json:"login_requests"`
-	Users            map[string]*types.User            `json:"user"`
-	Playgrounds      map[string]*types.Playground      `json:"playgrounds"`
+	Sessions         map[string]*types.Session            `json:"sessions"`
+	Instances        map[string]*types.Instance           `json:"instances"`
+	Clients          map[string]*types.Client             `json:"clients"`
+	WindowsInstances map[string]*types.WindowsInstance    `json:"windows_instances"`
+	LoginRequests    map[string]*types.LoginRequest       `json:"login_requests"`
+	Users            map[string]*types.User               `json:"user"`
+	Playgrounds      map[string]*types.Playground         `json:"playgrounds"`
+	Leases           map[string]*types.Lease              `json:"leases"`
+	Snapshots        map[string]*types.Snapshot           `json:"snapshots"`
+	SetupStatuses    map[string]*types.SessionSetupStatus `json:"setup_statuses"`
+	// Templates holds every version of a template, oldest first, by
+	// templateKey.
+	Templates map[string][]*types.SessionTemplate `json:"templates"`
 
 	WindowsInstancesBySessionId map[string][]string `json:"windows_instances_by_session_id"`
 	InstancesBySessionId        map[string][]string `json:"instances_by_session_id"`
@@ -30,6 +49,317 @@ type DB struct {
 	UsersByProvider             map[string]string   `json:"users_by_providers"`
 }
 
+func newDB() *DB {
+	return &DB{
+		Sessions:                    map[string]*types.Session{},
+		Instances:                   map[string]*types.Instance{},
+		Clients:                     map[string]*types.Client{},
+		WindowsInstances:            map[string]*types.WindowsInstance{},
+		LoginRequests:               map[string]*types.LoginRequest{},
+		Users:                       map[string]*types.User{},
+		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
+		WindowsInstancesBySessionId: map[string][]string{},
+		InstancesBySessionId:        map[string][]string{},
+		ClientsBySessionId:          map[string][]string{},
+		UsersByProvider:             map[string]string{},
+	}
+}
+
+const (
+	opSessionPut            = "session_put"
+	opSessionDelete         = "session_delete"
+	opSessionActivityPut    = "session_activity_put"
+	opInstancePut           = "instance_put"
+	opInstanceDelete        = "instance_delete"
+	opWindowsInstancePut    = "windows_instance_put"
+	opWindowsInstanceDelete = "windows_instance_delete"
+	opClientPut             = "client_put"
+	opClientDelete          = "client_delete"
+	opUserPut               = "user_put"
+	opLoginRequestPut       = "login_request_put"
+	opLoginRequestDelete    = "login_request_delete"
+	opPlaygroundPut         = "playground_put"
+	opLeasePut              = "lease_put"
+	opLeaseDelete           = "lease_delete"
+	opSnapshotPut           = "snapshot_put"
+	opSnapshotDelete        = "snapshot_delete"
+	opSetupStatusPut        = "setup_status_put"
+	opTemplatePut           = "template_put"
+	opTemplateDelete        = "template_delete"
+)
+
+type sessionActivity struct {
+	Id string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+// walEntry is a single mutation appended to the write-ahead log. Data holds
+// the stored object for puts and the key for deletes.
+type walEntry struct {
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (db *DB) apply(e *walEntry) error {
+	switch e.Op {
+	case opSessionPut:
+		var s types.Session
+		if err := json.Unmarshal(e.Data, &s); err != nil {
+			return err
+		}
+		db.sessionPut(&s)
+	case opSessionActivityPut:
+		var a sessionActivity
+		if err := json.Unmarshal(e.Data, &a); err != nil {
+			return err
+		}
+		db.sessionActivityPut(a.Id, a.At)
+	case opInstancePut:
+		var i types.Instance
+		if err := json.Unmarshal(e.Data, &i); err != nil {
+			return err
+		}
+		db.instancePut(&i)
+	case opWindowsInstancePut:
+		var i types.WindowsInstance
+		if err := json.Unmarshal(e.Data, &i); err != nil {
+			return err
+		}
+		db.windowsInstancePut(&i)
+	case opClientPut:
+		var c types.Client
+		if err := json.Unmarshal(e.Data, &c); err != nil {
+			return err
+		}
+		db.clientPut(&c)
+	case opUserPut:
+		var u types.User
+		if err := json.Unmarshal(e.Data, &u); err != nil {
+			return err
+		}
+		db.userPut(&u)
+	case opLoginRequestPut:
+		var lr types.LoginRequest
+		if err := json.Unmarshal(e.Data, &lr); err != nil {
+			return err
+		}
+		db.LoginRequests[lr.Id] = &lr
+	case opPlaygroundPut:
+		var p types.Playground
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		db.playgroundPut(&p)
+	case opLeasePut:
+		var l types.Lease
+		if err := json.Unmarshal(e.Data, &l); err != nil {
+			return err
+		}
+		db.Leases[l.Name] = &l
+	case opSnapshotPut:
+		var snapshot types.Snapshot
+		if err := json.Unmarshal(e.Data, &snapshot); err != nil {
+			return err
+		}
+		if snapshot.Id == "" {
+			// Written before snapshots had ids
+			snapshot.Id = snapshot.Name
+		}
+		db.Snapshots[snapshot.Id] = &snapshot
+	case opSetupStatusPut:
+		var status types.SessionSetupStatus
+		if err := json.Unmarshal(e.Data, &status); err != nil {
+			return err
+		}
+		db.SetupStatuses[status.SessionId] = &status
+	case opTemplatePut:
+		var template types.SessionTemplate
+		if err := json.Unmarshal(e.Data, &template); err != nil {
+			return err
+		}
+		db.templatePut(&template)
+	case opSessionDelete, opInstanceDelete, opWindowsInstanceDelete, opClientDelete, opLeaseDelete, opTemplateDelete, opSnapshotDelete, opLoginRequestDelete:
+		var id string
+		if err := json.Unmarshal(e.Data, &id); err != nil {
+			return err
+		}
+		switch e.Op {
+		case opSessionDelete:
+			db.sessionDelete(id)
+		case opInstanceDelete:
+			db.instanceDelete(id)
+		case opWindowsInstanceDelete:
+			db.windowsInstanceDelete(id)
+		case opClientDelete:
+			db.clientDelete(id)
+		case opLeaseDelete:
+			delete(db.Leases, id)
+		case opTemplateDelete:
+			delete(db.Templates, id)
+		case opSnapshotDelete:
+			delete(db.Snapshots, id)
+		case opLoginRequestDelete:
+			delete(db.LoginRequests, id)
+		}
+	default:
+		return fmt.Errorf("Unknown log operation %s", e.Op)
+	}
+	return nil
+}
+
+func (db *DB) sessionPut(session *types.Session) {
+	if existing, found := db.Sessions[session.Id]; found && existing.LastActivityAt.After(session.LastActivityAt) {
+		s := *session
+		s.LastActivityAt = existing.LastActivityAt
+		session = &s
+	}
+	db.Sessions[session.Id] = session
+}
+
+func (db *DB) sessionActivityPut(id string, at time.Time) bool {
+	existing, found := db.Sessions[id]
+	if !found {
+		return false
+	}
+	if at.After(existing.LastActivityAt) {
+		// Stored sessions are shared with readers, so they are replaced
+		// instead of changed
+		s := *existing
+		s.LastActivityAt = at
+		db.Sessions[id] = &s
+	}
+	return true
+}
+
+func (db *DB) sessionDelete(id string) {
+	for _, i := range db.WindowsInstancesBySessionId[id] {
+		delete(db.WindowsInstances, i)
+	}
+	db.WindowsInstancesBySessionId[id] = []string{}
+	for _, i := range db.InstancesBySessionId[id] {
+		delete(db.Instances, i)
+	}
+	db.InstancesBySessionId[id] = []string{}
+	for _, i := range db.ClientsBySessionId[id] {
+		delete(db.Clients, i)
+	}
+	db.ClientsBySessionId[id] = []string{}
+	delete(db.SetupStatuses, id)
+	delete(db.Sessions, id)
+}
+
+func (db *DB) instancePut(instance *types.Instance) {
+	db.Instances[instance.Name] = instance
+	for _, i := range db.InstancesBySessionId[instance.SessionId] {
+		if i == instance.Name {
+			return
+		}
+	}
+	db.InstancesBySessionId[instance.SessionId] = append(db.InstancesBySessionId[instance.SessionId], instance.Name)
+}
+
+func (db *DB) instanceDelete(name string) {
+	instance, found := db.Instances[name]
+	if !found {
+		return
+	}
+
+	instances := db.InstancesBySessionId[instance.SessionId]
+	for n, i := range instances {
+		if i == name {
+			instances = append(instances[:n], instances[n+1:]...)
+			break
+		}
+	}
+	db.InstancesBySessionId[instance.SessionId] = instances
+	delete(db.Instances, name)
+}
+
+func templateKey(playgroundId, name string) string {
+	return playgroundId + "/" + name
+}
+
+func (db *DB) templatePut(template *types.SessionTemplate) {
+	key := templateKey(template.PlaygroundId, template.Name)
+	versions := db.Templates[key]
+	for n, t := range versions {
+		if t.Version == template.Version {
+			versions[n] = template
+			return
+		}
+	}
+	versions = append(versions, template)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	db.Templates[key] = versions
+}
+
+func (db *DB) windowsInstancePut(instance *types.WindowsInstance) {
+	db.WindowsInstances[instance.Id] = instance
+	for _, i := range db.WindowsInstancesBySessionId[instance.SessionId] {
+		if i == instance.Id {
+			return
+		}
+	}
+	db.WindowsInstancesBySessionId[instance.SessionId] = append(db.WindowsInstancesBySessionId[instance.SessionId], instance.Id)
+}
+
+func (db *DB) windowsInstanceDelete(id string) {
+	instance, found := db.WindowsInstances[id]
+	if !found {
+		return
+	}
+
+	instances := db.WindowsInstancesBySessionId[instance.SessionId]
+	for n, i := range instances {
+		if i == id {
+			instances = append(instances[:n], instances[n+1:]...)
+			break
+		}
+	}
+	db.WindowsInstancesBySessionId[instance.SessionId] = instances
+	delete(db.WindowsInstances, id)
+}
+
+func (db *DB) clientPut(client *types.Client) {
+	db.Clients[client.Id] = client
+	for _, i := range db.ClientsBySessionId[client.SessionId] {
+		if i == client.Id {
+			return
+		}
+	}
+	db.ClientsBySessionId[client.SessionId] = append(db.ClientsBySessionId[client.SessionId], client.Id)
+}
+
+func (db *DB) clientDelete(id string) {
+	client, found := db.Clients[id]
+	if !found {
+		return
+	}
+
+	clients := db.ClientsBySessionId[client.SessionId]
+	for n, i := range clients {
+		if i == client.Id {
+			clients = append(clients[:n], clients[n+1:]...)
+			break
+		}
+	}
+	db.ClientsBySessionId[client.SessionId] = clients
+	delete(db.Clients, id)
+}
+
+func (db *DB) userPut(user *types.User) {
+	db.UsersByProvider[fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId)] = user.Id
+	db.Users[user.Id] = user
+}
+
+func (db *DB) playgroundPut(playground *types.Playground) {
+	db.Playgrounds[playground.Id] = playground
+}
+
 func (store *storage) SessionGet(id string) (*types.Session, error) {
 	store.rw.Lock()
 	defer store.rw.Unlock()
@@ -60,9 +390,20 @@ func (store *storage) SessionPut(session *types.Session) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	store.db.Sessions[session.Id] = session
+	store.db.sessionPut(session)
+
+	return store.append(opSessionPut, session)
+}
+
+func (store *storage) SessionActivityPut(sessionId string, at time.Time) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if !store.db.sessionActivityPut(sessionId, at) {
+		return NotFoundError
+	}
 
-	return store.save()
+	return store.append(opSessionActivityPut, sessionActivity{Id: sessionId, At: at})
 }
 
 func (store *storage) SessionDelete(id string) error {
@@ -73,21 +414,9 @@ func (store *storage) SessionDelete(id string) error {
 	if !found {
 		return nil
 	}
-	for _, i := range store.db.WindowsInstancesBySessionId[id] {
-		delete(store.db.WindowsInstances, i)
-	}
-	store.db.WindowsInstancesBySessionId[id] = []string{}
-	for _, i := range store.db.InstancesBySessionId[id] {
-		delete(store.db.Instances, i)
-	}
-	store.db.InstancesBySessionId[id] = []string{}
-	for _, i := range store.db.ClientsBySessionId[id] {
-		delete(store.db.Clients, i)
-	}
-	store.db.ClientsBySessionId[id] = []string{}
-	delete(store.db.Sessions, id)
+	store.db.sessionDelete(id)
 
-	return store.save()
+	return store.append(opSessionDelete, id)
 }
 
 func (store *storage) SessionCount() (int, error) {
@@ -116,42 +445,22 @@ func (store *storage) InstancePut(instance *types.Instance) error {
 	if !found {
 		return NotFoundError
 	}
+	store.db.instancePut(instance)
 
-	store.db.Instances[instance.Name] = instance
-	found = false
-	for _, i := range store.db.InstancesBySessionId[string(instance.SessionId)] {
-		if i == instance.Name {
-			found = true
-			break
-		}
-	}
-	if !found {
-		store.db.InstancesBySessionId[string(instance.SessionId)] = append(store.db.InstancesBySessionId[string(instance.SessionId)], instance.Name)
-	}
-
-	return store.save()
+	return store.append(opInstancePut, instance)
 }
 
 func (store *storage) InstanceDelete(name string) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	instance, found := store.db.Instances[name]
+	_, found := store.db.Instances[name]
 	if !found {
 		return nil
 	}
+	store.db.instanceDelete(name)
 
-	instances := store.db.InstancesBySessionId[string(instance.SessionId)]
-	for n, i := range instances {
-		if i == name {
-			instances = append(instances[:n], instances[n+1:]...)
-			break
-		}
-	}
-	store.db.InstancesBySessionId[string(instance.SessionId)] = instances
-	delete(store.db.Instances, name)
-
-	return store.save()
+	return store.append(opInstanceDelete, name)
 }
 
 func (store *storage) InstanceCount() (int, error) {
@@ -195,41 +504,22 @@ func (store *storage) WindowsInstancePut(instance *types.WindowsInstance) error
 	if !found {
 		return NotFoundError
 	}
-	store.db.WindowsInstances[instance.Id] = instance
-	found = false
-	for _, i := range store.db.WindowsInstancesBySessionId[string(instance.SessionId)] {
-		if i == instance.Id {
-			found = true
-			break
-		}
-	}
-	if !found {
-		store.db.WindowsInstancesBySessionId[string(instance.SessionId)] = append(store.db.WindowsInstancesBySessionId[string(instance.SessionId)], instance.Id)
-	}
+	store.db.windowsInstancePut(instance)
 
-	return store.save()
+	return store.append(opWindowsInstancePut, instance)
 }
 
 func (store *storage) WindowsInstanceDelete(id string) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	instance, found := store.db.WindowsInstances[id]
+	_, found := store.db.WindowsInstances[id]
 	if !found {
 		return nil
 	}
+	store.db.windowsInstanceDelete(id)
 
-	instances := store.db.WindowsInstancesBySessionId[string(instance.SessionId)]
-	for n, i := range instances {
-		if i == id {
-			instances = append(instances[:n], instances[n+1:]...)
-			break
-		}
-	}
-	store.db.WindowsInstancesBySessionId[string(instance.SessionId)] = instances
-	delete(store.db.WindowsInstances, id)
-
-	return store.save()
+	return store.append(opWindowsInstanceDelete, id)
 }
 
 func (store *storage) ClientGet(id string) (*types.Client, error) {
@@ -250,41 +540,21 @@ func (store *storage) ClientPut(client *types.Client) error {
 	if !found {
 		return NotFoundError
 	}
+	store.db.clientPut(client)
 
-	store.db.Clients[client.Id] = client
-	found = false
-	for _, i := range store.db.ClientsBySessionId[string(client.SessionId)] {
-		if i == client.Id {
-			found = true
-			break
-		}
-	}
-	if !found {
-		store.db.ClientsBySessionId[string(client.SessionId)] = append(store.db.ClientsBySessionId[string(client.SessionId)], client.Id)
-	}
-
-	return store.save()
+	return store.append(opClientPut, client)
 }
 func (store *storage) ClientDelete(id string) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	client, found := store.db.Clients[id]
+	_, found := store.db.Clients[id]
 	if !found {
 		return nil
 	}
+	store.db.clientDelete(id)
 
-	clients := store.db.ClientsBySessionId[string(client.SessionId)]
-	for n, i := range clients {
-		if i == client.Id {
-			clients = append(clients[:n], clients[n+1:]...)
-			break
-		}
-	}
-	store.db.ClientsBySessionId[string(client.SessionId)] = clients
-	delete(store.db.Clients, id)
-
-	return store.save()
+	return store.append(opClientDelete, id)
 }
 func (store *storage) ClientCount() (int, error) {
 	store.rw.Lock()
@@ -304,13 +574,27 @@ func (store *storage) ClientFindBySessionId(sessionId string) ([]*types.Client,
 
 	return clients, nil
 }
+func (store *storage) ClientFindExpired(now time.Time) ([]*types.Client, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	clients := []*types.Client{}
+	for _, c := range store.db.Clients {
+		if expired(c.ExpiresAt, now) {
+			clients = append(clients, c)
+		}
+	}
+
+	return clients, nil
+}
 
 func (store *storage) LoginRequestPut(loginRequest *types.LoginRequest) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
 	store.db.LoginRequests[loginRequest.Id] = loginRequest
-	return nil
+
+	return store.append(opLoginRequestPut, loginRequest)
 }
 func (store *storage) LoginRequestGet(id string) (*types.LoginRequest, error) {
 	store.rw.Lock()
@@ -326,8 +610,37 @@ func (store *storage) LoginRequestDelete(id string) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
+	if _, found := store.db.LoginRequests[id]; !found {
+		return nil
+	}
 	delete(store.db.LoginRequests, id)
-	return nil
+
+	return store.append(opLoginRequestDelete, id)
+}
+func (store *storage) LoginRequestGetAll() ([]*types.LoginRequest, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	loginRequests := make([]*types.LoginRequest, 0, len(store.db.LoginRequests))
+	for _, lr := range store.db.LoginRequests {
+		loginRequests = append(loginRequests, lr)
+	}
+
+	return loginRequests, nil
+}
+
+func (store *storage) LoginRequestFindExpired(now time.Time) ([]*types.LoginRequest, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	loginRequests := []*types.LoginRequest{}
+	for _, lr := range store.db.LoginRequests {
+		if expired(lr.ExpiresAt, now) {
+			loginRequests = append(loginRequests, lr)
+		}
+	}
+
+	return loginRequests, nil
 }
 
 func (store *storage) UserFindByProvider(providerName, providerUserId string) (*types.User, error) {
@@ -349,10 +662,9 @@ func (store *storage) UserPut(user *types.User) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	store.db.UsersByProvider[fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId)] = user.Id
-	store.db.Users[user.Id] = user
+	store.db.userPut(user)
 
-	return store.save()
+	return store.append(opUserPut, user)
 }
 func (store *storage) UserGet(id string) (*types.User, error) {
 	store.rw.Lock()
@@ -364,14 +676,25 @@ func (store *storage) UserGet(id string) (*types.User, error) {
 		return user, nil
 	}
 }
+func (store *storage) UserGetAll() ([]*types.User, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	users := make([]*types.User, 0, len(store.db.Users))
+	for _, u := range store.db.Users {
+		users = append(users, u)
+	}
+
+	return users, nil
+}
 
 func (store *storage) PlaygroundPut(playground *types.Playground) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	store.db.Playgrounds[playground.Id] = playground
+	store.db.playgroundPut(playground)
 
-	return store.save()
+	return store.append(opPlaygroundPut, playground)
 }
 func (store *storage) PlaygroundGet(id string) (*types.Playground, error) {
 	store.rw.Lock()
@@ -385,62 +708,369 @@ func (store *storage) PlaygroundGet(id string) (*types.Playground, error) {
 	return playground, nil
 }
 
+func (store *storage) PlaygroundGetAll() ([]*types.Playground, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	playgrounds := make([]*types.Playground, len(store.db.Playgrounds))
+	i := 0
+	for _, p := range store.db.Playgrounds {
+		playgrounds[i] = p
+		i++
+	}
+
+	return playgrounds, nil
+}
+
+func (store *storage) SnapshotPut(snapshot *types.Snapshot) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.Snapshots[snapshot.Id] = snapshot
+
+	return store.append(opSnapshotPut, snapshot)
+}
+
+func (store *storage) SnapshotGet(id string) (*types.Snapshot, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	snapshot, found := store.db.Snapshots[id]
+	if !found {
+		return nil, NotFoundError
+	}
+
+	return snapshot, nil
+}
+
+func (store *storage) SnapshotGetAll() ([]*types.Snapshot, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	snapshots := make([]*types.Snapshot, 0, len(store.db.Snapshots))
+	for _, s := range store.db.Snapshots {
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, nil
+}
+
+func (store *storage) SnapshotDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if _, found := store.db.Snapshots[id]; !found {
+		return nil
+	}
+	delete(store.db.Snapshots, id)
+
+	return store.append(opSnapshotDelete, id)
+}
+
+func (store *storage) SessionSetupStatusPut(status *types.SessionSetupStatus) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	// The setup of a session that was closed while it ran isn't kept
+	if _, found := store.db.Sessions[status.SessionId]; !found {
+		return NotFoundError
+	}
+	store.db.SetupStatuses[status.SessionId] = status
+
+	return store.append(opSetupStatusPut, status)
+}
+
+func (store *storage) SessionSetupStatusGet(sessionId string) (*types.SessionSetupStatus, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	status, found := store.db.SetupStatuses[sessionId]
+	if !found {
+		return nil, NotFoundError
+	}
+
+	return status, nil
+}
+
+func (store *storage) TemplatePut(template *types.SessionTemplate) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.templatePut(template)
+
+	return store.append(opTemplatePut, template)
+}
+
+func (store *storage) TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	versions := store.db.Templates[templateKey(playgroundId, name)]
+	if len(versions) == 0 {
+		return nil, NotFoundError
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, t := range versions {
+		if t.Version == version {
+			return t, nil
+		}
+	}
+	return nil, NotFoundError
+}
+
+func (store *storage) TemplateFindByPlaygroundId(playgroundId string) ([]*types.SessionTemplate, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	templates := []*types.SessionTemplate{}
+	for _, versions := range store.db.Templates {
+		for _, t := range versions {
+			if t.PlaygroundId == playgroundId {
+				templates = append(templates, t)
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+func (store *storage) TemplateDelete(playgroundId, name string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	key := templateKey(playgroundId, name)
+	if _, found := store.db.Templates[key]; !found {
+		return nil
+	}
+	delete(store.db.Templates, key)
+
+	return store.append(opTemplateDelete, key)
+}
+
+func (store *storage) LeaseAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	now := time.Now()
+	if l, found := store.db.Leases[name]; found && l.Holder != holder && !expired(l.ExpiresAt, now) {
+		return false, nil
+	}
+	l := &types.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+	store.db.Leases[name] = l
+
+	if err := store.append(opLeasePut, l); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (store *storage) LeaseRelease(name, holder string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if l, found := store.db.Leases[name]; !found || l.Holder != holder {
+		return nil
+	}
+	delete(store.db.Leases, name)
+
+	return store.append(opLeaseDelete, name)
+}
+
+func (store *storage) walPath() string {
+	return store.path + ".log"
+}
+
+// load reads the last snapshot and replays the write-ahead log on top of it.
+// A partially written entry at the end of the log, which is what a crash in
+// the middle of an append leaves behind, is discarded.
 func (store *storage) load() error {
 	file, err := os.Open(store.path)
-
 	if err == nil {
 		decoder := json.NewDecoder(file)
 		err = decoder.Decode(&store.db)
+		file.Close()
 
 		if err != nil {
 			return err
 		}
+		if store.db.Leases == nil {
+			// Snapshots written before leases existed
+			store.db.Leases = map[string]*types.Lease{}
+		}
+		if store.db.Snapshots == nil {
+			store.db.Snapshots = map[string]*types.Snapshot{}
+		}
+		for id, snapshot := range store.db.Snapshots {
+			// Written before snapshots had ids
+			if snapshot.Id == "" {
+				snapshot.Id = id
+			}
+		}
+		if store.db.SetupStatuses == nil {
+			store.db.SetupStatuses = map[string]*types.SessionSetupStatus{}
+		}
+		if store.db.Templates == nil {
+			store.db.Templates = map[string][]*types.SessionTemplate{}
+		}
+	} else if os.IsNotExist(err) {
+		store.db = newDB()
 	} else {
-		store.db = &DB{
-			Sessions:                    map[string]*types.Session{},
-			Instances:                   map[string]*types.Instance{},
-			Clients:                     map[string]*types.Client{},
-			WindowsInstances:            map[string]*types.WindowsInstance{},
-			LoginRequests:               map[string]*types.LoginRequest{},
-			Users:                       map[string]*types.User{},
-			Playgrounds:                 map[string]*types.Playground{},
-			WindowsInstancesBySessionId: map[string][]string{},
-			InstancesBySessionId:        map[string][]string{},
-			ClientsBySessionId:          map[string][]string{},
-			UsersByProvider:             map[string]string{},
-		}
-	}
-
-	file.Close()
+		return err
+	}
+
+	if store.readOnly {
+		return store.replayReadOnly()
+	}
+
+	wal, err := os.OpenFile(store.walPath(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(wal)
+	var offset int64
+	for {
+		var e walEntry
+		if err := decoder.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("Discarding corrupt write-ahead log tail at offset %d. Got: %v\n", offset, err)
+			if err := wal.Truncate(offset); err != nil {
+				wal.Close()
+				return err
+			}
+			break
+		}
+		if err := store.db.apply(&e); err != nil {
+			wal.Close()
+			return err
+		}
+		offset = decoder.InputOffset()
+		store.walEntries++
+	}
+
+	if _, err := wal.Seek(offset, io.SeekStart); err != nil {
+		wal.Close()
+		return err
+	}
+	store.wal = wal
+
+	if store.walEntries > 0 {
+		return store.compact()
+	}
 	return nil
 }
-func (store *storage) PlaygroundGetAll() ([]*types.Playground, error) {
-	store.rw.Lock()
-	defer store.rw.Unlock()
 
-	playgrounds := make([]*types.Playground, len(store.db.Playgrounds))
-	i := 0
-	for _, p := range store.db.Playgrounds {
-		playgrounds[i] = p
-		i++
+// replayReadOnly replays the write-ahead log without ever writing to it, as
+// another process may still be appending to it.
+func (store *storage) replayReadOnly() error {
+	wal, err := os.Open(store.walPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer wal.Close()
+
+	decoder := json.NewDecoder(wal)
+	for {
+		var e walEntry
+		if err := decoder.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			// Most likely an append in progress
+			log.Printf("Ignoring incomplete write-ahead log tail at offset %d. Got: %v\n", decoder.InputOffset(), err)
+			return nil
+		}
+		if err := store.db.apply(&e); err != nil {
+			return err
+		}
 	}
+}
 
-	return playgrounds, nil
+// append writes a mutation to the write-ahead log and makes sure it reaches
+// the disk before returning. The log is compacted into a snapshot once it
+// grows past compactAfter entries.
+func (store *storage) append(op string, v interface{}) error {
+	if store.readOnly {
+		return ReadOnlyError
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(walEntry{Op: op, Data: data})
+	if err != nil {
+		return err
+	}
+	if _, err := store.wal.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := store.wal.Sync(); err != nil {
+		return err
+	}
+
+	store.walEntries++
+	if store.walEntries >= store.compactAfter {
+		return store.compact()
+	}
+	return nil
 }
 
-func (store *storage) save() error {
-	file, err := os.Create(store.path)
+// compact writes the whole DB to a temporary file, atomically renames it over
+// the snapshot and then empties the log. If the process dies before the log
+// is truncated, replaying it on top of the new snapshot is harmless as every
+// entry is idempotent.
+func (store *storage) compact() error {
+	tmp := store.path + ".tmp"
+	file, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 	encoder := json.NewEncoder(file)
-	err = encoder.Encode(&store.db)
-	return err
+	if err := encoder.Encode(&store.db); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, store.path); err != nil {
+		return err
+	}
+
+	if err := store.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := store.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	store.walEntries = 0
+	return nil
 }
 
 func NewFileStorage(path string) (StorageApi, error) {
-	s := &storage{path: path}
+	s := &storage{path: path, compactAfter: defaultCompactAfter}
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewReadOnlyFileStorage loads the storage at path without compacting it or
+// touching its log, so it can be read while a PWD is still writing to it.
+// Writes to it fail with ReadOnlyError.
+func NewReadOnlyFileStorage(path string) (StorageApi, error) {
+	s := &storage{path: path, readOnly: true}
 
 	err := s.load()
 	if err != nil {
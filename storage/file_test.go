@@ -19,6 +19,7 @@ func TestSessionPut(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -37,11 +38,19 @@ func TestSessionPut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	// Reopening the storage replays the write-ahead log into a new snapshot
+	_, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -67,6 +76,10 @@ func TestSessionGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
@@ -82,6 +95,7 @@ func TestSessionGet(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -107,6 +121,10 @@ func TestSessionGetAll(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
@@ -122,6 +140,7 @@ func TestSessionGetAll(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -142,6 +161,7 @@ func TestSessionDelete(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -173,6 +193,10 @@ func TestInstanceGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{expectedInstance.SessionId: []string{expectedInstance.Name}},
 		ClientsBySessionId:          map[string][]string{},
@@ -188,6 +212,7 @@ func TestInstanceGet(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -206,6 +231,7 @@ func TestInstancePut(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -228,11 +254,19 @@ func TestInstancePut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{i.SessionId: []string{i.Name}},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	// Reopening the storage replays the write-ahead log into a new snapshot
+	_, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -256,6 +290,7 @@ func TestInstanceDelete(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -292,6 +327,10 @@ func TestInstanceFindBySessionId(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{i1.SessionId: []string{i1.Name, i2.Name}},
 		ClientsBySessionId:          map[string][]string{},
@@ -307,6 +346,7 @@ func TestInstanceFindBySessionId(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -329,6 +369,10 @@ func TestWindowsInstanceGetAll(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{i1.SessionId: []string{i1.Id, i2.Id}},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
@@ -344,6 +388,7 @@ func TestWindowsInstanceGetAll(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -363,6 +408,7 @@ func TestWindowsInstancePut(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -385,11 +431,19 @@ func TestWindowsInstancePut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{i.SessionId: []string{i.Id}},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	// Reopening the storage replays the write-ahead log into a new snapshot
+	_, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -413,6 +467,7 @@ func TestWindowsInstanceDelete(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -448,6 +503,10 @@ func TestClientGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{c.SessionId: []string{c.Id}},
@@ -463,6 +522,7 @@ func TestClientGet(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -481,6 +541,7 @@ func TestClientPut(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -503,11 +564,19 @@ func TestClientPut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{c.SessionId: []string{c.Id}},
 		UsersByProvider:             map[string]string{},
 	}
+	// Reopening the storage replays the write-ahead log into a new snapshot
+	_, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -531,6 +600,7 @@ func TestClientDelete(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -567,6 +637,10 @@ func TestClientFindBySessionId(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{c1.SessionId: []string{c1.Id, c2.Id}},
@@ -582,6 +656,7 @@ func TestClientFindBySessionId(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -603,6 +678,10 @@ func TestPlaygroundGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{p.Id: p},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
@@ -618,6 +697,7 @@ func TestPlaygroundGet(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -636,6 +716,7 @@ func TestPlaygroundPut(t *testing.T) {
 	tmpfile.Close()
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -654,11 +735,19 @@ func TestPlaygroundPut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{p.Id: p},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	// Reopening the storage replays the write-ahead log into a new snapshot
+	_, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -685,6 +774,10 @@ func TestPlaygroundGetAll(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{p1.Id: p1, p2.Id: p2},
+		Leases:                      map[string]*types.Lease{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		SetupStatuses:               map[string]*types.SessionSetupStatus{},
+		Templates:                   map[string][]*types.SessionTemplate{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
@@ -700,6 +793,7 @@ func TestPlaygroundGetAll(t *testing.T) {
 	assert.Nil(t, err)
 	tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -710,3 +804,183 @@ func TestPlaygroundGetAll(t *testing.T) {
 	assert.Subset(t, []*types.Playground{p1, p2}, found)
 	assert.Len(t, found, 2)
 }
+
+func TestFileStorage_RecoverFromTruncatedLog(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
+
+	storage, err := NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	s1 := &types.Session{Id: "session1"}
+	err = storage.SessionPut(s1)
+	assert.Nil(t, err)
+
+	// Simulate a crash in the middle of an append
+	wal, err := os.OpenFile(tmpfile.Name()+".log", os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = wal.WriteString(`{"op":"session_put","data":{"id":"sess`)
+	assert.Nil(t, err)
+	wal.Close()
+
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	sessions, err := storage.SessionGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Session{s1}, sessions)
+
+	// The storage must still be writable after recovering
+	s2 := &types.Session{Id: "session2"}
+	err = storage.SessionPut(s2)
+	assert.Nil(t, err)
+
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	count, err := storage.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestFileStorage_SnapshotsWithoutId(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
+
+	// Snapshots used to be logged without an id
+	err = ioutil.WriteFile(tmpfile.Name()+".log", []byte(`{"op":"snapshot_put","data":{"name":"snap1","playground_id":"p1"}}`+"\n"), 0644)
+	assert.Nil(t, err)
+
+	storage, err := NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	snapshot, err := storage.SnapshotGet("snap1")
+	assert.Nil(t, err)
+	assert.Equal(t, &types.Snapshot{Id: "snap1", Name: "snap1", PlaygroundId: "p1"}, snapshot)
+}
+
+func TestFileStorage_LoginRequestsSurviveReopen(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
+
+	storage, err := NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	lr1 := &types.LoginRequest{Id: "lr1", Provider: "github"}
+	lr2 := &types.LoginRequest{Id: "lr2", Provider: "google"}
+	assert.Nil(t, storage.LoginRequestPut(lr1))
+	assert.Nil(t, storage.LoginRequestPut(lr2))
+	assert.Nil(t, storage.LoginRequestDelete(lr2.Id))
+
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	found, err := storage.LoginRequestGet(lr1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, lr1, found)
+	_, err = storage.LoginRequestGet(lr2.Id)
+	assert.True(t, NotFound(err))
+}
+
+func TestFileStorage_Compact(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
+
+	s, err := NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+	s.(*storage).compactAfter = 3
+
+	s1 := &types.Session{Id: "session1"}
+	i1 := &types.Instance{Name: "i1", SessionId: s1.Id}
+	assert.Nil(t, s.SessionPut(s1))
+	assert.Nil(t, s.InstancePut(i1))
+
+	_, err = os.Stat(tmpfile.Name())
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, s.ClientPut(&types.Client{Id: "c1", SessionId: s1.Id}))
+
+	// Third entry triggers the compaction
+	info, err := os.Stat(tmpfile.Name() + ".log")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	var loadedDB *DB
+	file, err := os.Open(tmpfile.Name())
+	assert.Nil(t, err)
+	defer file.Close()
+	err = json.NewDecoder(file).Decode(&loadedDB)
+	assert.Nil(t, err)
+	assert.Equal(t, i1, loadedDB.Instances["i1"])
+	assert.Equal(t, []string{"c1"}, loadedDB.ClientsBySessionId[s1.Id])
+
+	// Deletes after a compaction are replayed on top of the snapshot
+	assert.Nil(t, s.InstanceDelete("i1"))
+
+	s, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	_, err = s.InstanceGet("i1")
+	assert.True(t, NotFound(err))
+	instances, err := s.InstanceFindBySessionId(s1.Id)
+	assert.Nil(t, err)
+	assert.Empty(t, instances)
+}
+
+func TestFileStorage_ReadOnly(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name() + ".log")
+
+	s, err := NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	s1 := &types.Session{Id: "session1"}
+	assert.Nil(t, s.SessionPut(s1))
+	before, err := os.Stat(tmpfile.Name() + ".log")
+	assert.Nil(t, err)
+
+	ro, err := NewReadOnlyFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
+	sessions, err := ro.SessionGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Session{s1}, sessions)
+	assert.Equal(t, ReadOnlyError, ro.SessionPut(&types.Session{Id: "session2"}))
+
+	// Neither compacted nor truncated, the writer keeps appending at its offset
+	after, err := os.Stat(tmpfile.Name() + ".log")
+	assert.Nil(t, err)
+	assert.Equal(t, before.Size(), after.Size())
+	_, err = os.Stat(tmpfile.Name())
+	assert.True(t, os.IsNotExist(err))
+}
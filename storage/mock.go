@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/stretchr/testify/mock"
 )
@@ -21,6 +23,11 @@ func (m *Mock) SessionPut(session *types.Session) error {
 	args := m.Called(session)
 	return args.Error(0)
 }
+func (m *Mock) SessionActivityPut(sessionId string, at time.Time) error {
+	args := m.Called(sessionId, at)
+	return args.Error(0)
+}
+
 func (m *Mock) SessionDelete(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
@@ -82,6 +89,10 @@ func (m *Mock) ClientFindBySessionId(sessionId string) ([]*types.Client, error)
 	args := m.Called(sessionId)
 	return args.Get(0).([]*types.Client), args.Error(1)
 }
+func (m *Mock) ClientFindExpired(now time.Time) ([]*types.Client, error) {
+	args := m.Called(now)
+	return args.Get(0).([]*types.Client), args.Error(1)
+}
 func (m *Mock) LoginRequestPut(loginRequest *types.LoginRequest) error {
 	args := m.Called(loginRequest)
 	return args.Error(0)
@@ -94,6 +105,14 @@ func (m *Mock) LoginRequestDelete(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
+func (m *Mock) LoginRequestGetAll() ([]*types.LoginRequest, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.LoginRequest), args.Error(1)
+}
+func (m *Mock) LoginRequestFindExpired(now time.Time) ([]*types.LoginRequest, error) {
+	args := m.Called(now)
+	return args.Get(0).([]*types.LoginRequest), args.Error(1)
+}
 func (m *Mock) UserFindByProvider(providerName, providerUserId string) (*types.User, error) {
 	args := m.Called(providerName, providerUserId)
 	return args.Get(0).(*types.User), args.Error(1)
@@ -106,6 +125,10 @@ func (m *Mock) UserGet(id string) (*types.User, error) {
 	args := m.Called(id)
 	return args.Get(0).(*types.User), args.Error(1)
 }
+func (m *Mock) UserGetAll() ([]*types.User, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.User), args.Error(1)
+}
 func (m *Mock) PlaygroundPut(playground *types.Playground) error {
 	args := m.Called(playground)
 	return args.Error(0)
@@ -118,3 +141,54 @@ func (m *Mock) PlaygroundGetAll() ([]*types.Playground, error) {
 	args := m.Called()
 	return args.Get(0).([]*types.Playground), args.Error(1)
 }
+func (m *Mock) SnapshotPut(snapshot *types.Snapshot) error {
+	args := m.Called(snapshot)
+	return args.Error(0)
+}
+func (m *Mock) SnapshotGet(id string) (*types.Snapshot, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Snapshot), args.Error(1)
+}
+func (m *Mock) SnapshotGetAll() ([]*types.Snapshot, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.Snapshot), args.Error(1)
+}
+func (m *Mock) SnapshotDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) SessionSetupStatusPut(status *types.SessionSetupStatus) error {
+	args := m.Called(status)
+	return args.Error(0)
+}
+func (m *Mock) SessionSetupStatusGet(sessionId string) (*types.SessionSetupStatus, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).(*types.SessionSetupStatus), args.Error(1)
+}
+
+func (m *Mock) TemplatePut(template *types.SessionTemplate) error {
+	args := m.Called(template)
+	return args.Error(0)
+}
+func (m *Mock) TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error) {
+	args := m.Called(playgroundId, name, version)
+	return args.Get(0).(*types.SessionTemplate), args.Error(1)
+}
+func (m *Mock) TemplateFindByPlaygroundId(playgroundId string) ([]*types.SessionTemplate, error) {
+	args := m.Called(playgroundId)
+	return args.Get(0).([]*types.SessionTemplate), args.Error(1)
+}
+func (m *Mock) TemplateDelete(playgroundId, name string) error {
+	args := m.Called(playgroundId, name)
+	return args.Error(0)
+}
+
+func (m *Mock) LeaseAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	args := m.Called(name, holder, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *Mock) LeaseRelease(name, holder string) error {
+	args := m.Called(name, holder)
+	return args.Error(0)
+}
@@ -0,0 +1,773 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// migrations are applied in order and each one exactly once. Never edit an
+// existing entry, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE instances (
+		name TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX instances_session_id_idx ON instances (session_id);
+	CREATE TABLE windows_instances (
+		id TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX windows_instances_session_id_idx ON windows_instances (session_id);
+	CREATE TABLE clients (
+		id TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX clients_session_id_idx ON clients (session_id);
+	CREATE TABLE login_requests (
+		id TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		provider TEXT NOT NULL,
+		provider_user_id TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE UNIQUE INDEX users_provider_idx ON users (provider, provider_user_id);
+	CREATE TABLE playgrounds (
+		id TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	);`,
+	`ALTER TABLE clients ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+	CREATE INDEX clients_expires_at_idx ON clients (expires_at);
+	ALTER TABLE login_requests ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+	CREATE INDEX login_requests_expires_at_idx ON login_requests (expires_at);`,
+	`CREATE TABLE leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		expires_at BIGINT NOT NULL
+	);`,
+	`CREATE TABLE snapshots (
+		name TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	);`,
+	`CREATE TABLE session_templates (
+		playground_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (playground_id, name, version)
+	);`,
+	`CREATE TABLE session_setups (
+		session_id TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	);`,
+	`ALTER TABLE sessions ADD COLUMN last_activity_at BIGINT NOT NULL DEFAULT 0;`,
+	`ALTER TABLE snapshots RENAME COLUMN name TO id;`,
+}
+
+type sqlStorage struct {
+	db       *sql.DB
+	driver   string
+	readOnly bool
+}
+
+// unixNano converts an expiry time to what is stored in the expires_at
+// columns, where 0 means that the record never expires.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func (store *sqlStorage) rebind(query string) string {
+	if store.driver != "postgres" && store.driver != "pgx" {
+		return query
+	}
+	// Postgres uses numbered placeholders instead of "?"
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (store *sqlStorage) exec(query string, args ...interface{}) (sql.Result, error) {
+	if store.readOnly {
+		return nil, ReadOnlyError
+	}
+	return store.db.Exec(store.rebind(query), args...)
+}
+
+func (store *sqlStorage) get(v interface{}, query string, args ...interface{}) error {
+	var data string
+	if err := store.db.QueryRow(store.rebind(query), args...).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return NotFoundError
+		}
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+func (store *sqlStorage) list(query string, args []interface{}, each func(data []byte) error) error {
+	rows, err := store.db.Query(store.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := each([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (store *sqlStorage) count(table string) (int, error) {
+	var c int
+	if err := store.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&c); err != nil {
+		return 0, err
+	}
+	return c, nil
+}
+
+func (store *sqlStorage) sessionExists(id string) (bool, error) {
+	var c int
+	if err := store.db.QueryRow(store.rebind("SELECT COUNT(*) FROM sessions WHERE id = ?"), id).Scan(&c); err != nil {
+		return false, err
+	}
+	return c > 0, nil
+}
+
+// scanSession decodes a session, whose activity is kept in its own column so
+// it can be updated on its own.
+func scanSession(row interface{ Scan(...interface{}) error }) (*types.Session, error) {
+	var data string
+	var lastActivity int64
+	if err := row.Scan(&data, &lastActivity); err != nil {
+		return nil, err
+	}
+	s := &types.Session{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		return nil, err
+	}
+	if at := time.Unix(0, lastActivity); lastActivity > 0 && at.After(s.LastActivityAt) {
+		s.LastActivityAt = at
+	}
+	return s, nil
+}
+
+func (store *sqlStorage) SessionGet(id string) (*types.Session, error) {
+	s, err := scanSession(store.db.QueryRow(store.rebind("SELECT data, last_activity_at FROM sessions WHERE id = ?"), id))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError
+	}
+	return s, err
+}
+
+func (store *sqlStorage) SessionGetAll() ([]*types.Session, error) {
+	rows, err := store.db.Query("SELECT data, last_activity_at FROM sessions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*types.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (store *sqlStorage) SessionPut(session *types.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO sessions (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data", session.Id, string(data))
+	return err
+}
+
+func (store *sqlStorage) SessionActivityPut(sessionId string, at time.Time) error {
+	res, err := store.exec("UPDATE sessions SET last_activity_at = ? WHERE id = ? AND last_activity_at < ?", at.UnixNano(), sessionId, at.UnixNano())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+	// Either a later activity is already stored or there's no such session
+	if found, err := store.sessionExists(sessionId); err != nil {
+		return err
+	} else if !found {
+		return NotFoundError
+	}
+	return nil
+}
+
+func (store *sqlStorage) SessionDelete(id string) error {
+	if store.readOnly {
+		return ReadOnlyError
+	}
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"windows_instances", "instances", "clients", "session_setups"} {
+		if _, err := tx.Exec(store.rebind(fmt.Sprintf("DELETE FROM %s WHERE session_id = ?", table)), id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(store.rebind("DELETE FROM sessions WHERE id = ?"), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (store *sqlStorage) SessionCount() (int, error) {
+	return store.count("sessions")
+}
+
+func (store *sqlStorage) InstanceGet(name string) (*types.Instance, error) {
+	i := &types.Instance{}
+	if err := store.get(i, "SELECT data FROM instances WHERE name = ?", name); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (store *sqlStorage) InstancePut(instance *types.Instance) error {
+	if found, err := store.sessionExists(instance.SessionId); err != nil {
+		return err
+	} else if !found {
+		return NotFoundError
+	}
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO instances (name, session_id, data) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET session_id = excluded.session_id, data = excluded.data", instance.Name, instance.SessionId, string(data))
+	return err
+}
+
+func (store *sqlStorage) InstanceDelete(name string) error {
+	_, err := store.exec("DELETE FROM instances WHERE name = ?", name)
+	return err
+}
+
+func (store *sqlStorage) InstanceCount() (int, error) {
+	return store.count("instances")
+}
+
+func (store *sqlStorage) InstanceFindBySessionId(sessionId string) ([]*types.Instance, error) {
+	instances := []*types.Instance{}
+	err := store.list("SELECT data FROM instances WHERE session_id = ?", []interface{}{sessionId}, func(data []byte) error {
+		i := &types.Instance{}
+		if err := json.Unmarshal(data, i); err != nil {
+			return err
+		}
+		instances = append(instances, i)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (store *sqlStorage) WindowsInstanceGetAll() ([]*types.WindowsInstance, error) {
+	instances := []*types.WindowsInstance{}
+	err := store.list("SELECT data FROM windows_instances", nil, func(data []byte) error {
+		i := &types.WindowsInstance{}
+		if err := json.Unmarshal(data, i); err != nil {
+			return err
+		}
+		instances = append(instances, i)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (store *sqlStorage) WindowsInstancePut(instance *types.WindowsInstance) error {
+	if found, err := store.sessionExists(instance.SessionId); err != nil {
+		return err
+	} else if !found {
+		return NotFoundError
+	}
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO windows_instances (id, session_id, data) VALUES (?, ?, ?) ON CONFLICT (id) DO UPDATE SET session_id = excluded.session_id, data = excluded.data", instance.Id, instance.SessionId, string(data))
+	return err
+}
+
+func (store *sqlStorage) WindowsInstanceDelete(id string) error {
+	_, err := store.exec("DELETE FROM windows_instances WHERE id = ?", id)
+	return err
+}
+
+func (store *sqlStorage) ClientGet(id string) (*types.Client, error) {
+	c := &types.Client{}
+	if err := store.get(c, "SELECT data FROM clients WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (store *sqlStorage) ClientPut(client *types.Client) error {
+	if found, err := store.sessionExists(client.SessionId); err != nil {
+		return err
+	} else if !found {
+		return NotFoundError
+	}
+	data, err := json.Marshal(client)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO clients (id, session_id, expires_at, data) VALUES (?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET session_id = excluded.session_id, expires_at = excluded.expires_at, data = excluded.data", client.Id, client.SessionId, unixNano(client.ExpiresAt), string(data))
+	return err
+}
+
+func (store *sqlStorage) ClientDelete(id string) error {
+	_, err := store.exec("DELETE FROM clients WHERE id = ?", id)
+	return err
+}
+
+func (store *sqlStorage) ClientCount() (int, error) {
+	return store.count("clients")
+}
+
+func (store *sqlStorage) ClientFindBySessionId(sessionId string) ([]*types.Client, error) {
+	clients := []*types.Client{}
+	err := store.list("SELECT data FROM clients WHERE session_id = ?", []interface{}{sessionId}, func(data []byte) error {
+		c := &types.Client{}
+		if err := json.Unmarshal(data, c); err != nil {
+			return err
+		}
+		clients = append(clients, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (store *sqlStorage) ClientFindExpired(now time.Time) ([]*types.Client, error) {
+	clients := []*types.Client{}
+	err := store.list("SELECT data FROM clients WHERE expires_at > 0 AND expires_at <= ?", []interface{}{now.UnixNano()}, func(data []byte) error {
+		c := &types.Client{}
+		if err := json.Unmarshal(data, c); err != nil {
+			return err
+		}
+		clients = append(clients, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (store *sqlStorage) LoginRequestPut(loginRequest *types.LoginRequest) error {
+	data, err := json.Marshal(loginRequest)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO login_requests (id, expires_at, data) VALUES (?, ?, ?) ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at, data = excluded.data", loginRequest.Id, unixNano(loginRequest.ExpiresAt), string(data))
+	return err
+}
+
+func (store *sqlStorage) LoginRequestGet(id string) (*types.LoginRequest, error) {
+	lr := &types.LoginRequest{}
+	if err := store.get(lr, "SELECT data FROM login_requests WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return lr, nil
+}
+
+func (store *sqlStorage) LoginRequestDelete(id string) error {
+	_, err := store.exec("DELETE FROM login_requests WHERE id = ?", id)
+	return err
+}
+
+func (store *sqlStorage) LoginRequestGetAll() ([]*types.LoginRequest, error) {
+	loginRequests := []*types.LoginRequest{}
+	err := store.list("SELECT data FROM login_requests", nil, func(data []byte) error {
+		lr := &types.LoginRequest{}
+		if err := json.Unmarshal(data, lr); err != nil {
+			return err
+		}
+		loginRequests = append(loginRequests, lr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loginRequests, nil
+}
+
+func (store *sqlStorage) LoginRequestFindExpired(now time.Time) ([]*types.LoginRequest, error) {
+	loginRequests := []*types.LoginRequest{}
+	err := store.list("SELECT data FROM login_requests WHERE expires_at > 0 AND expires_at <= ?", []interface{}{now.UnixNano()}, func(data []byte) error {
+		lr := &types.LoginRequest{}
+		if err := json.Unmarshal(data, lr); err != nil {
+			return err
+		}
+		loginRequests = append(loginRequests, lr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loginRequests, nil
+}
+
+func (store *sqlStorage) UserFindByProvider(providerName, providerUserId string) (*types.User, error) {
+	u := &types.User{}
+	if err := store.get(u, "SELECT data FROM users WHERE provider = ? AND provider_user_id = ?", providerName, providerUserId); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (store *sqlStorage) UserPut(user *types.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO users (id, provider, provider_user_id, data) VALUES (?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET provider = excluded.provider, provider_user_id = excluded.provider_user_id, data = excluded.data", user.Id, user.Provider, user.ProviderUserId, string(data))
+	return err
+}
+
+func (store *sqlStorage) UserGet(id string) (*types.User, error) {
+	u := &types.User{}
+	if err := store.get(u, "SELECT data FROM users WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (store *sqlStorage) UserGetAll() ([]*types.User, error) {
+	users := []*types.User{}
+	err := store.list("SELECT data FROM users", nil, func(data []byte) error {
+		u := &types.User{}
+		if err := json.Unmarshal(data, u); err != nil {
+			return err
+		}
+		users = append(users, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (store *sqlStorage) PlaygroundPut(playground *types.Playground) error {
+	data, err := json.Marshal(playground)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO playgrounds (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data", playground.Id, string(data))
+	return err
+}
+
+func (store *sqlStorage) PlaygroundGet(id string) (*types.Playground, error) {
+	p := &types.Playground{}
+	if err := store.get(p, "SELECT data FROM playgrounds WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (store *sqlStorage) PlaygroundGetAll() ([]*types.Playground, error) {
+	playgrounds := []*types.Playground{}
+	err := store.list("SELECT data FROM playgrounds", nil, func(data []byte) error {
+		p := &types.Playground{}
+		if err := json.Unmarshal(data, p); err != nil {
+			return err
+		}
+		playgrounds = append(playgrounds, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return playgrounds, nil
+}
+
+func (store *sqlStorage) SnapshotPut(snapshot *types.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec("INSERT INTO snapshots (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data", snapshot.Id, string(data))
+	return err
+}
+
+func (store *sqlStorage) SnapshotGet(id string) (*types.Snapshot, error) {
+	snapshot := &types.Snapshot{}
+	if err := store.get(snapshot, "SELECT data FROM snapshots WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	if snapshot.Id == "" {
+		// Stored before snapshots had ids, under their name
+		snapshot.Id = id
+	}
+	return snapshot, nil
+}
+
+func (store *sqlStorage) SnapshotGetAll() ([]*types.Snapshot, error) {
+	snapshots := []*types.Snapshot{}
+	err := store.list("SELECT data FROM snapshots", nil, func(data []byte) error {
+		snapshot := &types.Snapshot{}
+		if err := json.Unmarshal(data, snapshot); err != nil {
+			return err
+		}
+		if snapshot.Id == "" {
+			snapshot.Id = snapshot.Name
+		}
+		snapshots = append(snapshots, snapshot)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (store *sqlStorage) SnapshotDelete(id string) error {
+	_, err := store.exec("DELETE FROM snapshots WHERE id = ?", id)
+	return err
+}
+
+func (store *sqlStorage) SessionSetupStatusPut(status *types.SessionSetupStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	// The setup of a session that was closed while it ran isn't kept
+	res, err := store.exec(`INSERT INTO session_setups (session_id, data) SELECT ?, ? WHERE EXISTS (SELECT 1 FROM sessions WHERE id = ?)
+		ON CONFLICT (session_id) DO UPDATE SET data = excluded.data`, status.SessionId, string(data), status.SessionId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return NotFoundError
+	}
+	return nil
+}
+
+func (store *sqlStorage) SessionSetupStatusGet(sessionId string) (*types.SessionSetupStatus, error) {
+	status := &types.SessionSetupStatus{}
+	if err := store.get(status, "SELECT data FROM session_setups WHERE session_id = ?", sessionId); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (store *sqlStorage) TemplatePut(template *types.SessionTemplate) error {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	_, err = store.exec(`INSERT INTO session_templates (playground_id, name, version, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (playground_id, name, version) DO UPDATE SET data = excluded.data`, template.PlaygroundId, template.Name, template.Version, string(data))
+	return err
+}
+
+func (store *sqlStorage) TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error) {
+	template := &types.SessionTemplate{}
+	var err error
+	if version == 0 {
+		err = store.get(template, "SELECT data FROM session_templates WHERE playground_id = ? AND name = ? ORDER BY version DESC LIMIT 1", playgroundId, name)
+	} else {
+		err = store.get(template, "SELECT data FROM session_templates WHERE playground_id = ? AND name = ? AND version = ?", playgroundId, name, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (store *sqlStorage) TemplateFindByPlaygroundId(playgroundId string) ([]*types.SessionTemplate, error) {
+	templates := []*types.SessionTemplate{}
+	err := store.list("SELECT data FROM session_templates WHERE playground_id = ? ORDER BY name, version", []interface{}{playgroundId}, func(data []byte) error {
+		template := &types.SessionTemplate{}
+		if err := json.Unmarshal(data, template); err != nil {
+			return err
+		}
+		templates = append(templates, template)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (store *sqlStorage) TemplateDelete(playgroundId, name string) error {
+	_, err := store.exec("DELETE FROM session_templates WHERE playground_id = ? AND name = ?", playgroundId, name)
+	return err
+}
+
+func (store *sqlStorage) LeaseAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// The update only happens when the lease is free to take, so the upsert
+	// is a no-op when somebody else holds it.
+	res, err := store.exec(`INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at <= ?`, name, holder, now.Add(ttl).UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (store *sqlStorage) LeaseRelease(name, holder string) error {
+	_, err := store.exec("DELETE FROM leases WHERE name = ? AND holder = ?", name, holder)
+	return err
+}
+
+func (store *sqlStorage) schemaVersion() (int, error) {
+	var current int
+	if err := store.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (store *sqlStorage) migrate() error {
+	if _, err := store.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)"); err != nil {
+		return err
+	}
+	current, err := store.schemaVersion()
+	if err != nil {
+		return err
+	}
+	for n := current; n < len(migrations); n++ {
+		tx, err := store.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range strings.Split(migrations[n], ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("Error applying migration %d. Got: %v", n+1, err)
+			}
+		}
+		if _, err := tx.Exec(store.rebind("INSERT INTO schema_migrations (version) VALUES (?)"), n+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewSQLStorage opens the database identified by driver and dsn and brings
+// its schema up to date. The driver must have been registered by importing
+// it, e.g. modernc.org/sqlite for "sqlite", which doesn't need cgo.
+func NewSQLStorage(driver, dsn string) (StorageApi, error) {
+	s, err := openSQL(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.migrate(); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewReadOnlySQLStorage opens the database without migrating it. Its schema
+// must already be up to date. Writes to it fail with ReadOnlyError.
+func NewReadOnlySQLStorage(driver, dsn string) (StorageApi, error) {
+	s, err := openSQL(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s.readOnly = true
+	current, err := s.schemaVersion()
+	if err != nil {
+		s.db.Close()
+		return nil, fmt.Errorf("Could not read schema version. Got: %v", err)
+	}
+	if current != len(migrations) {
+		s.db.Close()
+		return nil, fmt.Errorf("Database schema is at version %d but version %d is needed", current, len(migrations))
+	}
+
+	return s, nil
+}
+
+func openSQL(driver, dsn string) (*sqlStorage, error) {
+	if driver == "sqlite3" {
+		// Name of the cgo driver used before, still found in configurations
+		driver = "sqlite"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// SQLite only allows one writer at a time and every new connection to
+		// an in-memory database would get its own empty database.
+		db.SetMaxOpenConns(1)
+	}
+	return &sqlStorage{db: db, driver: driver}, nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLStorage_Migrate(t *testing.T) {
+	storage, err := NewSQLStorage("sqlite", ":memory:")
+	assert.Nil(t, err)
+
+	// Running migrations again on an up to date schema is a no-op
+	s := storage.(*sqlStorage)
+	assert.Nil(t, s.migrate())
+
+	var version int
+	err = s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	assert.Nil(t, err)
+	assert.Equal(t, len(migrations), version)
+}
+
+func TestSQLStorage_ReadOnly(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "pwd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	dsn := filepath.Join(tmpdir, "sessions.db")
+
+	// Not migrated yet
+	_, err = NewReadOnlySQLStorage("sqlite", dsn)
+	assert.NotNil(t, err)
+
+	s, err := NewSQLStorage("sqlite", dsn)
+	assert.Nil(t, err)
+	s1 := &types.Session{Id: "session1"}
+	assert.Nil(t, s.SessionPut(s1))
+
+	ro, err := NewReadOnlySQLStorage("sqlite", dsn)
+	assert.Nil(t, err)
+
+	session, err := ro.SessionGet("session1")
+	assert.Nil(t, err)
+	assert.Equal(t, s1, session)
+	assert.Equal(t, ReadOnlyError, ro.SessionPut(&types.Session{Id: "session2"}))
+	assert.Equal(t, ReadOnlyError, ro.SessionDelete("session1"))
+}
+
+func TestSQLStorage_SnapshotsWithoutId(t *testing.T) {
+	s, err := openSQL("sqlite", ":memory:")
+	assert.Nil(t, err)
+
+	// Snapshots used to be stored under their name
+	all := migrations
+	migrations = all[:len(all)-1]
+	err = s.migrate()
+	migrations = all
+	assert.Nil(t, err)
+	_, err = s.exec("INSERT INTO snapshots (name, data) VALUES (?, ?)", "snap1", `{"name":"snap1","playground_id":"p1"}`)
+	assert.Nil(t, err)
+	assert.Nil(t, s.migrate())
+
+	snapshot, err := s.SnapshotGet("snap1")
+	assert.Nil(t, err)
+	assert.Equal(t, &types.Snapshot{Id: "snap1", Name: "snap1", PlaygroundId: "p1"}, snapshot)
+
+	snapshots, err := s.SnapshotGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Snapshot{snapshot}, snapshots)
+}
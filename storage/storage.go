@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"time"
 
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
@@ -12,10 +13,22 @@ func NotFound(e error) bool {
 	return e == NotFoundError
 }
 
+// ReadOnlyError is returned by writes to a storage opened read-only.
+var ReadOnlyError = errors.New("Storage was opened read-only")
+
+// expired reports whether a record with the given expiry time has expired at
+// now. A zero expiry time means the record never expires.
+func expired(expiresAt, now time.Time) bool {
+	return !expiresAt.IsZero() && !expiresAt.After(now)
+}
+
 type StorageApi interface {
 	SessionGet(id string) (*types.Session, error)
 	SessionGetAll() ([]*types.Session, error)
 	SessionPut(session *types.Session) error
+	// SessionActivityPut moves the LastActivityAt of a session forward
+	// without touching the rest of it. SessionPut never moves it back.
+	SessionActivityPut(sessionId string, at time.Time) error
 	SessionDelete(id string) error
 	SessionCount() (int, error)
 
@@ -34,16 +47,47 @@ type StorageApi interface {
 	ClientDelete(id string) error
 	ClientCount() (int, error)
 	ClientFindBySessionId(sessionId string) ([]*types.Client, error)
+	ClientFindExpired(now time.Time) ([]*types.Client, error)
 
 	LoginRequestPut(loginRequest *types.LoginRequest) error
 	LoginRequestGet(id string) (*types.LoginRequest, error)
 	LoginRequestDelete(id string) error
+	LoginRequestGetAll() ([]*types.LoginRequest, error)
+	LoginRequestFindExpired(now time.Time) ([]*types.LoginRequest, error)
 
 	UserFindByProvider(providerName, providerUserId string) (*types.User, error)
 	UserPut(user *types.User) error
 	UserGet(id string) (*types.User, error)
+	UserGetAll() ([]*types.User, error)
 
 	PlaygroundPut(playground *types.Playground) error
 	PlaygroundGet(id string) (*types.Playground, error)
 	PlaygroundGetAll() ([]*types.Playground, error)
+
+	SnapshotPut(snapshot *types.Snapshot) error
+	SnapshotGet(id string) (*types.Snapshot, error)
+	SnapshotGetAll() ([]*types.Snapshot, error)
+	SnapshotDelete(id string) error
+
+	// SessionSetupStatusPut and SessionSetupStatusGet keep the setup status
+	// of a session, which is deleted along with the session.
+	SessionSetupStatusPut(status *types.SessionSetupStatus) error
+	SessionSetupStatusGet(sessionId string) (*types.SessionSetupStatus, error)
+
+	TemplatePut(template *types.SessionTemplate) error
+	// TemplateGet returns the given version of a template, or its latest one
+	// when version is 0.
+	TemplateGet(playgroundId, name string, version int) (*types.SessionTemplate, error)
+	// TemplateFindByPlaygroundId returns every version of the templates of
+	// the playground.
+	TemplateFindByPlaygroundId(playgroundId string) ([]*types.SessionTemplate, error)
+	// TemplateDelete deletes every version of a template.
+	TemplateDelete(playgroundId, name string) error
+
+	// LeaseAcquire takes the named lease for holder for ttl if nobody holds
+	// it, it expired or holder already has it, in which case it's renewed. It
+	// reports whether holder has the lease afterwards.
+	LeaseAcquire(name, holder string, ttl time.Duration) (bool, error)
+	// LeaseRelease gives up the named lease if holder has it.
+	LeaseRelease(name, holder string) error
 }
@@ -0,0 +1,629 @@
+// Package storagetest provides a conformance suite that every
+// storage.StorageApi implementation is expected to pass.
+package storagetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory returns a new, empty storage. It is called once per test.
+type Factory func(t *testing.T) storage.StorageApi
+
+// Run exercises every method of the storage returned by factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.StorageApi)
+	}{
+		{"Session", testSession},
+		{"SessionDelete", testSessionDelete},
+		{"SessionActivity", testSessionActivity},
+		{"Instance", testInstance},
+		{"InstanceIndex", testInstanceIndex},
+		{"WindowsInstance", testWindowsInstance},
+		{"Client", testClient},
+		{"ClientIndex", testClientIndex},
+		{"ClientExpired", testClientExpired},
+		{"LoginRequest", testLoginRequest},
+		{"LoginRequestExpired", testLoginRequestExpired},
+		{"User", testUser},
+		{"Playground", testPlayground},
+		{"Snapshot", testSnapshot},
+		{"Template", testTemplate},
+		{"SessionSetupStatus", testSessionSetupStatus},
+		{"Lease", testLease},
+		{"LeaseExpired", testLeaseExpired},
+		{"Concurrent", testConcurrent},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+func testSession(t *testing.T, s storage.StorageApi) {
+	found, err := s.SessionGet("s1")
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	count, err := s.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	s1 := &types.Session{Id: "s1", StackName: "pwd", PlaygroundId: "p1"}
+	s2 := &types.Session{Id: "s2"}
+	assert.Nil(t, s.SessionPut(s1))
+	assert.Nil(t, s.SessionPut(s2))
+
+	found, err = s.SessionGet(s1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s1, found)
+
+	s1.Ready = true
+	assert.Nil(t, s.SessionPut(s1))
+	found, err = s.SessionGet(s1.Id)
+	assert.Nil(t, err)
+	assert.True(t, found.Ready)
+
+	sessions, err := s.SessionGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, sessions, []*types.Session{s1, s2})
+	assert.Len(t, sessions, 2)
+
+	count, err = s.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func testSessionActivity(t *testing.T, s storage.StorageApi) {
+	now := time.Now().Truncate(time.Second)
+	assert.True(t, storage.NotFound(s.SessionActivityPut("s1", now)))
+
+	s1 := &types.Session{Id: "s1", ExpiresAt: now.Add(time.Hour), LastActivityAt: now}
+	assert.Nil(t, s.SessionPut(s1))
+
+	// Concurrent updates of the rest of the session are kept
+	updated := *s1
+	updated.ExpiresAt = now.Add(2 * time.Hour)
+	assert.Nil(t, s.SessionPut(&updated))
+	assert.Nil(t, s.SessionActivityPut("s1", now.Add(time.Minute)))
+
+	found, err := s.SessionGet("s1")
+	assert.Nil(t, err)
+	assert.True(t, found.ExpiresAt.Equal(now.Add(2*time.Hour)))
+	assert.True(t, found.LastActivityAt.Equal(now.Add(time.Minute)))
+
+	// Activity never goes back
+	assert.Nil(t, s.SessionActivityPut("s1", now))
+	assert.Nil(t, s.SessionPut(&updated))
+	sessions, err := s.SessionGetAll()
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+	assert.True(t, sessions[0].LastActivityAt.Equal(now.Add(time.Minute)))
+}
+
+func testSessionDelete(t *testing.T, s storage.StorageApi) {
+	// Deleting something that doesn't exist is not an error
+	assert.Nil(t, s.SessionDelete("s1"))
+
+	s1 := &types.Session{Id: "s1"}
+	s2 := &types.Session{Id: "s2"}
+	assert.Nil(t, s.SessionPut(s1))
+	assert.Nil(t, s.SessionPut(s2))
+	assert.Nil(t, s.InstancePut(&types.Instance{Name: "i1", SessionId: s1.Id}))
+	assert.Nil(t, s.InstancePut(&types.Instance{Name: "i2", SessionId: s2.Id}))
+	assert.Nil(t, s.WindowsInstancePut(&types.WindowsInstance{Id: "w1", SessionId: s1.Id}))
+	assert.Nil(t, s.ClientPut(&types.Client{Id: "c1", SessionId: s1.Id}))
+
+	assert.Nil(t, s.SessionDelete(s1.Id))
+
+	found, err := s.SessionGet(s1.Id)
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	// Everything that belonged to the session is gone too
+	_, err = s.InstanceGet("i1")
+	assert.True(t, storage.NotFound(err))
+	instances, err := s.InstanceFindBySessionId(s1.Id)
+	assert.Nil(t, err)
+	assert.Empty(t, instances)
+	_, err = s.ClientGet("c1")
+	assert.True(t, storage.NotFound(err))
+	clients, err := s.ClientFindBySessionId(s1.Id)
+	assert.Nil(t, err)
+	assert.Empty(t, clients)
+	windows, err := s.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, windows)
+
+	// While other sessions are untouched
+	instances, err = s.InstanceFindBySessionId(s2.Id)
+	assert.Nil(t, err)
+	assert.Len(t, instances, 1)
+	count, err := s.InstanceCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, err = s.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func testInstance(t *testing.T, s storage.StorageApi) {
+	i1 := &types.Instance{Name: "i1", SessionId: "s1", IP: "10.0.0.1", Hostname: "node1"}
+
+	// Instances can only be added to existing sessions
+	assert.True(t, storage.NotFound(s.InstancePut(i1)))
+
+	found, err := s.InstanceGet(i1.Name)
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1"}))
+	assert.Nil(t, s.InstancePut(i1))
+
+	found, err = s.InstanceGet(i1.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, i1, found)
+
+	i1.IP = "10.0.0.2"
+	assert.Nil(t, s.InstancePut(i1))
+	found, err = s.InstanceGet(i1.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", found.IP)
+
+	count, err := s.InstanceCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.Nil(t, s.InstanceDelete(i1.Name))
+	assert.Nil(t, s.InstanceDelete(i1.Name))
+
+	_, err = s.InstanceGet(i1.Name)
+	assert.True(t, storage.NotFound(err))
+	count, err = s.InstanceCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testInstanceIndex(t *testing.T, s storage.StorageApi) {
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1"}))
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s2"}))
+
+	i1 := &types.Instance{Name: "i1", SessionId: "s1"}
+	i2 := &types.Instance{Name: "i2", SessionId: "s1"}
+	i3 := &types.Instance{Name: "i3", SessionId: "s2"}
+	assert.Nil(t, s.InstancePut(i1))
+	assert.Nil(t, s.InstancePut(i2))
+	assert.Nil(t, s.InstancePut(i3))
+	// Putting the same instance twice must not duplicate it in the index
+	assert.Nil(t, s.InstancePut(i1))
+
+	instances, err := s.InstanceFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Subset(t, instances, []*types.Instance{i1, i2})
+	assert.Len(t, instances, 2)
+
+	instances, err = s.InstanceFindBySessionId("unknown")
+	assert.Nil(t, err)
+	assert.Empty(t, instances)
+
+	assert.Nil(t, s.InstanceDelete(i1.Name))
+	instances, err = s.InstanceFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Instance{i2}, instances)
+	instances, err = s.InstanceFindBySessionId("s2")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Instance{i3}, instances)
+}
+
+func testWindowsInstance(t *testing.T, s storage.StorageApi) {
+	w1 := &types.WindowsInstance{Id: "w1", SessionId: "s1"}
+	w2 := &types.WindowsInstance{Id: "w2", SessionId: "s1"}
+
+	assert.True(t, storage.NotFound(s.WindowsInstancePut(w1)))
+
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1"}))
+	assert.Nil(t, s.WindowsInstancePut(w1))
+	assert.Nil(t, s.WindowsInstancePut(w2))
+	assert.Nil(t, s.WindowsInstancePut(w2))
+
+	instances, err := s.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, instances, []*types.WindowsInstance{w1, w2})
+	assert.Len(t, instances, 2)
+
+	assert.Nil(t, s.WindowsInstanceDelete(w1.Id))
+	assert.Nil(t, s.WindowsInstanceDelete(w1.Id))
+
+	instances, err = s.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.WindowsInstance{w2}, instances)
+}
+
+func testClient(t *testing.T, s storage.StorageApi) {
+	c1 := &types.Client{Id: "c1", SessionId: "s1"}
+
+	assert.True(t, storage.NotFound(s.ClientPut(c1)))
+
+	found, err := s.ClientGet(c1.Id)
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1"}))
+	assert.Nil(t, s.ClientPut(c1))
+
+	c1.ViewPort = types.ViewPort{Rows: 24, Cols: 80}
+	assert.Nil(t, s.ClientPut(c1))
+
+	found, err = s.ClientGet(c1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, c1, found)
+
+	count, err := s.ClientCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.Nil(t, s.ClientDelete(c1.Id))
+	assert.Nil(t, s.ClientDelete(c1.Id))
+
+	_, err = s.ClientGet(c1.Id)
+	assert.True(t, storage.NotFound(err))
+	count, err = s.ClientCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testClientIndex(t *testing.T, s storage.StorageApi) {
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1"}))
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s2"}))
+
+	c1 := &types.Client{Id: "c1", SessionId: "s1"}
+	c2 := &types.Client{Id: "c2", SessionId: "s1"}
+	c3 := &types.Client{Id: "c3", SessionId: "s2"}
+	assert.Nil(t, s.ClientPut(c1))
+	assert.Nil(t, s.ClientPut(c2))
+	assert.Nil(t, s.ClientPut(c3))
+	assert.Nil(t, s.ClientPut(c1))
+
+	clients, err := s.ClientFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Subset(t, clients, []*types.Client{c1, c2})
+	assert.Len(t, clients, 2)
+
+	assert.Nil(t, s.ClientDelete(c1.Id))
+	clients, err = s.ClientFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Client{c2}, clients)
+}
+
+func testClientExpired(t *testing.T, s storage.StorageApi) {
+	now := time.Now()
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s1"}))
+
+	c1 := &types.Client{Id: "c1", SessionId: "s1", ExpiresAt: now.Add(-time.Minute)}
+	c2 := &types.Client{Id: "c2", SessionId: "s1", ExpiresAt: now.Add(time.Minute)}
+	c3 := &types.Client{Id: "c3", SessionId: "s1"}
+	assert.Nil(t, s.ClientPut(c1))
+	assert.Nil(t, s.ClientPut(c2))
+	assert.Nil(t, s.ClientPut(c3))
+
+	clients, err := s.ClientFindExpired(now)
+	assert.Nil(t, err)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "c1", clients[0].Id)
+
+	// Refreshing the expiry time takes the client out of the expired set
+	c1.ExpiresAt = now.Add(time.Minute)
+	assert.Nil(t, s.ClientPut(c1))
+	clients, err = s.ClientFindExpired(now)
+	assert.Nil(t, err)
+	assert.Empty(t, clients)
+
+	clients, err = s.ClientFindExpired(now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, clients, 2)
+}
+
+func testLoginRequest(t *testing.T, s storage.StorageApi) {
+	found, err := s.LoginRequestGet("lr1")
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	lr := &types.LoginRequest{Id: "lr1", Provider: "github"}
+	assert.Nil(t, s.LoginRequestPut(lr))
+
+	found, err = s.LoginRequestGet(lr.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, found)
+
+	all, err := s.LoginRequestGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.LoginRequest{lr}, all)
+
+	assert.Nil(t, s.LoginRequestDelete(lr.Id))
+	assert.Nil(t, s.LoginRequestDelete(lr.Id))
+
+	_, err = s.LoginRequestGet(lr.Id)
+	assert.True(t, storage.NotFound(err))
+}
+
+func testLoginRequestExpired(t *testing.T, s storage.StorageApi) {
+	now := time.Now()
+
+	lr1 := &types.LoginRequest{Id: "lr1", Provider: "github", ExpiresAt: now.Add(-time.Minute)}
+	lr2 := &types.LoginRequest{Id: "lr2", Provider: "github", ExpiresAt: now.Add(time.Minute)}
+	lr3 := &types.LoginRequest{Id: "lr3", Provider: "github"}
+	assert.Nil(t, s.LoginRequestPut(lr1))
+	assert.Nil(t, s.LoginRequestPut(lr2))
+	assert.Nil(t, s.LoginRequestPut(lr3))
+
+	loginRequests, err := s.LoginRequestFindExpired(now)
+	assert.Nil(t, err)
+	assert.Len(t, loginRequests, 1)
+	assert.Equal(t, "lr1", loginRequests[0].Id)
+
+	assert.Nil(t, s.LoginRequestDelete("lr1"))
+	loginRequests, err = s.LoginRequestFindExpired(now)
+	assert.Nil(t, err)
+	assert.Empty(t, loginRequests)
+}
+
+func testUser(t *testing.T, s storage.StorageApi) {
+	found, err := s.UserGet("u1")
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	_, err = s.UserFindByProvider("github", "1234")
+	assert.True(t, storage.NotFound(err))
+
+	u1 := &types.User{Id: "u1", Provider: "github", ProviderUserId: "1234", Name: "foo"}
+	u2 := &types.User{Id: "u2", Provider: "google", ProviderUserId: "1234", Name: "bar"}
+	assert.Nil(t, s.UserPut(u1))
+	assert.Nil(t, s.UserPut(u2))
+
+	found, err = s.UserGet(u1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, u1, found)
+
+	found, err = s.UserFindByProvider("github", "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, u1, found)
+
+	found, err = s.UserFindByProvider("google", "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, u2, found)
+
+	users, err := s.UserGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, users, []*types.User{u1, u2})
+	assert.Len(t, users, 2)
+
+	u1.IsBanned = true
+	assert.Nil(t, s.UserPut(u1))
+	found, err = s.UserFindByProvider("github", "1234")
+	assert.Nil(t, err)
+	assert.True(t, found.IsBanned)
+}
+
+func testPlayground(t *testing.T, s storage.StorageApi) {
+	found, err := s.PlaygroundGet("p1")
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	playgrounds, err := s.PlaygroundGetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, playgrounds)
+
+	p1 := &types.Playground{Id: "p1", Domain: "localhost", Tasks: []string{".*"}, Extras: types.PlaygroundExtras{"foo": "bar"}}
+	p2 := &types.Playground{Id: "p2", Domain: "example.com"}
+	assert.Nil(t, s.PlaygroundPut(p1))
+	assert.Nil(t, s.PlaygroundPut(p2))
+
+	found, err = s.PlaygroundGet(p1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, p1, found)
+
+	playgrounds, err = s.PlaygroundGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, playgrounds, []*types.Playground{p1, p2})
+	assert.Len(t, playgrounds, 2)
+}
+
+func testSnapshot(t *testing.T, s storage.StorageApi) {
+	found, err := s.SnapshotGet("id1")
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	snapshots, err := s.SnapshotGetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, snapshots)
+
+	s1 := &types.Snapshot{Id: "id1", Name: "snap1", SessionId: "s1", PlaygroundId: "p1", CreatedAt: time.Unix(1500000000, 0).UTC(), Instances: []types.SnapshotInstance{{Hostname: "node1", Image: "pwd-snapshot-snap1:node1", Committed: true}}}
+	s2 := &types.Snapshot{Id: "id2", Name: "snap2", SessionId: "s2", PlaygroundId: "p1", CreatedAt: time.Unix(1500000000, 0).UTC()}
+	assert.Nil(t, s.SnapshotPut(s1))
+	assert.Nil(t, s.SnapshotPut(s2))
+
+	found, err = s.SnapshotGet(s1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s1, found)
+
+	snapshots, err = s.SnapshotGetAll()
+	assert.Nil(t, err)
+	assert.Len(t, snapshots, 2)
+
+	assert.Nil(t, s.SnapshotDelete(s1.Id))
+	_, err = s.SnapshotGet(s1.Id)
+	assert.True(t, storage.NotFound(err))
+	snapshots, err = s.SnapshotGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Snapshot{s2}, snapshots)
+
+	// Deleting what isn't there is fine
+	assert.Nil(t, s.SnapshotDelete(s1.Id))
+}
+
+func testSessionSetupStatus(t *testing.T, s storage.StorageApi) {
+	status := &types.SessionSetupStatus{SessionId: "session1", State: types.SetupRunning, StartedAt: time.Unix(1500000000, 0).UTC()}
+
+	// There's no session
+	assert.True(t, storage.NotFound(s.SessionSetupStatusPut(status)))
+
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "session1"}))
+	assert.Nil(t, s.SessionSetupStatusPut(status))
+
+	status.State = types.SetupDone
+	status.Steps = []types.SessionSetupStep{{Hostname: "node1", Instance: "aaaabbbb_node1", Step: types.SetupStepCommandFinished, Command: []string{"ls"}, ExitCode: 1, Output: "out", At: time.Unix(1500000001, 0).UTC()}}
+	assert.Nil(t, s.SessionSetupStatusPut(status))
+
+	found, err := s.SessionSetupStatusGet("session1")
+	assert.Nil(t, err)
+	assert.Equal(t, status, found)
+
+	assert.Nil(t, s.SessionDelete("session1"))
+	_, err = s.SessionSetupStatusGet("session1")
+	assert.True(t, storage.NotFound(err))
+}
+
+func testTemplate(t *testing.T, s storage.StorageApi) {
+	found, err := s.TemplateGet("p1", "swarm", 0)
+	assert.True(t, storage.NotFound(err))
+	assert.Nil(t, found)
+
+	v1 := &types.SessionTemplate{Name: "swarm", PlaygroundId: "p1", Version: 1, CreatedAt: time.Unix(1500000000, 0).UTC(), Instances: []types.TemplateInstance{{Hostname: "manager1", IsSwarmManager: true}}}
+	v2 := &types.SessionTemplate{Name: "swarm", PlaygroundId: "p1", Version: 2, CreatedAt: time.Unix(1500000000, 0).UTC(), Instances: []types.TemplateInstance{{Hostname: "manager1", IsSwarmManager: true, Envs: []string{"FOO=bar"}}}}
+	other := &types.SessionTemplate{Name: "swarm", PlaygroundId: "p2", Version: 1, CreatedAt: time.Unix(1500000000, 0).UTC()}
+	assert.Nil(t, s.TemplatePut(v2))
+	assert.Nil(t, s.TemplatePut(v1))
+	assert.Nil(t, s.TemplatePut(other))
+
+	found, err = s.TemplateGet("p1", "swarm", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, v2, found)
+
+	found, err = s.TemplateGet("p1", "swarm", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, v1, found)
+
+	_, err = s.TemplateGet("p1", "swarm", 3)
+	assert.True(t, storage.NotFound(err))
+
+	templates, err := s.TemplateFindByPlaygroundId("p1")
+	assert.Nil(t, err)
+	assert.Len(t, templates, 2)
+
+	assert.Nil(t, s.TemplateDelete("p1", "swarm"))
+	_, err = s.TemplateGet("p1", "swarm", 0)
+	assert.True(t, storage.NotFound(err))
+
+	found, err = s.TemplateGet("p2", "swarm", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, other, found)
+}
+
+func testLease(t *testing.T, s storage.StorageApi) {
+	ok, err := s.LeaseAcquire("scheduler", "replica1", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// Renewing
+	ok, err = s.LeaseAcquire("scheduler", "replica1", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.LeaseAcquire("scheduler", "replica2", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// Leases are independent from each other
+	ok, err = s.LeaseAcquire("other", "replica2", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// Only the holder can release it
+	assert.Nil(t, s.LeaseRelease("scheduler", "replica2"))
+	ok, err = s.LeaseAcquire("scheduler", "replica2", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Nil(t, s.LeaseRelease("scheduler", "replica1"))
+	ok, err = s.LeaseAcquire("scheduler", "replica2", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func testLeaseExpired(t *testing.T, s storage.StorageApi) {
+	ok, err := s.LeaseAcquire("scheduler", "replica1", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(5 * time.Millisecond)
+
+	ok, err = s.LeaseAcquire("scheduler", "replica2", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.LeaseAcquire("scheduler", "replica1", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testConcurrent(t *testing.T, s storage.StorageApi) {
+	const sessions = 10
+	const instances = 5
+
+	wg := sync.WaitGroup{}
+	for n := 0; n < sessions; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			sessionId := fmt.Sprintf("s%d", n)
+			assert.Nil(t, s.SessionPut(&types.Session{Id: sessionId}))
+			for m := 0; m < instances; m++ {
+				assert.Nil(t, s.InstancePut(&types.Instance{Name: fmt.Sprintf("%s_i%d", sessionId, m), SessionId: sessionId}))
+				assert.Nil(t, s.ClientPut(&types.Client{Id: fmt.Sprintf("%s_c%d", sessionId, m), SessionId: sessionId}))
+				_, err := s.InstanceFindBySessionId(sessionId)
+				assert.Nil(t, err)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	count, err := s.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, sessions, count)
+	count, err = s.InstanceCount()
+	assert.Nil(t, err)
+	assert.Equal(t, sessions*instances, count)
+	count, err = s.ClientCount()
+	assert.Nil(t, err)
+	assert.Equal(t, sessions*instances, count)
+
+	for n := 0; n < sessions; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			sessionId := fmt.Sprintf("s%d", n)
+			found, err := s.InstanceFindBySessionId(sessionId)
+			assert.Nil(t, err)
+			assert.Len(t, found, instances)
+			assert.Nil(t, s.SessionDelete(sessionId))
+		}(n)
+	}
+	wg.Wait()
+
+	count, err = s.InstanceCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	count, err = s.ClientCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
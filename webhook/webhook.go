@@ -0,0 +1,274 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	SignatureHeader = "X-PWD-Signature"
+	EventHeader     = "X-PWD-Event"
+	DeliveryHeader  = "X-PWD-Delivery"
+)
+
+// DefaultEvents are delivered to webhooks that don't list any event.
+var DefaultEvents = []event.EventType{
+	event.SESSION_NEW,
+	event.SESSION_READY,
+	event.SESSION_END,
+	event.INSTANCE_NEW,
+	event.INSTANCE_DELETE,
+}
+
+// Body is what gets POSTed to webhooks. Payload is the typed payload of the
+// event when it has one and its raw args otherwise.
+type Body struct {
+	Id           string          `json:"id"`
+	Event        event.EventType `json:"event"`
+	SessionId    string          `json:"session_id"`
+	PlaygroundId string          `json:"playground_id"`
+	Timestamp    time.Time       `json:"timestamp"`
+	Payload      interface{}     `json:"payload"`
+}
+
+// Delivery is the outcome of sending one event to one webhook.
+type Delivery struct {
+	Id           string          `json:"id"`
+	WebhookId    string          `json:"webhook_id"`
+	URL          string          `json:"url"`
+	PlaygroundId string          `json:"playground_id"`
+	SessionId    string          `json:"session_id"`
+	Event        event.EventType `json:"event"`
+	Attempts     int             `json:"attempts"`
+	StatusCode   int             `json:"status_code"`
+	Error        string          `json:"error,omitempty"`
+	Delivered    bool            `json:"delivered"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+type Dispatcher struct {
+	pwd    pwd.PWDApi
+	client *http.Client
+
+	maxAttempts int
+	backoff     time.Duration
+	logSize     int
+
+	mx sync.Mutex
+	// sessions maps session ids to their playground so SESSION_END can still
+	// be routed after the session was removed from storage.
+	sessions   map[string]string
+	deliveries []*Delivery
+}
+
+func NewDispatcher(e event.EventApi, p pwd.PWDApi, maxAttempts int, logSize int) *Dispatcher {
+	d := &Dispatcher{
+		pwd:         p,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: maxAttempts,
+		backoff:     time.Second,
+		logSize:     logSize,
+		sessions:    map[string]string{},
+		deliveries:  []*Delivery{},
+	}
+	// Every replica gets every event, the one that emitted it delivers it
+	if o, ok := e.(event.OriginApi); ok {
+		o.OnAnyWithOrigin(d.receive)
+	} else {
+		e.OnAny(d.dispatch)
+	}
+	return d
+}
+
+// receive delivers the events emitted by this replica. The ones of other
+// replicas are only followed, so SESSION_END can still be routed if the
+// session gets closed here.
+func (d *Dispatcher) receive(local bool, name event.EventType, sessionId string, args ...interface{}) {
+	if local {
+		d.dispatch(name, sessionId, args...)
+		return
+	}
+	if name != event.PLAYGROUND_NEW {
+		d.playgroundId(name, sessionId)
+	}
+}
+
+func (d *Dispatcher) playground(name event.EventType, sessionId string) *types.Playground {
+	playgroundId, found := d.playgroundId(name, sessionId)
+	if !found {
+		return nil
+	}
+	return d.pwd.PlaygroundGet(playgroundId)
+}
+
+// playgroundId finds the playground of a session, remembering it until the
+// session ends.
+func (d *Dispatcher) playgroundId(name event.EventType, sessionId string) (string, bool) {
+	d.mx.Lock()
+	playgroundId, found := d.sessions[sessionId]
+	if name == event.SESSION_END {
+		delete(d.sessions, sessionId)
+	}
+	d.mx.Unlock()
+
+	if !found {
+		if name == event.SESSION_END {
+			return "", false
+		}
+		session, err := d.pwd.SessionGet(sessionId)
+		if err != nil {
+			return "", false
+		}
+		playgroundId = session.PlaygroundId
+		d.mx.Lock()
+		d.sessions[sessionId] = playgroundId
+		d.mx.Unlock()
+	}
+	return playgroundId, true
+}
+
+func wants(w types.Webhook, name event.EventType) bool {
+	if len(w.Events) == 0 {
+		for _, e := range DefaultEvents {
+			if e == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, e := range w.Events {
+		if e == name.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) dispatch(name event.EventType, sessionId string, args ...interface{}) {
+	if name == event.PLAYGROUND_NEW {
+		return
+	}
+	playground := d.playground(name, sessionId)
+	if playground == nil || len(playground.Webhooks) == 0 {
+		return
+	}
+
+	var payload interface{} = args
+	if p, err := event.DecodePayload(name, args); err == nil {
+		payload = p
+	}
+
+	for _, w := range playground.Webhooks {
+		if !wants(w, name) {
+			continue
+		}
+		body := Body{Id: uuid.NewV4().String(), Event: name, SessionId: sessionId, PlaygroundId: playground.Id, Timestamp: time.Now(), Payload: payload}
+		delivery := &Delivery{Id: body.Id, WebhookId: w.Id, URL: w.URL, PlaygroundId: playground.Id, SessionId: sessionId, Event: name, CreatedAt: body.Timestamp, UpdatedAt: body.Timestamp}
+		d.log(delivery)
+		go d.deliver(w, body, delivery)
+	}
+}
+
+func (d *Dispatcher) log(delivery *Delivery) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > d.logSize {
+		d.deliveries = d.deliveries[len(d.deliveries)-d.logSize:]
+	}
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) deliver(w types.Webhook, body Body, delivery *Delivery) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Cannot encode webhook body for event [%s]. Got: %v\n", body.Event, err)
+		d.update(delivery, 0, err)
+		return
+	}
+
+	backoff := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		status, err := d.post(w, body, b)
+		d.update(delivery, status, err)
+		if err == nil {
+			return
+		}
+		if attempt < d.maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	log.Printf("Giving up delivering event [%s] of session [%s] to %s after %d attempts\n", body.Event, body.SessionId, w.URL, d.maxAttempts)
+}
+
+func (d *Dispatcher) post(w types.Webhook, body Body, b []byte) (int, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, body.Event.String())
+	req.Header.Set(DeliveryHeader, body.Id)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, b))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) update(delivery *Delivery, status int, err error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	delivery.Attempts++
+	delivery.StatusCode = status
+	delivery.UpdatedAt = time.Now()
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Error = ""
+		delivery.Delivered = true
+	}
+}
+
+// Deliveries returns the most recent deliveries for a playground made by
+// this replica, newest first.
+func (d *Dispatcher) Deliveries(playgroundId string) []Delivery {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	deliveries := []Delivery{}
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].PlaygroundId == playgroundId {
+			deliveries = append(deliveries, *d.deliveries[i])
+		}
+	}
+	return deliveries
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func newDispatcher(p *pwd.Mock, e event.EventApi) *Dispatcher {
+	d := NewDispatcher(e, p, 3, 10)
+	d.backoff = time.Millisecond
+	return d
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	reqs := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- received{header: r.Header, body: b}
+	}))
+	defer srv.Close()
+
+	_p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", Webhooks: []types.Webhook{{Id: "lms", URL: srv.URL, Secret: "s3cr3t"}}}
+	_p.On("SessionGet", "aaaabbbbcccc").Return(&types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}, nil)
+	_p.On("PlaygroundGet", "foobar").Return(playground)
+
+	d := newDispatcher(_p, event.NewLocalBroker())
+
+	// Stats are not delivered by default
+	d.dispatch(event.INSTANCE_STATS, "aaaabbbbcccc", event.InstanceStatsPayload{Instance: "node1"})
+	d.dispatch(event.INSTANCE_NEW, "aaaabbbbcccc", "node1", "10.0.0.1", "node1", "ip10-0-0-1")
+
+	r := <-reqs
+	assert.Equal(t, "instance new", r.header.Get(EventHeader))
+	assert.Equal(t, Sign("s3cr3t", r.body), r.header.Get(SignatureHeader))
+
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(r.body, &body))
+	assert.Equal(t, r.header.Get(DeliveryHeader), body["id"])
+	assert.Equal(t, "aaaabbbbcccc", body["session_id"])
+	assert.Equal(t, "foobar", body["playground_id"])
+	assert.Equal(t, map[string]interface{}{"name": "node1", "ip": "10.0.0.1", "hostname": "node1", "proxy_host": "ip10-0-0-1"}, body["payload"])
+
+	// SESSION_END is routed even though the session is gone by then
+	d.dispatch(event.SESSION_END, "aaaabbbbcccc")
+	r = <-reqs
+	assert.Equal(t, "session end", r.header.Get(EventHeader))
+
+	select {
+	case r := <-reqs:
+		t.Fatalf("Unexpected delivery of %s", r.header.Get(EventHeader))
+	case <-time.After(50 * time.Millisecond):
+	}
+	_p.AssertNumberOfCalls(t, "SessionGet", 1)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	mx := sync.Mutex{}
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		calls++
+		if calls < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	_p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", Webhooks: []types.Webhook{{Id: "lms", URL: srv.URL, Secret: "s3cr3t", Events: []string{"session ready"}}}}
+	_p.On("SessionGet", "aaaabbbbcccc").Return(&types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}, nil)
+	_p.On("PlaygroundGet", "foobar").Return(playground)
+
+	d := newDispatcher(_p, event.NewLocalBroker())
+	d.dispatch(event.SESSION_READY, "aaaabbbbcccc", true)
+
+	assert.Eventually(t, func() bool {
+		deliveries := d.Deliveries("foobar")
+		return len(deliveries) == 1 && deliveries[0].Delivered
+	}, time.Second, 5*time.Millisecond)
+
+	deliveries := d.Deliveries("foobar")
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, 200, deliveries[0].StatusCode)
+	assert.Equal(t, "", deliveries[0].Error)
+	assert.Equal(t, "lms", deliveries[0].WebhookId)
+	assert.Equal(t, []Delivery{}, d.Deliveries("other"))
+}
+
+func TestDispatcher_GiveUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", Webhooks: []types.Webhook{{Id: "lms", URL: srv.URL}}}
+	_p.On("SessionGet", "aaaabbbbcccc").Return(&types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}, nil)
+	_p.On("PlaygroundGet", "foobar").Return(playground)
+
+	d := newDispatcher(_p, event.NewLocalBroker())
+	d.dispatch(event.SESSION_NEW, "aaaabbbbcccc")
+
+	assert.Eventually(t, func() bool {
+		deliveries := d.Deliveries("foobar")
+		return len(deliveries) == 1 && deliveries[0].Attempts == 3
+	}, time.Second, 5*time.Millisecond)
+
+	deliveries := d.Deliveries("foobar")
+	assert.False(t, deliveries[0].Delivered)
+	assert.Equal(t, 500, deliveries[0].StatusCode)
+	assert.Equal(t, "Webhook responded with status 500", deliveries[0].Error)
+}
+
+func TestDispatcher_OnlyLocalEvents(t *testing.T) {
+	reqs := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- received{header: r.Header, body: b}
+	}))
+	defer srv.Close()
+
+	_p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", Webhooks: []types.Webhook{{Id: "lms", URL: srv.URL}}}
+	_p.On("SessionGet", "aaaabbbbcccc").Return(&types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}, nil)
+	_p.On("PlaygroundGet", "foobar").Return(playground)
+
+	transport := event.NewMemoryTransport()
+	local, err := event.NewDistributedBroker(transport, "pwd.events", event.LocalBrokerOpts{})
+	assert.Nil(t, err)
+	other, err := event.NewDistributedBroker(transport, "pwd.events", event.LocalBrokerOpts{})
+	assert.Nil(t, err)
+	d := newDispatcher(_p, local)
+	newDispatcher(_p, other)
+
+	local.Emit(event.SESSION_READY, "aaaabbbbcccc", true)
+	r := <-reqs
+	assert.Equal(t, "session ready", r.header.Get(EventHeader))
+
+	// Delivered by the replica that closed the session, which only
+	// followed its events until then
+	other.Emit(event.SESSION_END, "aaaabbbbcccc")
+	r = <-reqs
+	assert.Equal(t, "session end", r.header.Get(EventHeader))
+
+	select {
+	case r := <-reqs:
+		t.Fatalf("Unexpected delivery of %s", r.header.Get(EventHeader))
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Eventually(t, func() bool {
+		d.mx.Lock()
+		defer d.mx.Unlock()
+		return len(d.sessions) == 0
+	}, time.Second, 10*time.Millisecond)
+}